@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/jasdel/harvester/internal/foreman"
+	"github.com/jasdel/harvester/internal/notifier"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/jasdel/harvester/internal/web"
+	"github.com/jasdel/harvester/internal/worker"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// All in one runs the web server, foreman, worker, and notifier together in a
+// single process. The parts of the service are connected over in-process queues,
+// so gnatsd is not needed. Combined with the embedded storage driver the
+// whole service can be run as a single binary.
+//
+// The number of foreman and worker go routines can be set via the
+// configuration file, or the -foremen and -workers command line arguments.
+//
+// The endpoints exposed are the same as the web_server's.
+//
+func main() {
+	// Configuration file containing all basic configuration for a server instance to run
+	cfgFilename := flag.String("config", "config.json", "The all in one configuration file.")
+
+	// Overrides the configuration file's fields, simplifies running with
+	// different settings without needing multiple configuration files.
+	httpAddr := flag.String("addr", "", "Host address to override config file")
+	foremen := flag.Int("foremen", 0, "Number of foreman go routines to override config file")
+	workers := flag.Int("workers", 0, "Number of worker go routines to override config file")
+
+	flag.Parse()
+	cfg, err := LoadConfig(*cfgFilename)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *httpAddr != "" {
+		cfg.HTTPAddr = *httpAddr
+	}
+	if *foremen > 0 {
+		cfg.Foremen = *foremen
+	}
+	if *workers > 0 {
+		cfg.Workers = *workers
+	}
+
+	// Initialize the storage shared by all parts of the service.
+	sc, err := storage.NewClient(cfg.StorageConfig)
+	if err != nil {
+		log.Fatalln("Storage NewClient failed:", err)
+	}
+	defer sc.Close()
+
+	handler, stop, err := start(cfg, sc)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer stop()
+
+	log.Println("Listening on", cfg.HTTPAddr, "with", cfg.Foremen, "foremen and", cfg.Workers, "workers")
+	if err := http.ListenAndServe(cfg.HTTPAddr, handler); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// Connects the queues, and starts the foreman, worker, and notifier go routines.
+// Returns the HTTP handler for the web server's routes, and a function to stop
+// the notifier and workers.
+func start(cfg Config, sc *storage.Client) (http.Handler, func(), error) {
+	// URL queue is published to by all parts of the service, and
+	// received from by the foremen.
+	urlQueuePub, err := queue.NewPublisher(cfg.URLQueueConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Queue Publisher initialization failed: %v", err)
+	}
+	urlQueueRecv, err := queue.NewReceiver(cfg.URLQueueConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Queue Receiver initialization failed: %v", err)
+	}
+
+	// Work queue is published to by the foremen, and received from
+	// by the workers.
+	workQueuePub, err := queue.NewPublisher(cfg.WorkQueueConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Worker Queue Publisher initialization failed: %v", err)
+	}
+	workQueueRecv, err := queue.NewReceiver(cfg.WorkQueueConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Worker Queue Receiver initialization failed: %v", err)
+	}
+
+	// Progress topic is published to by the foremen and workers, and
+	// subscribed to by the web server's job status streams.
+	progressPub, err := queue.NewProgressPublisher(cfg.ProgressQueueConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Progress Publisher initialization failed: %v", err)
+	}
+	progressSub, err := queue.NewProgressSubscriber(cfg.ProgressQueueConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Progress Subscriber initialization failed: %v", err)
+	}
+
+	f := foreman.NewForeman(workQueuePub, urlQueuePub, progressPub, sc, cfg.CacheMaxAge)
+	for i := 0; i < cfg.Foremen; i++ {
+		go func() {
+			for {
+				item := <-urlQueueRecv.Receive()
+				f.ProcessQueueItem(item)
+			}
+		}()
+	}
+
+	crawler := worker.NewCrawler(urlQueuePub, workQueuePub, progressPub, sc, worker.CrawlerConfig{
+		UserAgent:             cfg.UserAgent,
+		RobotsMaxAge:          cfg.RobotsMaxAge,
+		HostRequestsPerSecond: cfg.HostRequestsPerSecond,
+		HostMaxConnections:    cfg.HostMaxConnections,
+		HostConcurrency:       cfg.HostConcurrency,
+		MaxAttempts:           cfg.MaxAttempts,
+		RetryDelay:            cfg.RetryDelay,
+		SchedulePollInterval:  cfg.SchedulePollInterval,
+	})
+	pool := worker.NewPool(crawler, cfg.Workers)
+	pool.Start(workQueueRecv.Receive())
+
+	n := notifier.New(sc, notifier.Config{
+		Secret:       cfg.CallbackSecret,
+		MaxAttempts:  cfg.CallbackMaxAttempts,
+		RetryDelay:   cfg.CallbackRetryDelay,
+		PollInterval: cfg.CallbackPollInterval,
+	})
+	n.Start()
+
+	stop := func() {
+		n.Stop()
+		pool.Stop()
+	}
+	return web.NewHandler(cfg.HTTPRootPath, urlQueuePub, progressSub, sc), stop, nil
+}
+
+// Provides the merged configuration of the web server, foreman, and worker.
+type Config struct {
+	// Storage connection configuration
+	StorageConfig storage.ClientConfig `json:"storage"`
+
+	// Queue for URLs to be filtered by the foremen. If no connection URL
+	// is set the in-process queue will be used.
+	URLQueueConfig queue.QueueConfig `json:"urlQueue"`
+
+	// Queue for URLs to be crawled by the workers. If no connection URL
+	// is set the in-process queue will be used.
+	WorkQueueConfig queue.QueueConfig `json:"workQueue"`
+
+	// Topic for the progress of jobs, streamed to clients by the web
+	// server. If no connection URL is set the in-process topic will be used.
+	ProgressQueueConfig queue.QueueConfig `json:"progressQueue"`
+
+	// HTTP address to service content from
+	HTTPAddr string `json:"httpAddr"`
+
+	// Root path the HTTP routes should be based of of. Useful when
+	// nesting the service behind a reverse proxy
+	HTTPRootPath string `json:"httpRootPath"`
+
+	// Number of foreman go routines filtering queued URLs.
+	Foremen int `json:"foremen"`
+
+	// Number of worker go routines crawling URLs.
+	Workers int `json:"workers"`
+
+	// Maximum age a URL can be cached for before it is allowed to
+	// e.g: 1m23s for 1 minute and 23 seconds
+	// See http://golang.org/pkg/time/#ParseDuration for formatting
+	CacheMaxAgeStr string `json:"cacheMaxAge"`
+
+	// The CacheMaxAgeStr will be parsed, and its value placed into the CacheMaxAge field.
+	CacheMaxAge time.Duration `json:"-"`
+
+	// User agent the workers identify themselves with when requesting URLs.
+	UserAgent string `json:"userAgent"`
+
+	// Maximum age a site's robots.txt is cached for before it is
+	// requested again. time.Duration string formated value.
+	RobotsMaxAgeStr string `json:"robotsMaxAge"`
+
+	// The RobotsMaxAgeStr will be parsed, and its value placed into the RobotsMaxAge field.
+	RobotsMaxAge time.Duration `json:"-"`
+
+	// Maximum number of requests per second made to a single host, shared
+	// across all workers.
+	HostRequestsPerSecond float64 `json:"hostRequestsPerSecond"`
+
+	// Maximum number of concurrent connections to a single host, shared
+	// across all workers.
+	HostMaxConnections int `json:"hostMaxConnections"`
+
+	// Maximum number of concurrent crawls of a single host by the workers.
+	HostConcurrency int `json:"hostConcurrency"`
+
+	// Maximum number of times a URL is attempted to be crawled before it
+	// is recorded as a dead letter.
+	MaxAttempts int `json:"maxAttempts"`
+
+	// Duration before the first retry of a URL which failed to be crawled.
+	// time.Duration string formated value.
+	RetryDelayStr string `json:"retryDelay"`
+
+	// The RetryDelayStr will be parsed, and its value placed into the RetryDelay field.
+	RetryDelay time.Duration `json:"-"`
+
+	// Interval storage is polled at for retried and deferred URLs which are
+	// due to be sent to their queue. time.Duration string formated value.
+	SchedulePollIntervalStr string `json:"schedulePollInterval"`
+
+	// The SchedulePollIntervalStr will be parsed, and its value placed into the SchedulePollInterval field.
+	SchedulePollInterval time.Duration `json:"-"`
+
+	// Secret the bodies of job callbacks are signed with. If not set the
+	// callbacks are not signed.
+	CallbackSecret string `json:"callbackSecret"`
+
+	// Maximum number of times a job callback is attempted to be delivered.
+	CallbackMaxAttempts int `json:"callbackMaxAttempts"`
+
+	// Duration before the first retry of a job callback which failed to be
+	// delivered. time.Duration string formated value.
+	CallbackRetryDelayStr string `json:"callbackRetryDelay"`
+
+	// The CallbackRetryDelayStr will be parsed, and its value placed into the CallbackRetryDelay field.
+	CallbackRetryDelay time.Duration `json:"-"`
+
+	// Interval storage is polled at for job callbacks to deliver.
+	// time.Duration string formated value.
+	CallbackPollIntervalStr string `json:"callbackPollInterval"`
+
+	// The CallbackPollIntervalStr will be parsed, and its value placed into the CallbackPollInterval field.
+	CallbackPollInterval time.Duration `json:"-"`
+}
+
+// Loads the configuration file from disk in as a JSON blob.
+func LoadConfig(filename string) (Config, error) {
+	cfg := Config{}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return cfg, err
+	}
+	defer file.Close()
+
+	if err = json.NewDecoder(file).Decode(&cfg); err != nil {
+		return cfg, err
+	}
+
+	if cfg.CacheMaxAge, err = parseDuration(cfg.CacheMaxAgeStr); err != nil {
+		return cfg, err
+	}
+	if cfg.RobotsMaxAge, err = parseDuration(cfg.RobotsMaxAgeStr); err != nil {
+		return cfg, err
+	}
+	if cfg.RetryDelay, err = parseDuration(cfg.RetryDelayStr); err != nil {
+		return cfg, err
+	}
+	if cfg.SchedulePollInterval, err = parseDuration(cfg.SchedulePollIntervalStr); err != nil {
+		return cfg, err
+	}
+	if cfg.CallbackRetryDelay, err = parseDuration(cfg.CallbackRetryDelayStr); err != nil {
+		return cfg, err
+	}
+	if cfg.CallbackPollInterval, err = parseDuration(cfg.CallbackPollIntervalStr); err != nil {
+		return cfg, err
+	}
+
+	setDefaults(&cfg)
+
+	return cfg, nil
+}
+
+// Fills in the configuration values which were not set with their defaults.
+func setDefaults(cfg *Config) {
+	if cfg.URLQueueConfig.ConnURL == "" {
+		cfg.URLQueueConfig.ConnURL = queue.MemScheme + "://all_in_one"
+	}
+	if cfg.URLQueueConfig.Topic == "" {
+		cfg.URLQueueConfig.Topic = "url_queue"
+	}
+	if cfg.WorkQueueConfig.ConnURL == "" {
+		cfg.WorkQueueConfig.ConnURL = queue.MemScheme + "://all_in_one"
+	}
+	if cfg.WorkQueueConfig.Topic == "" {
+		cfg.WorkQueueConfig.Topic = "work_queue"
+	}
+	if cfg.ProgressQueueConfig.ConnURL == "" {
+		cfg.ProgressQueueConfig.ConnURL = queue.MemScheme + "://all_in_one"
+	}
+	if cfg.ProgressQueueConfig.Topic == "" {
+		cfg.ProgressQueueConfig.Topic = "job_progress"
+	}
+	if cfg.Foremen <= 0 {
+		cfg.Foremen = 1
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+}
+
+// Parses a time.Duration string formated value. An empty string is a
+// zero duration. Negative durations are not valid.
+func parseDuration(str string) (time.Duration, error) {
+	if str == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("%s, %s", err.Error(), str)
+	} else if d < 0 {
+		return 0, fmt.Errorf("Invalid duration %s, must be positive", str)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,1014 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/notifier"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Small site used for crawling tests
+func testSiteHandler(robotsTxt string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			if robotsTxt == "" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, robotsTxt)
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/about">about</a><img src="/logo.png">`)
+		case "/about":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/">home</a><a href="/team">team</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// Starts all parts of the service with in-process queues and embedded
+// storage, and schedules a job for the URL. Blocks until the job is
+// completed.
+func crawlJob(t *testing.T, name, u string) (*storage.Client, common.JobId) {
+	sc, serviceURL, closeService := startService(t, name)
+	defer closeService()
+
+	return sc, scheduleJob(t, sc, serviceURL, u)
+}
+
+// Starts all parts of the service with in-process queues and embedded
+// storage. Returns the storage, the URL of the service's web server, and
+// a function to close the web server, and stop the notifier.
+func startService(t *testing.T, name string) (*storage.Client, string, func()) {
+	sc, err := storage.NewClient(storage.ClientConfig{Driver: storage.DriverSQLite})
+	require.Nil(t, err, "Expect no storage error")
+
+	cfg := Config{
+		URLQueueConfig:  queue.QueueConfig{ConnURL: "mem://" + name},
+		WorkQueueConfig: queue.QueueConfig{ConnURL: "mem://" + name},
+		Workers:         2,
+
+		HostRequestsPerSecond: 1000,
+		HostMaxConnections:    2,
+		HostConcurrency:       2,
+		MaxAttempts:           2,
+		RetryDelay:            time.Millisecond,
+		SchedulePollInterval:  10 * time.Millisecond,
+
+		CallbackSecret:       "test_secret",
+		CallbackPollInterval: 10 * time.Millisecond,
+	}
+	setDefaults(&cfg)
+
+	handler, stop, err := start(cfg, sc)
+	require.Nil(t, err, "Expect no start error")
+	server := httptest.NewServer(handler)
+
+	return sc, server.URL, func() {
+		server.Close()
+		stop()
+	}
+}
+
+// Schedules a job for the URL with the service. Blocks until the job is
+// completed.
+func scheduleJob(t *testing.T, sc *storage.Client, serviceURL, u string) common.JobId {
+	return scheduleJobQuery(t, sc, serviceURL, "", u)
+}
+
+// Schedules a job with the query parameters, and waits for it to complete.
+func scheduleJobQuery(t *testing.T, sc *storage.Client, serviceURL, query, u string) common.JobId {
+	rsp, err := http.Post(serviceURL+"/?"+query, "text/plain", strings.NewReader(u+"\n"))
+	return waitForJob(t, sc, rsp, err)
+}
+
+// Schedules a job with the JSON encoded options, and waits for it to complete.
+func scheduleJobOptions(t *testing.T, sc *storage.Client, serviceURL, options, u string) common.JobId {
+	body := fmt.Sprintf(`{"urls": [%q], "options": %s}`, u, options)
+	rsp, err := http.Post(serviceURL+"/", "application/json", strings.NewReader(body))
+	return waitForJob(t, sc, rsp, err)
+}
+
+// Waits for the job scheduled by the response to complete.
+func waitForJob(t *testing.T, sc *storage.Client, rsp *http.Response, err error) common.JobId {
+	require.Nil(t, err, "Expect no schedule error")
+	defer rsp.Body.Close()
+	scheduled := struct {
+		JobId common.JobId `json:"jobId"`
+	}{}
+	require.Nil(t, json.NewDecoder(rsp.Body).Decode(&scheduled), "Expect job id")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := sc.JobClient().GetJob(scheduled.JobId)
+		require.Nil(t, err, "Expect no error getting job")
+		if job.Status().Pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for job to complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return scheduled.JobId
+}
+
+// Crawls a small site end to end through the in-process queues and the
+// embedded storage.
+func TestAllInOneCrawl(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	sc, jobId := crawlJob(t, "test_crawl", site.URL)
+	defer sc.Close()
+
+	result, err := sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.ElementsMatch(t, []string{site.URL + "/about", site.URL + "/logo.png"}, result[site.URL], "Expect origin's descendants")
+	assert.ElementsMatch(t, []string{site.URL + "/", site.URL + "/team"}, result[site.URL+"/about"], "Expect level 1 descendants")
+}
+
+// URLs disallowed by the site's robots.txt are recorded as results, but
+// are never requested.
+func TestAllInOneCrawlRobotsBlocked(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler("User-agent: *\nDisallow: /about\n"))
+	defer site.Close()
+
+	sc, jobId := crawlJob(t, "test_robots", site.URL)
+	defer sc.Close()
+
+	result, err := sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.ElementsMatch(t, []string{site.URL + "/about", site.URL + "/logo.png"}, result[site.URL], "Expect blocked URL in results")
+	assert.Len(t, result[site.URL+"/about"], 0, "Expect blocked URL not crawled")
+
+	about, err := sc.URLClient().GetURLByURL(site.URL + "/about")
+	require.Nil(t, err, "Expect no error getting URL")
+	assert.Equal(t, common.CrawlStatusRobotsBlocked, about.CrawlStatus, "Expect URL blocked by robots")
+}
+
+// URLs which keep failing with a server error are retried, and then
+// recorded as dead letters of the job.
+func TestAllInOneCrawlDeadLetter(t *testing.T) {
+	requests := 0
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/broken">broken</a>`)
+		case "/broken":
+			requests++
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	sc, jobId := crawlJob(t, "test_dead_letter", site.URL)
+	defer sc.Close()
+
+	assert.Equal(t, 2, requests, "Expect broken URL retried")
+
+	dls, err := sc.DeadLetterClient().List(jobId)
+	require.Nil(t, err, "Expect no error listing dead letters")
+	require.Len(t, dls, 1, "Expect broken URL dead letter")
+	assert.Equal(t, site.URL+"/broken", dls[0].URL, "Expect broken URL")
+	assert.Equal(t, 2, dls[0].Attempts, "Expect all attempts made")
+	assert.Equal(t, http.StatusInternalServerError, dls[0].StatusCode, "Expect status code of last attempt")
+}
+
+// Leaf URLs of the job are checked, so the broken links of the site are
+// reported.
+func TestAllInOneCrawlBrokenLinks(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	sc, jobId := crawlJob(t, "test_broken_links", site.URL)
+	defer sc.Close()
+
+	links, err := sc.JobClient().BrokenLinks(jobId)
+	require.Nil(t, err, "Expect no error getting broken links")
+	assert.Equal(t, map[string][]storage.BrokenLink{
+		site.URL:            {{URL: site.URL + "/logo.png", StatusCode: http.StatusNotFound}},
+		site.URL + "/about": {{URL: site.URL + "/team", StatusCode: http.StatusNotFound}},
+	}, links, "Expect missing URLs reported")
+}
+
+// Leaf URLs on sites which cannot be resolved are retried, recorded as dead
+// letters, and reported as broken links. Failed fetches are not served from
+// the cache.
+func TestAllInOneCrawlUnresolvableLeaf(t *testing.T) {
+	const unresolvable = "http://unresolvable.invalid/page"
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/about">about</a>`)
+		case "/about":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a href="%s">unresolvable</a>`, unresolvable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_unresolvable_leaf")
+	defer closeService()
+	defer sc.Close()
+
+	// The failed fetches are recent enough to be cached, but are not used.
+	jobId := scheduleJobOptions(t, sc, serviceURL, `{"cacheMaxAge": "1h"}`, site.URL)
+
+	dls, err := sc.DeadLetterClient().List(jobId)
+	require.Nil(t, err, "Expect no error listing dead letters")
+	require.Len(t, dls, 1, "Expect unresolvable URL dead letter")
+	assert.Equal(t, unresolvable, dls[0].URL, "Expect unresolvable URL")
+	assert.Equal(t, 2, dls[0].Attempts, "Expect all attempts made")
+
+	links, err := sc.JobClient().BrokenLinks(jobId)
+	require.Nil(t, err, "Expect no error getting broken links")
+	require.Len(t, links[site.URL+"/about"], 1, "Expect unresolvable URL reported")
+	assert.Equal(t, unresolvable, links[site.URL+"/about"][0].URL, "Expect unresolvable URL")
+	assert.Equal(t, common.FetchErrorDNS, links[site.URL+"/about"][0].ErrorKind, "Expect DNS error")
+
+	u, err := sc.URLClient().GetURLByURL(unresolvable)
+	require.Nil(t, err, "Expect no error getting URL")
+	assert.Equal(t, common.CrawlStatusFailed, u.CrawlStatus, "Expect URL failed, not blocked by robots")
+}
+
+// Pages which have not changed since they were last crawled are not
+// downloaded again, and their previously found descendants are used.
+func TestAllInOneCrawlNotModified(t *testing.T) {
+	var full, notModified int32
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `<a href="/about">about</a>`)
+	}))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_not_modified")
+	defer closeService()
+	defer sc.Close()
+
+	scheduleJob(t, sc, serviceURL, site.URL)
+	jobId := scheduleJob(t, sc, serviceURL, site.URL)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&full), "Expect page downloaded once")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notModified), "Expect page not modified when crawled again")
+
+	result, err := sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.Equal(t, []string{site.URL + "/about"}, result[site.URL], "Expect cached descendants in result")
+}
+
+// Stylesheets, and inline styles are only scraped for URLs if the job
+// asks for them to be.
+func TestAllInOneCrawlScrapeCSS(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<link rel="stylesheet" href="/site.css"><div style="background: url(/hero.jpg)"></div>`)
+		case "/site.css":
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, `@import "print.css"; @font-face { src: url(font.woff); }`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_scrape_css")
+	defer closeService()
+	defer sc.Close()
+
+	jobId := scheduleJob(t, sc, serviceURL, site.URL)
+	result, err := sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.Equal(t, []string{site.URL + "/site.css"}, result[site.URL], "Expect inline styles not scraped")
+	assert.Len(t, result[site.URL+"/site.css"], 0, "Expect stylesheet not scraped")
+
+	jobId = scheduleJobQuery(t, sc, serviceURL, "scrapeCSS&forceCrawl", site.URL)
+	result, err = sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.ElementsMatch(t, []string{site.URL + "/site.css", site.URL + "/hero.jpg"}, result[site.URL], "Expect inline style scraped")
+	assert.ElementsMatch(t, []string{site.URL + "/print.css", site.URL + "/font.woff"}, result[site.URL+"/site.css"], "Expect stylesheet scraped")
+}
+
+// Pages which are only listed by the site's sitemaps are crawled as
+// descendants of the origin if the job asks for sitemaps.
+func TestAllInOneCrawlSitemaps(t *testing.T) {
+	var site *httptest.Server
+	site = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<p>no links</p>`)
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/hidden</loc><lastmod>2015-03-01</lastmod></url></urlset>`, site.URL)
+		case "/hidden":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/deeper">deeper</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_sitemaps")
+	defer closeService()
+	defer sc.Close()
+
+	jobId := scheduleJob(t, sc, serviceURL, site.URL)
+	result, err := sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.Len(t, result[site.URL], 0, "Expect sitemaps not discovered")
+
+	jobId = scheduleJobQuery(t, sc, serviceURL, "sitemaps", site.URL)
+	result, err = sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.Equal(t, []string{site.URL + "/hidden"}, result[site.URL], "Expect sitemap URL as origin's descendant")
+	assert.Equal(t, []string{site.URL + "/deeper"}, result[site.URL+"/hidden"], "Expect sitemap URL crawled")
+
+	hidden, err := sc.URLClient().GetURLByURL(site.URL + "/hidden")
+	require.Nil(t, err, "Expect no error getting URL")
+	assert.True(t, time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC).Equal(hidden.LastMod), "Expect lastmod stored")
+}
+
+// Jobs are crawled with the options they are scheduled with.
+func TestAllInOneCrawlJobOptions(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_job_options")
+	defer closeService()
+	defer sc.Close()
+
+	jobId := scheduleJobOptions(t, sc, serviceURL, `{"maxDepth": 1}`, site.URL)
+	result, err := sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.ElementsMatch(t, []string{site.URL + "/about", site.URL + "/logo.png"}, result[site.URL], "Expect origin's descendants")
+	assert.Len(t, result[site.URL+"/about"], 0, "Expect max depth not crawled")
+
+	jobId = scheduleJobOptions(t, sc, serviceURL, `{"maxDepth": 3, "maxPages": 1, "forceCrawl": true}`, site.URL)
+	result, err = sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.ElementsMatch(t, []string{site.URL + "/about", site.URL + "/logo.png"}, result[site.URL], "Expect origin's descendants")
+	assert.Len(t, result[site.URL+"/about"], 0, "Expect max pages not crawled")
+
+	jobId = scheduleJobOptions(t, sc, serviceURL, `{"allowedMimes": ["image/*"], "forceCrawl": true}`, site.URL)
+	result, err = sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.Len(t, result[site.URL], 0, "Expect origin not crawled")
+}
+
+// URLs out of the job's scope are recorded as results, but are never
+// requested.
+func TestAllInOneCrawlScope(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_scope")
+	defer closeService()
+	defer sc.Close()
+
+	jobId := scheduleJobOptions(t, sc, serviceURL, `{"scope": {"sameHost": true, "exclude": ["/about$"]}}`, site.URL)
+	result, err := sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.ElementsMatch(t, []string{site.URL + "/about", site.URL + "/logo.png"}, result[site.URL], "Expect out of scope URL in results")
+	assert.Len(t, result[site.URL+"/about"], 0, "Expect out of scope URL not crawled")
+
+	about, err := sc.URLClient().GetURLByURL(site.URL + "/about")
+	require.Nil(t, err, "Expect no error getting URL")
+	assert.True(t, about.Fetch.FetchedOn.IsZero(), "Expect out of scope URL not requested")
+}
+
+// Jobs scheduled with a JSON body are crawled with the options of their
+// URLs, and are only scheduled once for an idempotency key.
+func TestAllInOneScheduleJSON(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_schedule_json")
+	defer closeService()
+	defer sc.Close()
+
+	body := fmt.Sprintf(`{"urls": [{"url": %q, "options": {"maxDepth": 1}}, "/not/a/URL"],
+		"options": {"maxDepth": 3}, "tags": ["nightly"], "idempotencyKey": "abc"}`, site.URL)
+	schedule := func() (common.JobId, []string, int) {
+		rsp, err := http.Post(serviceURL+"/", "application/json", strings.NewReader(body))
+		require.Nil(t, err, "Expect no schedule error")
+		defer rsp.Body.Close()
+		scheduled := struct {
+			JobId  common.JobId `json:"jobId"`
+			URLs   []string     `json:"urls"`
+			Errors []struct {
+				Line int `json:"line"`
+			} `json:"errors"`
+		}{}
+		require.Nil(t, json.NewDecoder(rsp.Body).Decode(&scheduled), "Expect schedule response")
+		require.Len(t, scheduled.Errors, 1, "Expect invalid URL error")
+		return scheduled.JobId, scheduled.URLs, scheduled.Errors[0].Line
+	}
+
+	jobId, urls, line := schedule()
+	assert.Equal(t, []string{site.URL}, urls, "Expect normalized URLs")
+	assert.Equal(t, 2, line, "Expect line of invalid URL")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := sc.JobClient().GetJob(jobId)
+		require.Nil(t, err, "Expect no error getting job")
+		if job.Status().Pending == 0 {
+			assert.Equal(t, []string{"nightly"}, job.Tags, "Expect job tags")
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for job to complete")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	result, err := sc.JobClient().Result(jobId, storage.ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.ElementsMatch(t, []string{site.URL + "/about", site.URL + "/logo.png"}, result[site.URL], "Expect origin's descendants")
+	assert.Len(t, result[site.URL+"/about"], 0, "Expect URL's max depth not crawled")
+
+	again, _, _ := schedule()
+	assert.Equal(t, jobId, again, "Expect same job for idempotency key")
+
+	rsp, err := http.Post(serviceURL+"/", "application/xml", strings.NewReader("<urls/>"))
+	require.Nil(t, err, "Expect no schedule error")
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusUnsupportedMediaType, rsp.StatusCode, "Expect unsupported Content-Type rejected")
+}
+
+// Cancelled jobs keep their counts, and their remaining URLs are never
+// requested.
+func TestAllInOneCancelJob(t *testing.T) {
+	var (
+		aboutRequested int32
+		teamRequested  int32
+		release        = make(chan struct{})
+	)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/about">about</a>`)
+		case "/about":
+			atomic.StoreInt32(&aboutRequested, 1)
+			<-release
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/team">team</a>`)
+		case "/team":
+			atomic.StoreInt32(&teamRequested, 1)
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_cancel_job")
+	defer closeService()
+	defer sc.Close()
+
+	rsp, err := http.Post(serviceURL+"/?forceCrawl", "text/plain", strings.NewReader(site.URL+"\n"))
+	require.Nil(t, err, "Expect no schedule error")
+	scheduled := struct {
+		JobId common.JobId `json:"jobId"`
+	}{}
+	require.Nil(t, json.NewDecoder(rsp.Body).Decode(&scheduled), "Expect job id")
+	rsp.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&aboutRequested) == 0 {
+		if time.Now().After(deadline) {
+			close(release)
+			t.Fatal("Timed out waiting for crawl to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel := func(method, u string) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, u, nil)
+		require.Nil(t, err, "Expect no request error")
+		rsp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err, "Expect no cancel error")
+		defer rsp.Body.Close()
+		msg := map[string]interface{}{}
+		require.Nil(t, json.NewDecoder(rsp.Body).Decode(&msg), "Expect cancel response")
+		return rsp.StatusCode, msg
+	}
+
+	status, msg := cancel("DELETE", fmt.Sprintf("%s/job/%d", serviceURL, scheduled.JobId))
+	close(release)
+	assert.Equal(t, http.StatusOK, status, "Expect job cancelled")
+	assert.Equal(t, common.JobStateCancelled, msg["state"], "Expect cancelled state")
+	assert.EqualValues(t, 1, msg["pending"], "Expect pending job URL")
+
+	job, err := sc.JobClient().GetJob(scheduled.JobId)
+	require.Nil(t, err, "Expect no error getting job")
+	originId := job.URLs[0].URLId
+	for {
+		pending, err := sc.URLClient().HasPending(scheduled.JobId, originId)
+		require.Nil(t, err, "Expect no error checking pending")
+		if !pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for pending URLs to be dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.EqualValues(t, 0, atomic.LoadInt32(&teamRequested), "Expect cancelled job's URLs not requested")
+
+	status, msg = cancel("POST", fmt.Sprintf("%s/job/%d/cancel", serviceURL, scheduled.JobId))
+	assert.Equal(t, http.StatusOK, status, "Expect job already cancelled")
+	assert.Equal(t, common.JobStateCancelled, msg["state"], "Expect cancelled state")
+
+	job, err = sc.JobClient().GetJob(scheduled.JobId)
+	require.Nil(t, err, "Expect no error getting job")
+	assert.Equal(t, common.JobStateCancelled, job.Status().State, "Expect job stays cancelled")
+	assert.Equal(t, 1, job.Status().Pending, "Expect job URL not completed")
+
+	status, _ = cancel("DELETE", fmt.Sprintf("%s/job/%d", serviceURL, scheduled.JobId+100))
+	assert.Equal(t, http.StatusNotFound, status, "Expect unknown job not found")
+
+	completed := scheduleJob(t, sc, serviceURL, site.URL+"/team")
+	status, _ = cancel("DELETE", fmt.Sprintf("%s/job/%d", serviceURL, completed))
+	assert.Equal(t, http.StatusConflict, status, "Expect completed job not cancelled")
+}
+
+// Paused jobs park their queued URLs, and crawl them once resumed.
+func TestAllInOnePauseJob(t *testing.T) {
+	var (
+		aboutRequested int32
+		teamRequested  int32
+		release        = make(chan struct{})
+	)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/about">about</a>`)
+		case "/about":
+			atomic.StoreInt32(&aboutRequested, 1)
+			<-release
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/team">team</a>`)
+		case "/team":
+			atomic.StoreInt32(&teamRequested, 1)
+			w.Header().Set("Content-Type", "text/html")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_pause_job")
+	defer closeService()
+	defer sc.Close()
+
+	rsp, err := http.Post(serviceURL+"/?forceCrawl", "text/plain", strings.NewReader(site.URL+"\n"))
+	require.Nil(t, err, "Expect no schedule error")
+	scheduled := struct {
+		JobId common.JobId `json:"jobId"`
+	}{}
+	require.Nil(t, json.NewDecoder(rsp.Body).Decode(&scheduled), "Expect job id")
+	rsp.Body.Close()
+
+	waitFor := func(msg string, done func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for", msg)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	control := func(action string) (int, map[string]interface{}) {
+		rsp, err := http.Post(fmt.Sprintf("%s/job/%d/%s", serviceURL, scheduled.JobId, action), "text/plain", nil)
+		require.Nil(t, err, "Expect no %s error", action)
+		defer rsp.Body.Close()
+		msg := map[string]interface{}{}
+		require.Nil(t, json.NewDecoder(rsp.Body).Decode(&msg), "Expect %s response", action)
+		return rsp.StatusCode, msg
+	}
+	parked := func() int {
+		job, err := sc.JobClient().GetJob(scheduled.JobId)
+		require.Nil(t, err, "Expect no error getting job")
+		return job.Status().Parked
+	}
+
+	waitFor("crawl to start", func() bool { return atomic.LoadInt32(&aboutRequested) != 0 })
+	status, msg := control("pause")
+	close(release)
+	assert.Equal(t, http.StatusOK, status, "Expect job paused")
+	assert.Equal(t, common.JobStatePaused, msg["state"], "Expect paused state")
+
+	waitFor("item to be parked", func() bool { return parked() > 0 })
+	assert.EqualValues(t, 0, atomic.LoadInt32(&teamRequested), "Expect paused job's URLs not requested")
+	job, err := sc.JobClient().GetJob(scheduled.JobId)
+	require.Nil(t, err, "Expect no error getting job")
+	assert.Equal(t, common.JobStatePaused, job.Status().State, "Expect job stays paused")
+
+	status, msg = control("resume")
+	assert.Equal(t, http.StatusOK, status, "Expect job resumed")
+	assert.NotEqual(t, common.JobStatePaused, msg["state"], "Expect job not paused")
+
+	waitFor("job to complete", func() bool {
+		job, err := sc.JobClient().GetJob(scheduled.JobId)
+		require.Nil(t, err, "Expect no error getting job")
+		return job.Status().State == common.JobStateCompleted
+	})
+	assert.EqualValues(t, 1, atomic.LoadInt32(&teamRequested), "Expect parked URLs crawled once resumed")
+	assert.Equal(t, 0, parked(), "Expect no parked URLs")
+
+	status, _ = control("pause")
+	assert.Equal(t, http.StatusConflict, status, "Expect completed job not paused")
+}
+
+// Event read from a job status stream.
+type streamEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// Reads the events of a job status stream until the stream ends.
+func readStream(t *testing.T, rsp *http.Response) []streamEvent {
+	events := []streamEvent{}
+	scanner := bufio.NewScanner(rsp.Body)
+	var ev streamEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			ev.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.Nil(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.data), "Expect event data")
+		case line == "" && ev.name != "":
+			events = append(events, ev)
+			ev = streamEvent{}
+		}
+	}
+	require.Nil(t, scanner.Err(), "Expect no stream error")
+	return events
+}
+
+// The job's progress is streamed as it is crawled, and the stream ends once
+// the job is completed.
+func TestAllInOneStreamJob(t *testing.T) {
+	release := make(chan struct{})
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			<-release
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/about">about</a>`)
+		case "/about":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/team">team</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_stream_job")
+	defer closeService()
+	defer sc.Close()
+
+	rsp, err := http.Post(serviceURL+"/?forceCrawl", "text/plain", strings.NewReader(site.URL+"\n"))
+	require.Nil(t, err, "Expect no schedule error")
+	scheduled := struct {
+		JobId common.JobId `json:"jobId"`
+	}{}
+	require.Nil(t, json.NewDecoder(rsp.Body).Decode(&scheduled), "Expect job id")
+	rsp.Body.Close()
+
+	streamURL := fmt.Sprintf("%s/status/%d/stream", serviceURL, scheduled.JobId)
+	rsp, err = http.Get(streamURL)
+	close(release)
+	require.Nil(t, err, "Expect no stream error")
+	defer rsp.Body.Close()
+	require.Equal(t, http.StatusOK, rsp.StatusCode, "Expect stream")
+	assert.Equal(t, "text/event-stream", rsp.Header.Get("Content-Type"), "Expect event stream")
+
+	events := readStream(t, rsp)
+	require.True(t, len(events) > 2, "Expect status and progress events, %v", events)
+	assert.Equal(t, "status", events[0].name, "Expect status first")
+	assert.Equal(t, common.JobStateRunning, events[0].data["state"], "Expect job running")
+	last := events[len(events)-1]
+	assert.Equal(t, "status", last.name, "Expect status last")
+	assert.Equal(t, common.JobStateCompleted, last.data["state"], "Expect job completed")
+
+	crawled := []interface{}{}
+	results := []interface{}{}
+	originComplete := false
+	for _, ev := range events {
+		switch ev.name {
+		case common.ProgressCrawled:
+			crawled = append(crawled, ev.data["url"])
+		case common.ProgressResult:
+			results = append(results, ev.data["url"])
+		case common.ProgressOriginComplete:
+			originComplete = true
+		}
+	}
+	assert.Contains(t, crawled, site.URL, "Expect origin crawled")
+	assert.Contains(t, crawled, site.URL+"/about", "Expect descendant crawled")
+	assert.ElementsMatch(t, []interface{}{site.URL + "/about", site.URL + "/team"}, results, "Expect each result once")
+	assert.True(t, originComplete, "Expect origin completed")
+
+	// Streams of completed jobs only include the job's status.
+	rsp, err = http.Get(streamURL)
+	require.Nil(t, err, "Expect no stream error")
+	defer rsp.Body.Close()
+	events = readStream(t, rsp)
+	require.Len(t, events, 1, "Expect only status")
+	assert.Equal(t, common.JobStateCompleted, events[0].data["state"], "Expect job completed")
+
+	rsp, err = http.Get(fmt.Sprintf("%s/status/%d/stream", serviceURL, scheduled.JobId+100))
+	require.Nil(t, err, "Expect no stream error")
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, rsp.StatusCode, "Expect unknown job not found")
+}
+
+// Jobs with a callback URL are called back once they are completed, and the
+// callback's delivery is listed by the API.
+func TestAllInOneJobCallback(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	delivered := make(chan []byte, 1)
+	var signature string
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(notifier.SignatureHeader)
+		delivered <- body
+	}))
+	defer callback.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_job_callback")
+	defer closeService()
+	defer sc.Close()
+
+	body := fmt.Sprintf(`{"urls": [%q], "callbackURL": %q}`, site.URL, callback.URL)
+	rsp, err := http.Post(serviceURL+"/", "application/json", strings.NewReader(body))
+	jobId := waitForJob(t, sc, rsp, err)
+
+	var payload []byte
+	select {
+	case payload = <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for callback")
+	}
+	assert.Equal(t, notifier.Sign("test_secret", payload), signature, "Expect signed callback")
+
+	msg := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal(payload, &msg), "Expect JSON summary")
+	assert.Equal(t, common.CallbackEventCompleted, msg["event"], "Expect completed event")
+	assert.EqualValues(t, jobId, msg["jobId"], "Expect job id")
+
+	// The attempt is recorded after the response is read.
+	var cbs []map[string]interface{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rsp, err := http.Get(fmt.Sprintf("%s/callbacks/%d", serviceURL, jobId))
+		require.Nil(t, err, "Expect no callbacks error")
+		cbs = nil
+		require.Nil(t, json.NewDecoder(rsp.Body).Decode(&cbs), "Expect callbacks")
+		rsp.Body.Close()
+		if len(cbs) == 1 && cbs[0]["state"] == common.CallbackStateDelivered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for callback to be recorded", cbs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, callback.URL, cbs[0]["url"], "Expect callback URL")
+	assert.Len(t, cbs[0]["attemptLog"], 1, "Expect attempt listed")
+}
+
+// The job's results can be requested a page at a time following the cursor,
+// or streamed as newline delimited JSON.
+func TestAllInOnePagedResults(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_paged_results")
+	defer closeService()
+	defer sc.Close()
+
+	jobId := scheduleJob(t, sc, serviceURL, site.URL)
+	resultURL := fmt.Sprintf("%s/result/%d", serviceURL, jobId)
+
+	type result struct {
+		Cursor int64  `json:"cursor"`
+		URL    string `json:"url"`
+	}
+	urls := []string{}
+	cursor := int64(0)
+	for pages := 0; ; pages++ {
+		require.True(t, pages < 3, "Expect results in two pages")
+
+		rsp, err := http.Get(fmt.Sprintf("%s?limit=2&cursor=%d", resultURL, cursor))
+		require.Nil(t, err, "Expect no result error")
+		page := struct {
+			Results []result `json:"results"`
+			Cursor  int64    `json:"cursor"`
+			More    bool     `json:"more"`
+		}{}
+		require.Nil(t, json.NewDecoder(rsp.Body).Decode(&page), "Expect result page")
+		rsp.Body.Close()
+
+		assert.True(t, len(page.Results) <= 2, "Expect page limited")
+		for _, r := range page.Results {
+			urls = append(urls, r.URL)
+		}
+		cursor = page.Cursor
+		if !page.More {
+			break
+		}
+	}
+	assert.ElementsMatch(t, []string{site.URL + "/about", site.URL + "/logo.png", site.URL + "/", site.URL + "/team"}, urls, "Expect all results")
+
+	stream := func(query string) []result {
+		rsp, err := http.Get(resultURL + "?" + query)
+		require.Nil(t, err, "Expect no stream error")
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusOK, rsp.StatusCode, "Expect stream")
+		assert.Equal(t, "application/x-ndjson", rsp.Header.Get("Content-Type"), "Expect NDJSON")
+
+		results := []result{}
+		scanner := bufio.NewScanner(rsp.Body)
+		for scanner.Scan() {
+			var r result
+			require.Nil(t, json.Unmarshal(scanner.Bytes(), &r), "Expect JSON result line")
+			results = append(results, r)
+		}
+		require.Nil(t, scanner.Err(), "Expect no stream error")
+		return results
+	}
+
+	streamed := stream("stream=true")
+	require.Len(t, streamed, 4, "Expect all results streamed")
+	assert.Len(t, stream(fmt.Sprintf("stream=true&since=%d", streamed[1].Cursor)), 2, "Expect results since cursor")
+	assert.Len(t, stream(fmt.Sprintf("stream=true&since=%d", streamed[3].Cursor)), 0, "Expect no new results")
+	assert.Len(t, stream("stream=true&limit=3"), 3, "Expect stream limited")
+
+	filtered := func(query string) []string {
+		urls := []string{}
+		for _, r := range stream("stream=true&" + query) {
+			urls = append(urls, r.URL)
+		}
+		return urls
+	}
+	assert.ElementsMatch(t, []string{site.URL + "/", site.URL + "/team"}, filtered("level=2"), "Expect results found on linked pages")
+	assert.ElementsMatch(t, []string{site.URL + "/logo.png", site.URL + "/team"}, filtered("status=4xx"), "Expect broken results")
+	assert.ElementsMatch(t, []string{site.URL + "/team"}, filtered("status=4xx&refer="+url.QueryEscape(site.URL+"/about")), "Expect broken results of refer")
+
+	rsp, err := http.Get(fmt.Sprintf("%s/result/%d?stream=true", serviceURL, jobId+100))
+	require.Nil(t, err, "Expect no result error")
+	rsp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, rsp.StatusCode, "Expect unknown job not found")
+}
+
+// The job's results can be exported as CSV, and its link graph as GraphML
+// or DOT, selected by the format parameter or the Accept header.
+func TestAllInOneExportResults(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_export_results")
+	defer closeService()
+	defer sc.Close()
+
+	jobId := scheduleJob(t, sc, serviceURL, site.URL)
+	resultURL := fmt.Sprintf("%s/result/%d", serviceURL, jobId)
+
+	export := func(query, accept, contentType string) string {
+		req, err := http.NewRequest("GET", resultURL+"?"+query, nil)
+		require.Nil(t, err, "Expect no request error")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err, "Expect no export error")
+		defer rsp.Body.Close()
+		require.Equal(t, http.StatusOK, rsp.StatusCode, "Expect export")
+		assert.Equal(t, contentType, rsp.Header.Get("Content-Type"), "Expect export content type")
+
+		body, err := ioutil.ReadAll(rsp.Body)
+		require.Nil(t, err, "Expect no read error")
+		return string(body)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(export("format=csv", "", "text/csv"))).ReadAll()
+	require.Nil(t, err, "Expect valid CSV")
+	require.Len(t, rows, 5, "Expect header and all results")
+	assert.Equal(t, []string{"refer", "url", "mime", "status"}, rows[0], "Expect header")
+	assert.Contains(t, rows, []string{site.URL, site.URL + "/about", "text/html", "200"}, "Expect crawled result")
+	assert.Contains(t, rows, []string{site.URL + "/about", site.URL + "/team", "text/plain", "404"}, "Expect missing result")
+
+	graph := export("", "application/graphml+xml", "application/graphml+xml")
+	assert.Equal(t, 4, strings.Count(graph, "<edge "), "Expect an edge for each result")
+	assert.Equal(t, 5, strings.Count(graph, "<node "), "Expect a node for each URL")
+
+	dot := export("format=dot&mime=text/html", "", "text/vnd.graphviz")
+	assert.Equal(t, fmt.Sprintf("digraph \"job_%d\" {\n  %q -> %q;\n  %q -> %q;\n}\n", jobId,
+		site.URL, site.URL+"/about", site.URL+"/about", site.URL+"/"), dot, "Expect links to pages")
+}
+
+// The link graph of the crawled URLs can be queried for a URL's inbound and
+// outbound links, the pages using an asset, and the path between URLs.
+func TestAllInOneLinkGraph(t *testing.T) {
+	site := httptest.NewServer(testSiteHandler(""))
+	defer site.Close()
+
+	sc, serviceURL, closeService := startService(t, "test_link_graph")
+	defer closeService()
+	defer sc.Close()
+
+	scheduleJob(t, sc, serviceURL, site.URL)
+
+	type linkURL struct {
+		URL string `json:"url"`
+	}
+	get := func(query string, params url.Values, status int, msg interface{}) {
+		rsp, err := http.Get(serviceURL + "/links/" + query + "?" + params.Encode())
+		require.Nil(t, err, "Expect no links error")
+		defer rsp.Body.Close()
+		require.Equal(t, status, rsp.StatusCode, "Expect %s status", query)
+		if msg != nil {
+			require.Nil(t, json.NewDecoder(rsp.Body).Decode(msg), "Expect %s links", query)
+		}
+	}
+	urlsOf := func(links []linkURL) []string {
+		urls := []string{}
+		for _, l := range links {
+			urls = append(urls, l.URL)
+		}
+		return urls
+	}
+
+	links := struct {
+		URL   string    `json:"url"`
+		Links []linkURL `json:"links"`
+	}{}
+	get("inbound", url.Values{"url": {site.URL + "/about"}}, http.StatusOK, &links)
+	assert.Equal(t, []string{site.URL}, urlsOf(links.Links), "Expect inbound links")
+
+	get("outbound", url.Values{"url": {site.URL + "/about"}}, http.StatusOK, &links)
+	assert.ElementsMatch(t, []string{site.URL + "/", site.URL + "/team"}, urlsOf(links.Links), "Expect outbound links")
+
+	get("assets", url.Values{"url": {site.URL + "/logo.png"}}, http.StatusOK, &links)
+	assert.Equal(t, []string{site.URL}, urlsOf(links.Links), "Expect pages using the asset")
+
+	path := struct {
+		Links int       `json:"links"`
+		Path  []linkURL `json:"path"`
+	}{}
+	get("path", url.Values{"from": {site.URL}, "to": {site.URL + "/team"}}, http.StatusOK, &path)
+	assert.Equal(t, 2, path.Links, "Expect path length")
+	assert.Equal(t, []string{site.URL, site.URL + "/about", site.URL + "/team"}, urlsOf(path.Path), "Expect path")
+
+	get("path", url.Values{"from": {site.URL + "/team"}, "to": {site.URL}}, http.StatusNotFound, nil)
+	get("path", url.Values{"from": {site.URL}}, http.StatusBadRequest, nil)
+	get("inbound", url.Values{"url": {site.URL + "/unknown"}}, http.StatusNotFound, nil)
+	get("unknown", url.Values{"url": {site.URL}}, http.StatusNotFound, nil)
+}
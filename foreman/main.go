@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/jasdel/harvester/internal/foreman"
+	"github.com/jasdel/harvester/internal/notifier"
 	"github.com/jasdel/harvester/internal/queue"
 	"github.com/jasdel/harvester/internal/storage"
 	"log"
@@ -28,6 +30,14 @@ import (
 // Once a URL item is filtered, and not cached it will be sent
 // to the Work Queue to be crawled.
 //
+// Publish to Progress Queue:
+// Results added, and job URLs completed from the cache are published
+// so the web server can stream them to clients.
+//
+// The foreman also runs the notifier, which delivers the callbacks of jobs
+// which are done to their callback URLs. Multiple foremen can run the notifier
+// at once, since each callback is claimed in storage before it is delivered.
+//
 func main() {
 	// Configuration file containing all basic configuration for a server instance to run
 	cfgFilename := flag.String("config", "config.json", "The foreman configuration file.")
@@ -62,6 +72,14 @@ func main() {
 	}
 	defer workQueuePub.Close()
 
+	// Initialize the publisher for the progress of the jobs' URLs
+	// processed from the cache.
+	progressPub, err := queue.NewProgressPublisher(cfg.ProgressQueueConfig)
+	if err != nil {
+		log.Fatalln("Progress Publisher initialization failed", err)
+	}
+	defer progressPub.Close()
+
 	// Initialize the storage so the known and previously crawled state of URLs
 	// can be determined.
 	sc, err := storage.NewClient(cfg.StorageConfig)
@@ -70,12 +88,20 @@ func main() {
 	}
 	defer sc.Close()
 
-	foreman := NewForeman(workQueuePub, urlQueuePub, sc, cfg.MaxLevel, cfg.CacheMaxAge)
+	f := foreman.NewForeman(workQueuePub, urlQueuePub, progressPub, sc, cfg.CacheMaxAge)
+
+	// Deliver the callbacks of jobs which are done.
+	notifier.New(sc, notifier.Config{
+		Secret:       cfg.CallbackSecret,
+		MaxAttempts:  cfg.CallbackMaxAttempts,
+		RetryDelay:   cfg.CallbackRetryDelay,
+		PollInterval: cfg.CallbackPollInterval,
+	}).Start()
 
 	log.Println("Ready: Waiting for URL queue items...")
 	for {
 		item := <-urlQueueRecv.Receive()
-		foreman.ProcessQueueItem(item)
+		f.ProcessQueueItem(item)
 	}
 }
 
@@ -92,8 +118,9 @@ type Config struct {
 	// Queue for sending URI items from  the foreman's to workers
 	WorkQueueConfig queue.QueueConfig `json:"workQueue"`
 
-	// the maximum level the crawling should be allowed to travel
-	MaxLevel int `json:"maxLevel"`
+	// Topic to publish the progress of the jobs' URLs to. If no connection
+	// URL is set the progress is not published.
+	ProgressQueueConfig queue.QueueConfig `json:"progressQueue"`
 
 	// Maximum age a URL can be cached for before it is allowed to
 	// e.g: 1m23s for 1 minute and 23 seconds
@@ -103,6 +130,27 @@ type Config struct {
 	// The CacheMaxAgeStr will be parsed, and its value placed into the CacheMaxAge field.
 	// Used to determine maximum age to cache a URL for before it is crawled again.
 	CacheMaxAge time.Duration `json:"-"`
+
+	// Secret the bodies of job callbacks are signed with. If not set the
+	// callbacks are not signed.
+	CallbackSecret string `json:"callbackSecret"`
+
+	// Maximum number of times a job callback is attempted to be delivered.
+	CallbackMaxAttempts int `json:"callbackMaxAttempts"`
+
+	// Duration before the first retry of a job callback which failed to be
+	// delivered. time.Duration string formated value.
+	CallbackRetryDelayStr string `json:"callbackRetryDelay"`
+
+	// The CallbackRetryDelayStr will be parsed, and its value placed into the CallbackRetryDelay field.
+	CallbackRetryDelay time.Duration `json:"-"`
+
+	// Interval storage is polled at for job callbacks to deliver.
+	// time.Duration string formated value.
+	CallbackPollIntervalStr string `json:"callbackPollInterval"`
+
+	// The CallbackPollIntervalStr will be parsed, and its value placed into the CallbackPollInterval field.
+	CallbackPollInterval time.Duration `json:"-"`
 }
 
 // Loads the configuration file from disk in as a JSON blob.
@@ -128,5 +176,29 @@ func LoadConfig(filename string) (Config, error) {
 		}
 	}
 
+	if cfg.CallbackRetryDelay, err = parseDuration(cfg.CallbackRetryDelayStr); err != nil {
+		return cfg, err
+	}
+	if cfg.CallbackPollInterval, err = parseDuration(cfg.CallbackPollIntervalStr); err != nil {
+		return cfg, err
+	}
+
 	return cfg, nil
 }
+
+// Parses a time.Duration string formated value. An empty string is a
+// zero duration. Negative durations are not valid.
+func parseDuration(str string) (time.Duration, error) {
+	if str == "" {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return 0, fmt.Errorf("%s, %s", err.Error(), str)
+	} else if d < 0 {
+		return 0, fmt.Errorf("Invalid duration %s, must be positive", str)
+	}
+
+	return d, nil
+}
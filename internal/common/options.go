@@ -0,0 +1,189 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Default maximum distance from a job's origin URLs its descendants are
+// crawled to.
+const DefaultMaxDepth = 2
+
+// Options of how a job is crawled. The options are stored with the job,
+// and read by the foreman and workers for each of the job's queued items.
+type JobOptions struct {
+	// Maximum distance from the origin URLs descendants are crawled to.
+	// Descendants at the max depth are checked and included in the
+	// results, but not crawled. If not set DefaultMaxDepth will be used.
+	MaxDepth int `json:"maxDepth,omitempty"`
+
+	// Maximum number of pages crawled by the job. Once reached the job's
+	// remaining URLs are included in the results, but are not requested.
+	// Zero is unlimited.
+	MaxPages int `json:"maxPages,omitempty"`
+
+	// Maximum number of content bytes downloaded by the job. Once reached
+	// the job's remaining URLs are included in the results, but are not
+	// requested. Zero is unlimited.
+	MaxBytes int64 `json:"maxBytes,omitempty"`
+
+	// Maximum age of a crawled URL's cache before it is crawled again.
+	// If not set the foreman's cache max age will be used.
+	CacheMaxAge time.Duration `json:"-"`
+
+	// Mime types of the URLs the job crawls, e.g: text/html. A trailing
+	// '*' matches any subtype, e.g: image/*. URLs of other mime types are
+	// included in the results, but are not requested, or scraped. If not
+	// set all mime types are allowed.
+	AllowedMimes []string `json:"allowedMimes,omitempty"`
+
+	// Crawl URLs regardless if they have already been crawled, ignoring
+	// the cache. Does not apply to skipped mime types.
+	ForceCrawl bool `json:"forceCrawl,omitempty"`
+
+	// Crawl stylesheets, and the inline styles of HTML documents, for the
+	// URLs of url() values, and @import rules.
+	ScrapeCSS bool `json:"scrapeCSS,omitempty"`
+
+	// Crawl javascript, and the inline scripts of HTML documents, for
+	// things which look like URLs.
+	ScrapeJS bool `json:"scrapeJS,omitempty"`
+
+	// Discover the sitemaps of each origin's site when the origin is
+	// crawled, and queue the URLs they list as descendants of the origin.
+	Sitemaps bool `json:"sitemaps,omitempty"`
+
+	// Rules limiting which descendants of the origins are crawled.
+	Scope ScopeRules `json:"scope"`
+}
+
+// Rules limiting which descendant URLs of a job's origins are crawled. URLs
+// which are out of scope are included in the results, but are not queued.
+// All rules which are set must be satisfied for a URL to be in scope.
+type ScopeRules struct {
+	// Only URLs on the same host as their origin are in scope.
+	SameHost bool `json:"sameHost,omitempty"`
+
+	// Only URLs on the same registrable domain as their origin are in
+	// scope, e.g: www.example.com and blog.example.com.
+	SameDomain bool `json:"sameDomain,omitempty"`
+
+	// Only URLs whose path starts with the prefix are in scope, e.g: /docs/
+	PathPrefix string `json:"pathPrefix,omitempty"`
+
+	// Regular expressions of URLs which are in scope. If set a URL must
+	// match at least one of them.
+	Include []string `json:"include,omitempty"`
+
+	// Regular expressions of URLs which are out of scope.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Returns if no rules are set, and all URLs are in scope.
+func (r *ScopeRules) IsEmpty() bool {
+	return !r.SameHost && !r.SameDomain && r.PathPrefix == "" &&
+		len(r.Include) == 0 && len(r.Exclude) == 0
+}
+
+// JSON form of the job options. The cache max age is represented as a
+// duration string, e.g: 24h, as described by time.ParseDuration.
+type jobOptionsJSON struct {
+	jobOptionsAlias
+	CacheMaxAge string `json:"cacheMaxAge,omitempty"`
+}
+
+// Alias of the job options without its JSON methods.
+type jobOptionsAlias JobOptions
+
+// Satisfies the json.Marshaler interface
+func (o JobOptions) MarshalJSON() ([]byte, error) {
+	v := jobOptionsJSON{jobOptionsAlias: jobOptionsAlias(o)}
+	if o.CacheMaxAge != 0 {
+		v.CacheMaxAge = o.CacheMaxAge.String()
+	}
+	return json.Marshal(v)
+}
+
+// Satisfies the json.Unmarshaler interface. Options which are not present
+// in the JSON keep their current value, so options can be decoded on top of
+// another's.
+func (o *JobOptions) UnmarshalJSON(b []byte) error {
+	v := jobOptionsJSON{jobOptionsAlias: jobOptionsAlias(*o)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*o = JobOptions(v.jobOptionsAlias)
+
+	if v.CacheMaxAge != "" {
+		d, err := time.ParseDuration(v.CacheMaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid cacheMaxAge, %v", err)
+		}
+		o.CacheMaxAge = d
+	}
+	return nil
+}
+
+// Validates the options are within their allowed ranges.
+func (o *JobOptions) Validate() error {
+	switch {
+	case o.MaxDepth < 0:
+		return fmt.Errorf("maxDepth must not be negative")
+	case o.MaxPages < 0:
+		return fmt.Errorf("maxPages must not be negative")
+	case o.MaxBytes < 0:
+		return fmt.Errorf("maxBytes must not be negative")
+	case o.CacheMaxAge < 0:
+		return fmt.Errorf("cacheMaxAge must not be negative")
+	}
+
+	for _, expr := range append(append([]string{}, o.Scope.Include...), o.Scope.Exclude...) {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid scope expression %q, %v", expr, err)
+		}
+	}
+	return nil
+}
+
+// Returns the maximum distance from the origin URLs descendants are
+// crawled to.
+func (o *JobOptions) Depth() int {
+	if o.MaxDepth <= 0 {
+		return DefaultMaxDepth
+	}
+	return o.MaxDepth
+}
+
+// Returns if URLs of the mime type are allowed to be crawled by the job.
+// URLs with an unknown mime type are allowed, since their mime type is
+// not known until they are requested.
+func (o *JobOptions) AllowsMime(mime string) bool {
+	if len(o.AllowedMimes) == 0 || mime == "" {
+		return true
+	}
+	for _, allowed := range o.AllowedMimes {
+		if allowed == mime {
+			return true
+		}
+		if strings.HasSuffix(allowed, "*") && strings.HasPrefix(mime, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns if URLs of the mime type can be skipped for the job, and don't
+// need to be crawled. Stylesheets and javascript are only crawled if the
+// options ask for them to be scraped.
+func (o *JobOptions) CanSkipMime(mime string) bool {
+	if o.ScrapeCSS && mime == "text/css" {
+		return false
+	}
+	if o.ScrapeJS && IsJavaScriptMime(mime) {
+		return false
+	}
+	return CanSkipMime(mime)
+}
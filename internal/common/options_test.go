@@ -0,0 +1,51 @@
+package common
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestJobOptionsJSON(t *testing.T) {
+	opts := JobOptions{MaxDepth: 3, CacheMaxAge: 90 * time.Minute, ScrapeCSS: true}
+
+	b, err := json.Marshal(opts)
+	require.Nil(t, err, "Expect no marshal error")
+	assert.JSONEq(t, `{"maxDepth": 3, "cacheMaxAge": "1h30m0s", "scrapeCSS": true, "scope": {}}`, string(b), "Expect cache max age as duration string")
+
+	decoded := JobOptions{}
+	require.Nil(t, json.Unmarshal(b, &decoded), "Expect no unmarshal error")
+	assert.Equal(t, opts, decoded, "Expect options to round trip")
+
+	require.Nil(t, json.Unmarshal([]byte(`{"maxDepth": 1}`), &decoded), "Expect no unmarshal error")
+	assert.Equal(t, JobOptions{MaxDepth: 1, CacheMaxAge: 90 * time.Minute, ScrapeCSS: true}, decoded, "Expect options decoded on top of existing")
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"cacheMaxAge": "soon"}`), &decoded), "Expect invalid duration error")
+}
+
+func TestJobOptionsAllowsMime(t *testing.T) {
+	opts := JobOptions{}
+	assert.True(t, opts.AllowsMime("image/png"), "Expect all mimes allowed")
+
+	opts.AllowedMimes = []string{"text/html", "image/*"}
+	assert.True(t, opts.AllowsMime("text/html"), "Expect exact mime allowed")
+	assert.True(t, opts.AllowsMime("image/png"), "Expect wildcard mime allowed")
+	assert.True(t, opts.AllowsMime(""), "Expect unknown mime allowed")
+	assert.False(t, opts.AllowsMime("text/css"), "Expect other mime not allowed")
+}
+
+func TestJobOptionsDefaults(t *testing.T) {
+	opts := JobOptions{}
+	assert.Equal(t, DefaultMaxDepth, opts.Depth(), "Expect default max depth")
+	assert.True(t, opts.CanSkipMime("text/css"), "Expect stylesheets skipped")
+
+	opts = JobOptions{MaxDepth: 4, ScrapeCSS: true}
+	assert.Equal(t, 4, opts.Depth(), "Expect max depth")
+	assert.False(t, opts.CanSkipMime("text/css"), "Expect stylesheets crawled")
+	assert.Nil(t, opts.Validate(), "Expect options valid")
+
+	opts.MaxPages = -1
+	assert.NotNil(t, opts.Validate(), "Expect negative max pages invalid")
+}
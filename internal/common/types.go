@@ -24,6 +24,90 @@ func (id URLId) String() string {
 // Default mime type URL mimes are initialized to.
 const DefaultURLMime = ``
 
+// Crawl status of a URL which was requested and scraped.
+const CrawlStatusCrawled = "crawled"
+
+// Crawl status of a URL which was requested, but failed to be fetched.
+const CrawlStatusFailed = "failed"
+
+// Crawl status of a URL which was not requested because the site's robots.txt
+// disallows crawling it.
+const CrawlStatusRobotsBlocked = "blocked by robots"
+
+// Kinds of errors a URL can fail to be fetched with.
+const (
+	// The URL's host name could not be resolved.
+	FetchErrorDNS = "dns"
+
+	// The TLS handshake with the URL's host failed, e.g: invalid certificate.
+	FetchErrorTLS = "tls"
+
+	// The request timed out.
+	FetchErrorTimeout = "timeout"
+
+	// The URL's host could not be connected to, or the connection failed.
+	FetchErrorConnection = "connection"
+
+	// The URL could not be requested, e.g: invalid URL.
+	FetchErrorRequest = "request"
+
+	// The site responded with an error status.
+	FetchErrorStatus = "status"
+)
+
+// States of a job.
+const (
+	// The job's URLs are still being crawled.
+	JobStateRunning = "running"
+
+	// All of the job's URLs have been crawled.
+	JobStateCompleted = "completed"
+
+	// The job was paused. Its queued URLs are held until it is resumed.
+	JobStatePaused = "paused"
+
+	// The job was cancelled before all of its URLs were crawled. Its
+	// remaining URLs will not be crawled.
+	JobStateCancelled = "cancelled"
+)
+
+// Kinds of job progress events.
+const (
+	// A URL of the job was crawled, checked, or failed to be fetched.
+	ProgressCrawled = "crawled"
+
+	// A URL was added to the job's results.
+	ProgressResult = "result"
+
+	// All URLs descending from one of the job's origin URLs were processed.
+	ProgressOriginComplete = "originComplete"
+)
+
+// Events a job's callback is made for.
+const (
+	// All of the job's URLs have been crawled.
+	CallbackEventCompleted = "job.completed"
+
+	// All of the job's URLs have been processed, but none of the job's
+	// URLs could be crawled.
+	CallbackEventFailed = "job.failed"
+
+	// The job was cancelled.
+	CallbackEventCancelled = "job.cancelled"
+)
+
+// Delivery states of a job's callback.
+const (
+	// The callback has not been delivered yet, and will be attempted.
+	CallbackStatePending = "pending"
+
+	// The callback was delivered to the job's callback URL.
+	CallbackStateDelivered = "delivered"
+
+	// The callback could not be delivered after all of its attempts.
+	CallbackStateFailed = "failed"
+)
+
 // Invalid job state.  Any job with an id of this should not be processed.
 const InvalidId = -1
 
@@ -34,6 +118,9 @@ type JobStatus struct {
 	// Job unique identifier.
 	Id JobId
 
+	// State of the job, e.g: JobStateRunning.
+	State string
+
 	// Number of completed tasks belonging to this job.
 	Completed int
 
@@ -41,13 +128,20 @@ type JobStatus struct {
 	// are no longer any more tasks to be performed for a job.
 	Pending int
 
-	// Duration the job has been running.  If all tasks are completed
-	// this will reflect the duration the job ran for.
+	// Number of queued URLs held while the job is paused.
+	Parked int
+
+	// Duration the job has been running.  If all tasks are completed,
+	// or the job was cancelled this will reflect the duration the job
+	// ran for.
 	Elapsed time.Duration
 
 	// Mapping of individual URL status.  A true for a URL means that
 	// it has been processed, and only the false, URLs are pending.
 	URLs map[string]bool
+
+	// Tags the job was scheduled with.
+	Tags []string
 }
 
 // Result map for a Job.  The map contains a mapping between refer URL and a list
@@ -72,9 +166,64 @@ type URLQueueItem struct {
 	// The recursive distance this URL is from the Origin URL
 	Level int `json:"level"`
 
-	// Flag instructing the processors craw the URL regardless
-	// if it has already been crawled. The force crawl flag should
-	// be passed down to descendants to ensure they are also crawled.
-	// Note: Does not apply to skipped mime types.
-	ForceCrawl bool `json:"forceCrawl"`
+	// Number of previous attempts to crawl the URL which failed. Zero
+	// for the first attempt. Not passed down to descendants.
+	Attempt int `json:"attempt,omitempty"`
+
+	// Flag instructing the processors to only check the URL can be
+	// fetched, recording the outcome, without scraping its content for
+	// descendants. Used for the leaf URLs of a job's results.
+	CheckOnly bool `json:"checkOnly,omitempty"`
+}
+
+// Creates the queue item for a URL found on this item's URL. The descendant
+// is one level further from the origin.
+func (item *URLQueueItem) Descendant(urlId URLId) *URLQueueItem {
+	return &URLQueueItem{
+		JobId:    item.JobId,
+		OriginId: item.OriginId,
+		ReferId:  item.URLId,
+		URLId:    urlId,
+		Level:    item.Level + 1,
+	}
+}
+
+// Progress of a job, published by the foreman and workers as they process
+// the job's URLs. Progress events are informational, the job's state is
+// always kept in storage.
+type ProgressEvent struct {
+	// Id of job the event is for
+	JobId JobId `json:"jobId"`
+
+	// Kind of event, e.g: ProgressCrawled
+	Type string `json:"type"`
+
+	// Initial Job URL the event's URL descends from
+	OriginId URLId `json:"originId"`
+
+	// The URL which contained a link to the event's URL. Not set for
+	// the job's origin URLs.
+	ReferId URLId `json:"referId,omitempty"`
+
+	// The URL the event is for. For ProgressOriginComplete events this
+	// is the origin URL.
+	URLId URLId `json:"urlId"`
+
+	// The URL the event is for, if known.
+	URL string `json:"url,omitempty"`
+
+	// Crawl status of the URL for ProgressCrawled events, e.g: CrawlStatusCrawled
+	CrawlStatus string `json:"crawlStatus,omitempty"`
+
+	// HTTP status code the URL was fetched with for ProgressCrawled events.
+	StatusCode int `json:"statusCode,omitempty"`
+
+	// Mime type of the URL for ProgressCrawled events.
+	Mime string `json:"mime,omitempty"`
+
+	// Flag stating the URL was only checked, and its content not scraped.
+	CheckOnly bool `json:"checkOnly,omitempty"`
+
+	// Time the event happened at.
+	Time time.Time `json:"time"`
 }
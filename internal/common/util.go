@@ -40,10 +40,29 @@ func GuessURLsMime(u string) string {
 	}
 }
 
+// Returns the lower cased host of the URL, including the port if the URL
+// has one. An empty string is returned if the URL cannot be parsed.
+func URLHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Host)
+}
+
 // Returns if the content of the URL based on mime type
 // can be ignored and doesn't need to be queued for crawling.
 func CanSkipMime(mime string) bool {
 	return strings.HasPrefix(mime, "image") ||
 		mime == "text/css" ||
-		mime == "text/javascript"
+		IsJavaScriptMime(mime)
+}
+
+// Returns if the mime type is one of the types javascript is served as.
+func IsJavaScriptMime(mime string) bool {
+	switch mime {
+	case "text/javascript", "application/javascript", "application/x-javascript", "application/ecmascript":
+		return true
+	}
+	return false
 }
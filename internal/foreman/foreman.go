@@ -0,0 +1,337 @@
+package foreman
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/scope"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"time"
+)
+
+// Provides filtering of the items before they are forwarded on to the worker queue.
+type Foreman struct {
+	// Queue to publish URL items to in order to be crawled.
+	workQueuePub queue.Publisher
+
+	// Queue to publish URL items to who's refer URL had already been crawled.
+	urlQueuePub queue.Publisher
+
+	// Topic the progress of the jobs processed is published to.
+	progressPub queue.ProgressPublisher
+
+	// Storage client, for accessing, and manipulating the storage
+	// For JobClients and URLClients
+	sc *storage.Client
+
+	// Options of the jobs items are queued for
+	jobOptions *storage.JobOptionsCache
+
+	// Scope matchers of the jobs items are queued for
+	scopes *scope.Cache
+
+	// Maximum age a cached URL can be before it can be crawled again. Used
+	// for jobs which do not set their own cache max age.
+	cacheMaxAge time.Duration
+}
+
+// Creates a new instance of the foreman and returns it.  The foreman's methods
+// are safe to be called across multiple go routines. The progress of the jobs
+// processed from the cache is published to progressPub.
+func NewForeman(workQueuePub queue.Publisher, urlQueuePub queue.Publisher, progressPub queue.ProgressPublisher, sc *storage.Client, cacheMaxAge time.Duration) *Foreman {
+	return &Foreman{
+		workQueuePub: workQueuePub,
+		urlQueuePub:  urlQueuePub,
+		progressPub:  progressPub,
+		sc:           sc,
+		jobOptions:   storage.NewJobOptionsCache(sc, 0),
+		scopes:       scope.NewCache(sc, 0),
+		cacheMaxAge:  cacheMaxAge,
+	}
+}
+
+// Determines if a queued item should be filtered out because its already been crawled, or
+// allowed to be sent to the worker queue. If the item was previously crawled it's descendants
+// will be added to the queue if the job's max depth hasn't been reached yet.  If it has, the
+// descendants will be just added to the job result list. Items of mime types the job does
+// not allow are added to the job result list, but are not crawled. Items of cancelled jobs
+// are dropped, and items of paused jobs are parked until the job is resumed.
+func (f *Foreman) ProcessQueueItem(item *common.URLQueueItem) {
+	urlClient := f.sc.URLClient()
+	log.Printf("Foreman: Queue URL: %s, from: %s, origin: %s, level: %d", item.URLId, item.ReferId, item.OriginId, item.Level)
+
+	state, err := f.sc.JobClient().GetState(item.JobId)
+	if err != nil {
+		log.Println("Foreman: Failed to get job state", item.JobId, err)
+		return
+	}
+	switch state {
+	case common.JobStateCancelled:
+		log.Println("Foreman: Dropping item of cancelled job", item.JobId, item.URLId)
+		f.finishItem(item)
+		return
+	case common.JobStatePaused:
+		f.parkItem(item)
+		return
+	}
+
+	opts, err := f.jobOptions.Get(item.JobId, item.OriginId)
+	if err != nil {
+		log.Println("Foreman: Failed to get job options", item.JobId, err)
+		return
+	}
+	cacheMaxAge := f.cacheMaxAge
+	if opts.CacheMaxAge > 0 {
+		cacheMaxAge = opts.CacheMaxAge
+	}
+
+	urlRec, err := urlClient.GetURLById(item.URLId)
+	if err != nil || urlRec == nil {
+		log.Println("Foreman: Failed to get URL", item.URLId, err)
+		return
+	}
+
+	if !opts.AllowsMime(urlRec.Mime) {
+		f.skipItem(item, urlRec)
+		return
+	}
+
+	// Items being retried after failing to be fetched are always sent to the
+	// workers, so they are retried until their attempts are exhausted.
+	retry := item.Attempt > 0
+
+	// URLs which only need to be checked, or are a mime type that can be
+	// skipped for the job, only need to be requested by the worker if they have not
+	// been fetched successfully recently. Their content is never scraped.
+	now := time.Now().UTC()
+	if item.CheckOnly || opts.CanSkipMime(urlRec.Mime) {
+		fetched := !urlRec.Fetch.FetchedOn.IsZero() && urlRec.Fetch.Error == ""
+		if fetched && now.Sub(urlRec.Fetch.FetchedOn) < cacheMaxAge && !opts.ForceCrawl && !retry {
+			f.processFromCache(item, urlRec, opts)
+			return
+		}
+
+		item.CheckOnly = true
+		f.workQueuePub.Send(item)
+		return
+	}
+
+	// If the item URL has already been crawled use the cache instead, unless
+	// a sitemap lists its content as modified since. Origins of jobs which
+	// discover sitemaps are always sent to the workers, since the sitemaps are
+	// discovered when the origin is crawled.
+	fresh := urlRec.Crawled && now.Sub(urlRec.CrawledOn) < cacheMaxAge && !urlRec.LastMod.After(urlRec.CrawledOn)
+	if fresh && !opts.ForceCrawl && !retry && !(opts.Sitemaps && item.Level == 0) {
+		f.processFromCache(item, urlRec, opts)
+		return
+	}
+
+	f.workQueuePub.Send(item)
+}
+
+// If an item is being processed from the cache this will determine if that item's descendants
+// should be added the job results, or queued to be crawled them selves.
+func (f *Foreman) processFromCache(item *common.URLQueueItem, urlRec *storage.URL, opts *common.JobOptions) {
+	log.Println("Foreman: Skipping checking descendants from cache.", item.URLId, item.ReferId, urlRec.Mime)
+
+	// Make sure the Job is cleaned up even in if an error happens.
+	defer f.finishItem(item)
+
+	// Only add items to the result if they are greater than the first layer
+	// because the first layer is the URLs that are used to start a job,
+	// so they do not make sense to be inserted into the results without a refer.
+	if item.Level > 0 {
+		f.addResult(item.JobId, item.OriginId, item.ReferId, item.URLId, urlRec.URL, item.Level)
+	}
+
+	// Descendants of URLs which were only checked are not part of the job.
+	if item.CheckOnly {
+		return
+	}
+
+	if err := f.processDescendants(item, opts); err != nil {
+		log.Println("Foreman: Failed to process known queued item's descendants", item.URLId, err)
+		return
+	}
+}
+
+// Completes an item without crawling it. The item's URL is added to the job
+// results, but its descendants are not.
+func (f *Foreman) skipItem(item *common.URLQueueItem, urlRec *storage.URL) {
+	log.Println("Foreman: Skipping item not allowed by job.", item.URLId, item.ReferId)
+	defer f.finishItem(item)
+
+	if item.Level > 0 {
+		f.addResult(item.JobId, item.OriginId, item.ReferId, item.URLId, urlRec.URL, item.Level)
+	}
+}
+
+// Holds the item of a paused job until the job is resumed. The item's pending
+// record is kept, so the job is not completed while it is paused. If the job
+// was resumed, or cancelled while the item was being parked, the job's parked
+// items are queued again so the item is not left behind.
+func (f *Foreman) parkItem(item *common.URLQueueItem) {
+	log.Println("Foreman: Parking item of paused job", item.JobId, item.URLId)
+
+	parkedClient := f.sc.ParkedClient()
+	if err := parkedClient.Park(item); err != nil {
+		log.Println("Foreman: Failed to park item", item.JobId, item.URLId, err)
+		return
+	}
+
+	if state, err := f.sc.JobClient().GetState(item.JobId); err != nil {
+		log.Println("Foreman: Failed to get job state", item.JobId, err)
+		return
+	} else if state == common.JobStatePaused {
+		return
+	}
+
+	items, err := parkedClient.Take(item.JobId)
+	if err != nil {
+		log.Println("Foreman: Failed to take parked items", item.JobId, err)
+	}
+	for _, parked := range items {
+		f.urlQueuePub.Send(parked)
+	}
+}
+
+// Deletes the pending record of an item which has been processed, and marks
+// the item's Job URL as complete if it no longer has any pending entries.
+func (f *Foreman) finishItem(item *common.URLQueueItem) {
+	urlClient := f.sc.URLClient()
+
+	if err := urlClient.DeletePending(item.JobId, item.URLId, item.OriginId); err != nil {
+		log.Println("Foreman: Failed to delete pending record for", item.URLId, item.OriginId)
+	}
+
+	// If there are no more pending entries for this origin, all jobs which contain that
+	// origin which are not already complete can be marked as complete.
+	if complete, err := urlClient.UpdateJobURLIfComplete(item.JobId, item.OriginId); err != nil {
+		log.Println("Foreman: Failed to update if Job URL is complete", item.OriginId, err)
+	} else if complete {
+		log.Println("Foreman: Marked Job URL as complete", item.JobId, item.OriginId)
+		f.publishProgress(&common.ProgressEvent{
+			JobId:    item.JobId,
+			Type:     common.ProgressOriginComplete,
+			OriginId: item.OriginId,
+			URLId:    item.OriginId,
+		})
+
+		// Once all of the job's URLs are complete its callback can be made.
+		if _, err := f.sc.CallbackClient().AddIfDone(item.JobId); err != nil {
+			log.Println("Foreman: Failed to add job callback", item.JobId, err)
+		}
+	}
+}
+
+// Processes descendants of a URL which is both known and already crawled.
+// The descendants will be either added to the urlQueue if the job's max depth hasn't
+// been reached yet, or will be just added as results to
+func (f *Foreman) processDescendants(item *common.URLQueueItem, opts *common.JobOptions) error {
+	urlClient := f.sc.URLClient()
+
+	// Get all URLs where this item is a refer to, so that they can be queued
+	// for crawling.
+	urlRecs, err := urlClient.GetAllURLsWithReferById(item.URLId)
+	if err != nil {
+		return fmt.Errorf("Failed to get URL descendants of", item.URLId, err)
+	}
+
+	inScope, err := f.scopes.ForItem(item, opts)
+	if err != nil {
+		return fmt.Errorf("Failed to get scope of job %s, %v", item.JobId, err)
+	}
+
+	// Get all URLs where this URL is the refer, and enqueue them. But if the
+	// level would exceed the max, just add the descendants to the results.
+	if item.Level+1 < opts.Depth() {
+		log.Println("enqueue descendants")
+		if err := f.enqueueURLs(item, urlRecs, inScope); err != nil {
+			return fmt.Errorf("Failed to enqueue URLs", err)
+		}
+	} else {
+		log.Println("Adding descendants to results")
+		for _, u := range urlRecs {
+			f.addResult(item.JobId, item.OriginId, item.URLId, u.Id, u.URL, item.Level+1)
+		}
+		if err := f.enqueueChecks(item, urlRecs, inScope); err != nil {
+			return fmt.Errorf("Failed to enqueue URL checks, %v", err)
+		}
+	}
+
+	return nil
+}
+
+// Enqueue a list of URLs with a single refer.  The URLs are added to both the
+// pending Job, and urlQueue. URLs out of the job's scope are added to the job
+// results instead.
+func (f *Foreman) enqueueURLs(refer *common.URLQueueItem, urls []*storage.URL, inScope *scope.Matcher) error {
+	urlClient := f.sc.URLClient()
+
+	for _, u := range urls {
+		if !inScope.InScope(u.URL) {
+			f.addResult(refer.JobId, refer.OriginId, refer.URLId, u.Id, u.URL, refer.Level+1)
+			continue
+		}
+
+		q := refer.Descendant(u.Id)
+		if err := urlClient.AddPending(refer.JobId, u.Id, q.OriginId); err != nil {
+			return err
+		}
+
+		f.urlQueuePub.Send(q)
+	}
+
+	return nil
+}
+
+// Enqueue a list of URLs with a single refer to only be checked, so the outcome
+// of fetching them is known. The URLs are added to both the pending Job, and
+// urlQueue. URLs out of the job's scope are not checked.
+func (f *Foreman) enqueueChecks(refer *common.URLQueueItem, urls []*storage.URL, inScope *scope.Matcher) error {
+	urlClient := f.sc.URLClient()
+
+	for _, u := range urls {
+		if !inScope.InScope(u.URL) {
+			continue
+		}
+
+		q := refer.Descendant(u.Id)
+		q.CheckOnly = true
+		if err := urlClient.AddPending(refer.JobId, u.Id, q.OriginId); err != nil {
+			return err
+		}
+
+		f.urlQueuePub.Send(q)
+	}
+
+	return nil
+}
+
+// Records the URL as a result of the job at the level, and publishes the
+// result to the job's progress. Results the job already has are not published
+// again.
+func (f *Foreman) addResult(jobId common.JobId, originId, referId, urlId common.URLId, u string, level int) {
+	if added, err := f.sc.URLClient().AddResult(jobId, referId, urlId, level); err != nil {
+		log.Println("Foreman: Failed to add result", jobId, referId, urlId, err)
+		return
+	} else if !added {
+		return
+	}
+
+	f.publishProgress(&common.ProgressEvent{
+		JobId:    jobId,
+		Type:     common.ProgressResult,
+		OriginId: originId,
+		ReferId:  referId,
+		URLId:    urlId,
+		URL:      u,
+	})
+}
+
+// Publishes the event to the progress topic, stamped with the current time.
+func (f *Foreman) publishProgress(ev *common.ProgressEvent) {
+	ev.Time = time.Now().UTC()
+	f.progressPub.Send(ev)
+}
@@ -0,0 +1,319 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default number of times a callback is attempted to be delivered before
+// it is given up on.
+const DefaultMaxAttempts = 8
+
+// Default duration before the first retry of a callback which failed to be
+// delivered. The delay doubles with each following attempt.
+const DefaultRetryDelay = 30 * time.Second
+
+// Default interval storage is polled at for callbacks due to be delivered.
+const DefaultPollInterval = 5 * time.Second
+
+// Default duration a callback request can take before it is given up on.
+const DefaultTimeout = 10 * time.Second
+
+// Maximum duration before a callback which failed to be delivered is retried.
+const maxRetryDelay = time.Hour
+
+// Maximum number of due callbacks delivered in a single poll.
+const maxDuePerPoll = 100
+
+// Headers callback requests are made with.
+const (
+	// Event the callback is made for, e.g: job.completed
+	EventHeader = "X-Harvester-Event"
+
+	// Id of the callback, the same for each attempt to deliver it.
+	DeliveryHeader = "X-Harvester-Delivery"
+
+	// HMAC-SHA256 signature of the request body, hex encoded with the
+	// 'sha256=' prefix. Only set if the notifier has a secret.
+	SignatureHeader = "X-Harvester-Signature"
+)
+
+// Configuration of how the notifier delivers callbacks.
+type Config struct {
+	// Secret the callback request bodies are signed with. If not set the
+	// requests are not signed.
+	Secret string
+
+	// Maximum number of times a callback is attempted to be delivered.
+	// If not set DefaultMaxAttempts will be used.
+	MaxAttempts int
+
+	// Duration before the first retry of a callback which failed to be
+	// delivered. The delay doubles with each following attempt. If not
+	// set DefaultRetryDelay will be used.
+	RetryDelay time.Duration
+
+	// Interval storage is polled at for callbacks due to be delivered.
+	// If not set DefaultPollInterval will be used.
+	PollInterval time.Duration
+
+	// Duration a callback request can take before it is given up on.
+	// If not set DefaultTimeout will be used.
+	Timeout time.Duration
+}
+
+// Summary of the job posted to the job's callback URL.
+type callbackMsg struct {
+	// Event the callback is made for, e.g: job.completed
+	Event string `json:"event"`
+
+	// Id of the job
+	JobId common.JobId `json:"jobId"`
+
+	// State of the job, e.g: completed, or cancelled
+	State string `json:"state"`
+
+	// The Number of completely crawled Job URLs
+	Completed int `json:"completed"`
+
+	// The number of Job URLs pending completion.
+	Pending int `json:"pending"`
+
+	// The amount of time that the Job was processing for.
+	Elapsed string `json:"elapsed"`
+
+	// Mapping of individual URL status.
+	URLs map[string]bool `json:"urls"`
+
+	// Tags the job was scheduled with.
+	Tags []string `json:"tags,omitempty"`
+
+	// Number of the job's URLs which failed to be crawled.
+	DeadLetters int `json:"deadLetters"`
+
+	// The time stamp the job was done.
+	DoneOn time.Time `json:"doneOn"`
+
+	// The time stamp the callback was sent.
+	SentOn time.Time `json:"sentOn"`
+}
+
+// Delivers the callbacks of jobs which are done to their callback URL. The
+// callbacks are recorded in storage by the foremen, workers, and web servers
+// as jobs complete or are cancelled. The notifier polls storage for the
+// callbacks which are due, so multiple notifiers can deliver callbacks at
+// once. Each callback is claimed before it is delivered so it is only
+// attempted by a single notifier at a time.
+type Notifier struct {
+	sc     *storage.Client
+	cfg    Config
+	client *http.Client
+
+	// Closed to signal the polling go routine to stop.
+	stop chan struct{}
+
+	// Tracks the polling go routine so Stop can wait for it.
+	wg sync.WaitGroup
+}
+
+// Creates a new instance of the Notifier.
+func New(sc *storage.Client, cfg Config) *Notifier {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return &Notifier{
+		sc:     sc,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		stop:   make(chan struct{}),
+	}
+}
+
+// Starts polling storage for callbacks to deliver. Start should only be
+// called once.
+func (n *Notifier) Start() {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+
+		ticker := time.NewTicker(n.cfg.PollInterval)
+		defer ticker.Stop()
+		for {
+			n.DeliverDue()
+			select {
+			case <-n.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stops polling storage, and blocks until the callback being delivered is
+// finished.
+func (n *Notifier) Stop() {
+	close(n.stop)
+	n.wg.Wait()
+}
+
+// Attempts to deliver the callbacks which are due. Returns the number of
+// callbacks attempted.
+func (n *Notifier) DeliverDue() int {
+	callbackClient := n.sc.CallbackClient()
+
+	cbs, err := callbackClient.Due(maxDuePerPoll)
+	if err != nil {
+		log.Println("notifier: Failed to get due callbacks", err)
+		return 0
+	}
+
+	attempted := 0
+	for _, cb := range cbs {
+		// The lease covers the request, so the callback is not attempted
+		// by another notifier while this one is waiting on a response.
+		if claimed, err := callbackClient.Claim(cb, 2*n.cfg.Timeout); err != nil {
+			log.Println("notifier: Failed to claim callback", cb.Id, cb.JobId, err)
+			continue
+		} else if !claimed {
+			continue
+		}
+
+		n.deliver(cb)
+		attempted++
+	}
+
+	return attempted
+}
+
+// Makes an attempt to deliver the callback, and records the attempt. If the
+// attempt failed, the callback will be retried with backoff until its attempts
+// are exhausted.
+func (n *Notifier) deliver(cb *storage.Callback) {
+	attempt := &storage.CallbackAttempt{AttemptedOn: time.Now().UTC()}
+	attempt.StatusCode, attempt.Error = n.post(cb)
+
+	state, next := common.CallbackStateDelivered, attempt.AttemptedOn
+	if attempt.Error != "" {
+		attempts := cb.Attempts + 1
+		if attempts < n.cfg.MaxAttempts {
+			state, next = common.CallbackStatePending, attempt.AttemptedOn.Add(retryDelay(n.cfg.RetryDelay, cb.Attempts))
+			log.Println("notifier: Retrying callback", cb.Id, "of job", cb.JobId, "at", next, attempt.Error)
+		} else {
+			state = common.CallbackStateFailed
+			log.Println("notifier: Giving up on callback", cb.Id, "of job", cb.JobId, "after", attempts, "attempts", attempt.Error)
+		}
+	} else {
+		log.Println("notifier: Delivered callback", cb.Id, "of job", cb.JobId, cb.Event)
+	}
+
+	if err := n.sc.CallbackClient().RecordAttempt(cb, attempt, state, next); err != nil {
+		log.Println("notifier: Failed to record callback attempt", cb.Id, cb.JobId, err)
+	}
+}
+
+// Posts the job's summary to the callback's URL. Returns the status code of
+// the response, and the error the attempt failed with, if any. Only 2xx
+// responses are successful.
+func (n *Notifier) post(cb *storage.Callback) (int, string) {
+	body, err := n.summary(cb)
+	if err != nil {
+		return 0, err.Error()
+	}
+
+	req, err := http.NewRequest("POST", cb.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err.Error()
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, cb.Event)
+	req.Header.Set(DeliveryHeader, fmt.Sprintf("%d", cb.Id))
+	if n.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.cfg.Secret, body))
+	}
+
+	rsp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, rsp.Body)
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return rsp.StatusCode, fmt.Sprintf("callback responded with status %d", rsp.StatusCode)
+	}
+	return rsp.StatusCode, ""
+}
+
+// Builds the JSON encoded summary of the callback's job.
+func (n *Notifier) summary(cb *storage.Callback) ([]byte, error) {
+	job, err := n.sc.JobClient().GetJob(cb.JobId)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, fmt.Errorf("job %d not found", cb.JobId)
+	}
+	dls, err := n.sc.DeadLetterClient().List(cb.JobId)
+	if err != nil {
+		return nil, err
+	}
+
+	status := job.Status()
+	return json.Marshal(callbackMsg{
+		Event:       cb.Event,
+		JobId:       job.Id,
+		State:       status.State,
+		Completed:   status.Completed,
+		Pending:     status.Pending,
+		Elapsed:     status.Elapsed.String(),
+		URLs:        status.URLs,
+		Tags:        status.Tags,
+		DeadLetters: len(dls),
+		DoneOn:      cb.CreatedOn,
+		SentOn:      time.Now().UTC(),
+	})
+}
+
+// Returns the signature of the body with the secret, as sent in the
+// SignatureHeader. Receivers can compare it with the signature of the body
+// they received to verify the callback was sent by the notifier.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns the delay before the retry following the attempt. The delay
+// doubles with each attempt, up to maxRetryDelay.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
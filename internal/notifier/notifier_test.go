@@ -0,0 +1,116 @@
+package notifier
+
+import (
+	"encoding/json"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Creates a completed job for the URL, which will be called back at the
+// callback URL.
+func createDoneJob(t *testing.T, sc *storage.Client, callbackURL string) *storage.Job {
+	job, _, err := sc.JobClient().CreateJob(storage.JobSpec{
+		URLs:        []storage.JobSpecURL{{URL: "http://example.com"}},
+		Tags:        []string{"nightly"},
+		CallbackURL: callbackURL,
+	})
+	require.Nil(t, err, "Expect no error creating job")
+	require.Nil(t, sc.URLClient().MarkJobURLComplete(job.Id, job.URLs[0].URLId), "Expect no error completing job URL")
+	added, err := sc.CallbackClient().AddIfDone(job.Id)
+	require.Nil(t, err, "Expect no error adding callback")
+	require.True(t, added, "Expect callback added")
+	return job
+}
+
+func TestNotifierDeliver(t *testing.T) {
+	sc, err := storage.NewClient(storage.ClientConfig{Driver: storage.DriverSQLite})
+	require.Nil(t, err, "Expect no storage error")
+	defer sc.Close()
+
+	requests := 0
+	var (
+		body   []byte
+		header http.Header
+	)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer callback.Close()
+
+	job := createDoneJob(t, sc, callback.URL)
+	n := New(sc, Config{Secret: "secret", RetryDelay: time.Millisecond})
+
+	assert.Equal(t, 1, n.DeliverDue(), "Expect callback attempted")
+	cbs, err := sc.CallbackClient().List(job.Id)
+	require.Nil(t, err, "Expect no error listing callbacks")
+	require.Len(t, cbs, 1, "Expect job's callback")
+	assert.Equal(t, common.CallbackStatePending, cbs[0].State, "Expect callback retried")
+	require.Len(t, cbs[0].AttemptLog, 1, "Expect attempt recorded")
+	assert.Equal(t, http.StatusServiceUnavailable, cbs[0].AttemptLog[0].StatusCode, "Expect attempt's status")
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 1, n.DeliverDue(), "Expect callback retried")
+	assert.Equal(t, 0, n.DeliverDue(), "Expect delivered callback not attempted again")
+
+	cbs, err = sc.CallbackClient().List(job.Id)
+	require.Nil(t, err, "Expect no error listing callbacks")
+	assert.Equal(t, common.CallbackStateDelivered, cbs[0].State, "Expect callback delivered")
+	assert.Len(t, cbs[0].AttemptLog, 2, "Expect attempts recorded")
+
+	assert.Equal(t, "application/json", header.Get("Content-Type"), "Expect JSON body")
+	assert.Equal(t, common.CallbackEventCompleted, header.Get(EventHeader), "Expect event header")
+	assert.Equal(t, Sign("secret", body), header.Get(SignatureHeader), "Expect body signed")
+
+	msg := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal(body, &msg), "Expect JSON summary")
+	assert.Equal(t, common.CallbackEventCompleted, msg["event"], "Expect event")
+	assert.EqualValues(t, job.Id, msg["jobId"], "Expect job id")
+	assert.Equal(t, common.JobStateCompleted, msg["state"], "Expect job state")
+	assert.EqualValues(t, 1, msg["completed"], "Expect completed count")
+	assert.Equal(t, []interface{}{"nightly"}, msg["tags"], "Expect job tags")
+}
+
+func TestNotifierGiveUp(t *testing.T) {
+	sc, err := storage.NewClient(storage.ClientConfig{Driver: storage.DriverSQLite})
+	require.Nil(t, err, "Expect no storage error")
+	defer sc.Close()
+
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+	defer callback.Close()
+
+	job := createDoneJob(t, sc, callback.URL)
+	n := New(sc, Config{MaxAttempts: 2, RetryDelay: time.Millisecond})
+
+	n.DeliverDue()
+	time.Sleep(10 * time.Millisecond)
+	n.DeliverDue()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 0, n.DeliverDue(), "Expect failed callback not attempted again")
+
+	cbs, err := sc.CallbackClient().List(job.Id)
+	require.Nil(t, err, "Expect no error listing callbacks")
+	require.Len(t, cbs, 1, "Expect job's callback")
+	assert.Equal(t, common.CallbackStateFailed, cbs[0].State, "Expect callback failed")
+	assert.Len(t, cbs[0].AttemptLog, 2, "Expect all attempts recorded")
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Second, retryDelay(time.Second, 0), "Expect base delay for first retry")
+	assert.Equal(t, 4*time.Second, retryDelay(time.Second, 2), "Expect delay doubled each attempt")
+	assert.Equal(t, maxRetryDelay, retryDelay(time.Minute, 10), "Expect delay capped")
+}
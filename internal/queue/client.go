@@ -3,26 +3,27 @@ package queue
 import (
 	"github.com/apcera/nats"
 	"github.com/jasdel/harvester/internal/common"
+	"net/url"
 )
 
-// Client for communicating with th eNATS message queue. The publishers
+// Client for communicating with the NATS message queue. The publishers
 // will publish to the queue asynchronously.  The receiver will block
 // until a message has been received on the queue.  Receiver endpoints
 // are also configured as Queue Receivers.  Therefore if there are
 // multiple receivers on the same topic only a single one will receive
 // the message. Messages will be received in the order they were sent.
-type client struct {
+type natsClient struct {
 	// Client for communicating with the NATS message queue. Transmission
 	// with the message queue will be pre-(d)encoded. So extra processing
 	// is not needed
 	ec *nats.EncodedConn
 
 	// Sending channel to publish to a queue. Only initialized by
-	// newClient if the sender flag is set.
+	// newNATSClient if the sender flag is set.
 	sendCh chan *common.URLQueueItem
 
 	// Receiving channel to receive from a queue. Only initialized
-	// by newClient if the receiver flag is set.
+	// by newNATSClient if the receiver flag is set.
 	recvCh chan *common.URLQueueItem
 }
 
@@ -49,21 +50,29 @@ type Receiver interface {
 }
 
 // Creates a new Queue Publisher which is only able to send
-// to to topic provided. The Close of a
+// to to topic provided. The backend used is selected by the
+// scheme of the configuration's connection URL.
 func NewPublisher(cfg QueueConfig) (Publisher, error) {
-	return newClient(cfg, true, false)
+	if cfg.isMem() {
+		return newMemClient(cfg), nil
+	}
+	return newNATSClient(cfg, true, false)
 }
 
 // Creates a new Queue Receiver which is only able to receive from
-// the topic provided.
+// the topic provided. The backend used is selected by the scheme
+// of the configuration's connection URL.
 func NewReceiver(cfg QueueConfig) (Receiver, error) {
-	return newClient(cfg, false, true)
+	if cfg.isMem() {
+		return newMemClient(cfg), nil
+	}
+	return newNATSClient(cfg, false, true)
 }
 
-// Creates a new Queue Client. The client can be configured as a sender,
+// Creates a new NATS Queue Client. The client can be configured as a sender,
 // receiver, or both for the topic provided.
-func newClient(cfg QueueConfig, sender, receiver bool) (*client, error) {
-	c := &client{}
+func newNATSClient(cfg QueueConfig, sender, receiver bool) (*natsClient, error) {
+	c := &natsClient{}
 
 	nc, err := nats.Connect(cfg.ConnURL)
 	if err != nil {
@@ -90,21 +99,21 @@ func newClient(cfg QueueConfig, sender, receiver bool) (*client, error) {
 
 // Closes the Queue. No more attempts send or receive should be made
 // once the clients queue connection is closed.
-func (c *client) Close() {
+func (c *natsClient) Close() {
 	c.ec.Close()
 }
 
 // Adds a new URLQueueItem to the queue.  A Single or multiple
 // items can be added at once, and they will be sent to the queue
 // in order.
-func (c *client) Send(items ...*common.URLQueueItem) {
+func (c *natsClient) Send(items ...*common.URLQueueItem) {
 	for i := 0; i < len(items); i++ {
 		c.sendCh <- items[i]
 	}
 }
 
 // Returns a read only channel to send URLQueueItem to
-func (c *client) Receive() <-chan *common.URLQueueItem {
+func (c *natsClient) Receive() <-chan *common.URLQueueItem {
 	return c.recvCh
 }
 
@@ -115,6 +124,16 @@ type QueueConfig struct {
 	// the topic will also be the queue channel.
 	Topic string `json:"topic"`
 
-	// Connection URL to the messaging service.
+	// Connection URL to the messaging service. A URL with the "mem"
+	// scheme, e.g: mem://local, will use the in-process queue instead
+	// of NATS. All clients in the same process using the same mem
+	// URL and topic are connected to each other.
 	ConnURL string `json:"connURL"`
 }
+
+// Returns if the configuration's connection URL is for the in-process
+// memory queue.
+func (cfg QueueConfig) isMem() bool {
+	u, err := url.Parse(cfg.ConnURL)
+	return err == nil && u.Scheme == MemScheme
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"sync"
+)
+
+// URL scheme of a QueueConfig ConnURL which selects the in-process memory
+// queue backend instead of NATS.
+const MemScheme = "mem"
+
+// Registry of all in-process topics, keyed by the connection URL and topic
+// name. Topics are created the first time a client connects to them, and
+// live for the lifetime of the process.
+var memTopics = struct {
+	sync.Mutex
+	topics map[string]*memTopic
+}{topics: make(map[string]*memTopic)}
+
+// In-process topic for passing URLQueueItems between publishers and
+// receivers. Items sent to the topic are buffered without limit so
+// that publishers never block, even if they are also a receiver of
+// the same topic. All receivers share a single delivery channel, so
+// like a NATS queue group only a single receiver will receive each
+// item. Items are delivered in the order they were sent.
+type memTopic struct {
+	// Channel publishers send items in to.
+	in chan *common.URLQueueItem
+
+	// Channel receivers read items from.
+	out chan *common.URLQueueItem
+}
+
+// Returns the topic for the configuration, creating it if it does not
+// already exist.
+func getMemTopic(cfg QueueConfig) *memTopic {
+	memTopics.Lock()
+	defer memTopics.Unlock()
+
+	key := cfg.ConnURL + "/" + cfg.Topic
+	t, ok := memTopics.topics[key]
+	if !ok {
+		t = &memTopic{
+			in:  make(chan *common.URLQueueItem),
+			out: make(chan *common.URLQueueItem),
+		}
+		go t.run()
+		memTopics.topics[key] = t
+	}
+
+	return t
+}
+
+// Moves items from the in channel to the out channel, buffering them
+// until a receiver is ready to take them.
+func (t *memTopic) run() {
+	pending := []*common.URLQueueItem{}
+	for {
+		var out chan *common.URLQueueItem
+		var next *common.URLQueueItem
+		if len(pending) > 0 {
+			out = t.out
+			next = pending[0]
+		}
+
+		select {
+		case item := <-t.in:
+			pending = append(pending, item)
+		case out <- next:
+			pending[0] = nil
+			pending = pending[1:]
+		}
+	}
+}
+
+// Client for communicating with an in-process topic. Provides the same
+// semantics as the NATS client, without the need of a messaging service.
+// Useful for running all services in a single process, and for testing.
+type memClient struct {
+	topic *memTopic
+}
+
+// Creates a new memory Queue Client connected to the topic provided. The
+// client is able to both send and receive on the topic.
+func newMemClient(cfg QueueConfig) *memClient {
+	return &memClient{topic: getMemTopic(cfg)}
+}
+
+// Closes the client. The topic is shared with other clients so it will
+// not be closed. No more attempts to send or receive should be made
+// once the client is closed.
+func (c *memClient) Close() {}
+
+// Adds a new URLQueueItem to the queue. A single or multiple items can
+// be added at once, and they will be sent to the queue in order. The
+// items are copied so the receiver does not share them with the sender.
+func (c *memClient) Send(items ...*common.URLQueueItem) {
+	for i := 0; i < len(items); i++ {
+		item := *items[i]
+		c.topic.in <- &item
+	}
+}
+
+// Returns a read only channel to receive URLQueueItems from
+func (c *memClient) Receive() <-chan *common.URLQueueItem {
+	return c.topic.out
+}
@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemQueueOrder(t *testing.T) {
+	cfg := QueueConfig{ConnURL: "mem://order", Topic: "url_queue"}
+
+	pub, err := NewPublisher(cfg)
+	require.Nil(t, err, "Expect no publisher error")
+	defer pub.Close()
+
+	recv, err := NewReceiver(cfg)
+	require.Nil(t, err, "Expect no receiver error")
+	defer recv.Close()
+
+	// Publisher should not block even though nothing is receiving yet.
+	for i := 0; i < 10; i++ {
+		pub.Send(&common.URLQueueItem{URLId: common.URLId(i)})
+	}
+
+	for i := 0; i < 10; i++ {
+		select {
+		case item := <-recv.Receive():
+			assert.Equal(t, common.URLId(i), item.URLId, "Expect items in order sent")
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for item", i)
+		}
+	}
+}
+
+func TestMemQueueGroup(t *testing.T) {
+	cfg := QueueConfig{ConnURL: "mem://group", Topic: "url_queue"}
+
+	pub, _ := NewPublisher(cfg)
+	defer pub.Close()
+
+	const numItems = 100
+	received := make(map[common.URLId]int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(numItems)
+
+	for i := 0; i < 3; i++ {
+		recv, _ := NewReceiver(cfg)
+		defer recv.Close()
+		go func(r Receiver) {
+			for item := range r.Receive() {
+				mu.Lock()
+				received[item.URLId]++
+				mu.Unlock()
+				wg.Done()
+			}
+		}(recv)
+	}
+
+	for i := 0; i < numItems; i++ {
+		pub.Send(&common.URLQueueItem{URLId: common.URLId(i)})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for items")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, received, numItems, "Expect all items received")
+	for id, n := range received {
+		assert.Equal(t, 1, n, "Expect item %s received only once", id)
+	}
+}
+
+func TestMemQueueTopics(t *testing.T) {
+	pub, _ := NewPublisher(QueueConfig{ConnURL: "mem://topics", Topic: "a"})
+	recvA, _ := NewReceiver(QueueConfig{ConnURL: "mem://topics", Topic: "a"})
+	recvB, _ := NewReceiver(QueueConfig{ConnURL: "mem://topics", Topic: "b"})
+
+	item := &common.URLQueueItem{URLId: 1}
+	pub.Send(item)
+
+	select {
+	case got := <-recvA.Receive():
+		assert.Equal(t, *item, *got, "Expect item to match")
+		assert.False(t, item == got, "Expect item to be copied")
+	case <-recvB.Receive():
+		t.Fatal("Item should not be received on another topic")
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for item")
+	}
+}
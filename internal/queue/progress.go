@@ -0,0 +1,205 @@
+package queue
+
+import (
+	"github.com/apcera/nats"
+	"github.com/jasdel/harvester/internal/common"
+	"sync"
+)
+
+// Number of progress events buffered for each subscriber before events
+// start to be dropped.
+const progressBufferSize = 256
+
+// Interface for publishing to a job progress topic
+type ProgressPublisher interface {
+	// Closes the publisher. No more calls to Send should be made once
+	// Close is called.
+	Close()
+
+	// Sends one or multiple progress events to all of the topic's subscribers.
+	Send(events ...*common.ProgressEvent)
+}
+
+// Interface for subscribing to a job progress topic
+type ProgressSubscriber interface {
+	// Closes the subscriber's Receive channel. The subscriber's close
+	// should be called when finished with the topic or it will leak.
+	Close()
+
+	// Receive channel to receive events from the associated topic
+	Receive() <-chan *common.ProgressEvent
+}
+
+// Creates a new progress Publisher which is only able to send to the topic
+// provided. Unlike the URL queues, every subscriber of a progress topic
+// receives each event. Progress events are informational, so they are
+// dropped instead of blocking the publisher when a subscriber falls behind.
+// If the configuration has no connection URL, events are discarded.
+func NewProgressPublisher(cfg QueueConfig) (ProgressPublisher, error) {
+	if cfg.ConnURL == "" {
+		return nopProgressClient{}, nil
+	}
+	if cfg.isMem() {
+		return getMemProgressTopic(cfg), nil
+	}
+	return newNATSProgressClient(cfg, false)
+}
+
+// Creates a new progress Subscriber which receives all events sent to the
+// topic provided after it subscribed.
+func NewProgressSubscriber(cfg QueueConfig) (ProgressSubscriber, error) {
+	if cfg.isMem() {
+		return getMemProgressTopic(cfg).subscribe(), nil
+	}
+	return newNATSProgressClient(cfg, true)
+}
+
+// Progress publisher which discards all events. Used when no progress
+// topic is configured.
+type nopProgressClient struct{}
+
+func (nopProgressClient) Close()                        {}
+func (nopProgressClient) Send(...*common.ProgressEvent) {}
+
+// Client for publishing and subscribing to a progress topic on NATS. The
+// subscription is not a queue subscription, so all subscribers receive
+// each event.
+type natsProgressClient struct {
+	ec     *nats.EncodedConn
+	sendCh chan *common.ProgressEvent
+	recvCh chan *common.ProgressEvent
+}
+
+// Creates a new NATS progress client. The client will either be a publisher,
+// or subscriber of the topic provided.
+func newNATSProgressClient(cfg QueueConfig, subscriber bool) (*natsProgressClient, error) {
+	nc, err := nats.Connect(cfg.ConnURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &natsProgressClient{}
+	c.ec, err = nats.NewEncodedConn(nc, "json")
+	if err != nil {
+		return nil, err
+	}
+
+	if subscriber {
+		c.recvCh = make(chan *common.ProgressEvent, progressBufferSize)
+		c.ec.BindRecvChan(cfg.Topic, c.recvCh)
+	} else {
+		c.sendCh = make(chan *common.ProgressEvent, progressBufferSize)
+		c.ec.BindSendChan(cfg.Topic, c.sendCh)
+	}
+
+	return c, nil
+}
+
+// Closes the client's connection to the topic.
+func (c *natsProgressClient) Close() {
+	c.ec.Close()
+}
+
+// Sends the events to the topic. Events are dropped if the connection
+// is not able to keep up with them.
+func (c *natsProgressClient) Send(events ...*common.ProgressEvent) {
+	for _, ev := range events {
+		select {
+		case c.sendCh <- ev:
+		default:
+		}
+	}
+}
+
+// Returns a read only channel to receive progress events from
+func (c *natsProgressClient) Receive() <-chan *common.ProgressEvent {
+	return c.recvCh
+}
+
+// Registry of all in-process progress topics, keyed by the connection URL
+// and topic name.
+var memProgressTopics = struct {
+	sync.Mutex
+	topics map[string]*memProgressTopic
+}{topics: make(map[string]*memProgressTopic)}
+
+// In-process progress topic. Each event sent to the topic is delivered to
+// all of the topic's subscribers. The topic is its own publisher.
+type memProgressTopic struct {
+	mu   sync.Mutex
+	subs map[*memProgressSubscriber]struct{}
+}
+
+// Returns the progress topic for the configuration, creating it if it does
+// not already exist.
+func getMemProgressTopic(cfg QueueConfig) *memProgressTopic {
+	memProgressTopics.Lock()
+	defer memProgressTopics.Unlock()
+
+	key := cfg.ConnURL + "/" + cfg.Topic
+	t, ok := memProgressTopics.topics[key]
+	if !ok {
+		t = &memProgressTopic{subs: make(map[*memProgressSubscriber]struct{})}
+		memProgressTopics.topics[key] = t
+	}
+
+	return t
+}
+
+// The topic is shared with other clients so it will not be closed.
+func (t *memProgressTopic) Close() {}
+
+// Sends the events to all of the topic's subscribers. Events are copied so
+// subscribers do not share them. Subscribers which have fallen behind do
+// not receive the events.
+func (t *memProgressTopic) Send(events ...*common.ProgressEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, ev := range events {
+		for s := range t.subs {
+			ev := *ev
+			select {
+			case s.ch <- &ev:
+			default:
+			}
+		}
+	}
+}
+
+// Adds a new subscriber to the topic.
+func (t *memProgressTopic) subscribe() *memProgressSubscriber {
+	s := &memProgressSubscriber{
+		topic: t,
+		ch:    make(chan *common.ProgressEvent, progressBufferSize),
+	}
+
+	t.mu.Lock()
+	t.subs[s] = struct{}{}
+	t.mu.Unlock()
+
+	return s
+}
+
+// Subscriber of an in-process progress topic.
+type memProgressSubscriber struct {
+	topic *memProgressTopic
+	ch    chan *common.ProgressEvent
+	once  sync.Once
+}
+
+// Removes the subscriber from the topic, and closes its Receive channel.
+func (s *memProgressSubscriber) Close() {
+	s.once.Do(func() {
+		s.topic.mu.Lock()
+		defer s.topic.mu.Unlock()
+
+		delete(s.topic.subs, s)
+		close(s.ch)
+	})
+}
+
+// Returns a read only channel to receive progress events from
+func (s *memProgressSubscriber) Receive() <-chan *common.ProgressEvent {
+	return s.ch
+}
@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemProgressBroadcast(t *testing.T) {
+	cfg := QueueConfig{ConnURL: "mem://progress", Topic: "job_progress"}
+
+	pub, err := NewProgressPublisher(cfg)
+	require.Nil(t, err, "Expect no publisher error")
+	defer pub.Close()
+
+	subs := make([]ProgressSubscriber, 2)
+	for i := range subs {
+		subs[i], err = NewProgressSubscriber(cfg)
+		require.Nil(t, err, "Expect no subscriber error")
+		defer subs[i].Close()
+	}
+
+	ev := &common.ProgressEvent{JobId: 1, Type: common.ProgressCrawled, URLId: 2}
+	pub.Send(ev)
+
+	for i, sub := range subs {
+		select {
+		case got := <-sub.Receive():
+			assert.Equal(t, *ev, *got, "Expect subscriber %d to receive event", i)
+			assert.False(t, ev == got, "Expect event to be copied")
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for event", i)
+		}
+	}
+}
+
+func TestMemProgressClose(t *testing.T) {
+	cfg := QueueConfig{ConnURL: "mem://progress_close", Topic: "job_progress"}
+
+	pub, _ := NewProgressPublisher(cfg)
+	sub, _ := NewProgressSubscriber(cfg)
+	sub.Close()
+
+	// Publisher should not block, or send to the closed subscriber.
+	pub.Send(&common.ProgressEvent{JobId: 1})
+	_, ok := <-sub.Receive()
+	assert.False(t, ok, "Expect receive channel closed")
+
+	// Subscribers which fall behind miss events, instead of blocking the publisher.
+	sub, _ = NewProgressSubscriber(cfg)
+	defer sub.Close()
+	for i := 0; i < progressBufferSize+10; i++ {
+		pub.Send(&common.ProgressEvent{URLId: common.URLId(i)})
+	}
+	assert.Len(t, sub.Receive(), progressBufferSize, "Expect events beyond the buffer dropped")
+}
+
+func TestNopProgressPublisher(t *testing.T) {
+	pub, err := NewProgressPublisher(QueueConfig{})
+	require.Nil(t, err, "Expect no publisher error")
+	pub.Send(&common.ProgressEvent{JobId: 1})
+	pub.Close()
+}
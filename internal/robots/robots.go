@@ -0,0 +1,235 @@
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rules parsed from a site's robots.txt file. The rules are grouped by the
+// user agents they apply to. Use Allowed and CrawlDelay to query the rules
+// for a specific user agent.
+type Robots struct {
+	// Groups of rules, keyed by the lower cased user agent they apply to.
+	groups map[string]*group
+
+	// If set all paths are disallowed regardless of the groups. Used
+	// when the robots.txt could not be retrieved because of a server
+	// error.
+	disallowAll bool
+
+	// Sitemap URLs listed in the robots.txt file. Sitemaps are not
+	// part of any group and apply to all user agents.
+	Sitemaps []string
+}
+
+// Group of rules for one or more user agents.
+type group struct {
+	// Allow and Disallow rules of the group.
+	rules []rule
+
+	// Delay between requests the site asks the crawler to honor. Only
+	// valid if hasCrawlDelay is set.
+	crawlDelay    time.Duration
+	hasCrawlDelay bool
+}
+
+// A single Allow or Disallow rule of a group.
+type rule struct {
+	// If the rule allows the paths it matches
+	allow bool
+
+	// Path pattern of the rule. '*' matches any sequence of characters,
+	// and a trailing '$' anchors the pattern to the end of the path.
+	pattern string
+}
+
+// Returns rules which allow all paths. Used when a site does not have
+// a robots.txt file.
+func AllowAll() *Robots {
+	return &Robots{groups: map[string]*group{}}
+}
+
+// Returns rules which disallow all paths. Used when the site's robots.txt
+// could not be retrieved.
+func DisallowAll() *Robots {
+	return &Robots{groups: map[string]*group{}, disallowAll: true}
+}
+
+// Returns the rules for a robots.txt HTTP fetch based on the response
+// status code. Successful responses have their body parsed, a missing
+// robots.txt (4xx) allows all, and server errors or an unreachable site
+// (status code 0) disallow all.
+func FromResponse(statusCode int, body []byte) *Robots {
+	switch {
+	case statusCode >= 200 && statusCode < 300:
+		return Parse(body)
+	case statusCode >= 400 && statusCode < 500:
+		return AllowAll()
+	default:
+		return DisallowAll()
+	}
+}
+
+// Parses the content of a robots.txt file. Lines which are not understood
+// are ignored. Consecutive user-agent lines start a group which all
+// following rules apply to until the next user-agent line following a
+// rule. Groups for the same user agent are merged together.
+func Parse(body []byte) *Robots {
+	r := AllowAll()
+
+	var agents []string
+	var cur []*group
+	inRules := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				// A user-agent line after rules starts a new group
+				agents = nil
+				cur = nil
+				inRules = false
+			}
+			agent := strings.ToLower(value)
+			agents = append(agents, agent)
+			g, ok := r.groups[agent]
+			if !ok {
+				g = &group{}
+				r.groups[agent] = g
+			}
+			cur = append(cur, g)
+
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// An empty rule matches nothing
+				continue
+			}
+			for _, g := range cur {
+				g.rules = append(g.rules, rule{allow: key == "allow", pattern: value})
+			}
+
+		case "crawl-delay":
+			inRules = true
+			secs, err := strconv.ParseFloat(value, 64)
+			if err != nil || secs < 0 {
+				continue
+			}
+			for _, g := range cur {
+				g.crawlDelay = time.Duration(secs * float64(time.Second))
+				g.hasCrawlDelay = true
+			}
+
+		case "sitemap":
+			if value != "" {
+				r.Sitemaps = append(r.Sitemaps, value)
+			}
+		}
+	}
+
+	return r
+}
+
+// Returns if the user agent is allowed to crawl the path. The path should
+// include the URL's query if it has one. The rule with the longest pattern
+// matching the path decides if the path is allowed. If an Allow and
+// Disallow rule are equally long the path is allowed. If no rules match
+// the path is allowed.
+func (r *Robots) Allowed(userAgent, path string) bool {
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+
+	g := r.group(userAgent)
+	if g == nil {
+		return true
+	}
+
+	allowed := true
+	matchLen := -1
+	for _, rl := range g.rules {
+		if !matchPattern(rl.pattern, path) {
+			continue
+		}
+		if l := len(rl.pattern); l > matchLen || (l == matchLen && rl.allow) {
+			matchLen = l
+			allowed = rl.allow
+		}
+	}
+
+	return allowed
+}
+
+// Returns the crawl delay the site asked the user agent to honor between
+// requests. Zero is returned if no crawl delay was set.
+func (r *Robots) CrawlDelay(userAgent string) time.Duration {
+	if g := r.group(userAgent); g != nil && g.hasCrawlDelay {
+		return g.crawlDelay
+	}
+	return 0
+}
+
+// Returns the group which applies to the user agent. A group for the
+// user agent's product token, the agent's name before any '/' version or
+// whitespace, is used if there is one. Otherwise the '*' group is used.
+// Nil is returned if no group applies.
+func (r *Robots) group(userAgent string) *group {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	if g, ok := r.groups[token]; ok && token != "" {
+		return g
+	}
+	return r.groups["*"]
+}
+
+// Returns if the robots.txt path pattern matches the path. '*' in the
+// pattern matches any sequence of characters, and a trailing '$' requires
+// the pattern to match the end of the path. Otherwise patterns match any
+// path they are a prefix of.
+func matchPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+
+	for i := 1; i < len(parts); i++ {
+		if anchored && i == len(parts)-1 {
+			return strings.HasSuffix(path, parts[i])
+		}
+		j := strings.Index(path, parts[i])
+		if j < 0 {
+			return false
+		}
+		path = path[j+len(parts[i]):]
+	}
+
+	return !anchored || path == ""
+}
@@ -0,0 +1,95 @@
+package robots
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const testRobots = `
+# Example robots.txt
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search*q=
+Crawl-delay: 2
+
+User-agent: harvester
+User-agent: other
+Disallow: /harvester-only
+Crawl-delay: 0.5
+
+User-agent: Harvester
+Disallow: /merged
+
+Sitemap: http://example.com/sitemap.xml
+`
+
+type allowedTestCase struct {
+	agent   string
+	path    string
+	allowed bool
+}
+
+var allowedTestCases = []allowedTestCase{
+	allowedTestCase{agent: "bot", path: "/", allowed: true},
+	allowedTestCase{agent: "bot", path: "/private", allowed: false},
+	allowedTestCase{agent: "bot", path: "/private/secret", allowed: false},
+	allowedTestCase{agent: "bot", path: "/private/public/page", allowed: true},
+	allowedTestCase{agent: "bot", path: "/docs/file.pdf", allowed: false},
+	allowedTestCase{agent: "bot", path: "/docs/file.pdf?x=1", allowed: true},
+	allowedTestCase{agent: "bot", path: "/search?q=a", allowed: false},
+	allowedTestCase{agent: "bot", path: "/search?page=2&q=a", allowed: false},
+	allowedTestCase{agent: "bot", path: "/search?page=2", allowed: true},
+	allowedTestCase{agent: "bot", path: "/robots.txt", allowed: true},
+	allowedTestCase{agent: "harvester (+https://github.com/jasdel/harvester)", path: "/private", allowed: true},
+	allowedTestCase{agent: "Harvester/1.0", path: "/harvester-only", allowed: false},
+	allowedTestCase{agent: "harvester", path: "/merged/page", allowed: false},
+	allowedTestCase{agent: "other", path: "/merged/page", allowed: true},
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	r := Parse([]byte(testRobots))
+
+	for _, c := range allowedTestCases {
+		assert.Equal(t, c.allowed, r.Allowed(c.agent, c.path), "Expect %s allowed to match for %s", c.path, c.agent)
+	}
+}
+
+func TestRobotsPrecedence(t *testing.T) {
+	r := Parse([]byte(`
+User-agent: *
+Allow: /page
+Disallow: /page
+Disallow: /dir/
+Allow: /dir/*.html$
+`))
+
+	assert.True(t, r.Allowed("bot", "/page"), "Expect Allow to win equal length rules")
+	assert.False(t, r.Allowed("bot", "/dir/file.txt"), "Expect Disallow to apply")
+	assert.True(t, r.Allowed("bot", "/dir/file.html"), "Expect longer Allow to win")
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	r := Parse([]byte(testRobots))
+
+	assert.Equal(t, 2*time.Second, r.CrawlDelay("bot"), "Expect default group delay")
+	assert.Equal(t, 500*time.Millisecond, r.CrawlDelay("harvester"), "Expect agent group delay")
+	assert.Equal(t, time.Duration(0), AllowAll().CrawlDelay("bot"), "Expect no delay")
+}
+
+func TestRobotsSitemaps(t *testing.T) {
+	r := Parse([]byte(testRobots))
+	assert.Equal(t, []string{"http://example.com/sitemap.xml"}, r.Sitemaps, "Expect sitemaps")
+}
+
+func TestRobotsFromResponse(t *testing.T) {
+	body := []byte("User-agent: *\nDisallow: /")
+
+	assert.False(t, FromResponse(200, body).Allowed("bot", "/page"), "Expect body rules used")
+	assert.True(t, FromResponse(404, body).Allowed("bot", "/page"), "Expect missing robots to allow all")
+	assert.False(t, FromResponse(503, nil).Allowed("bot", "/page"), "Expect server error to disallow all")
+	assert.False(t, FromResponse(0, nil).Allowed("bot", "/page"), "Expect unreachable to disallow all")
+	assert.True(t, FromResponse(503, nil).Allowed("bot", "/robots.txt"), "Expect robots.txt always allowed")
+}
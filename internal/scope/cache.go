@@ -0,0 +1,89 @@
+package scope
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"sync"
+	"time"
+)
+
+// Caches the matchers of jobs' scope rules relative to their origin URLs, so
+// the origin URL is not read from storage, and the rules are not compiled for
+// each of a job's queued items. Entries expire after the same duration as
+// the job options the rules are part of. Cache is safe to share across
+// go-routines.
+type Cache struct {
+	sc     *storage.Client
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+}
+
+// Job and origin URL a matcher is cached for.
+type cacheKey struct {
+	jobId    common.JobId
+	originId common.URLId
+}
+
+// Cached matcher of a job's origin URL, and when it was created.
+type cacheEntry struct {
+	matcher   *Matcher
+	createdOn time.Time
+}
+
+// Creates a new matcher cache reading origin URLs from the storage client.
+// If maxAge is not set storage.DefaultJobOptionsMaxAge will be used.
+func NewCache(sc *storage.Client, maxAge time.Duration) *Cache {
+	if maxAge <= 0 {
+		maxAge = storage.DefaultJobOptionsMaxAge
+	}
+	return &Cache{
+		sc:      sc,
+		maxAge:  maxAge,
+		entries: make(map[cacheKey]cacheEntry),
+	}
+}
+
+// Returns the matcher of the job's scope rules in opts, relative to the
+// item's origin URL. The matcher is created if it is not cached, or the
+// cached matcher has expired. Nil is returned if the job has no scope rules.
+func (c *Cache) ForItem(item *common.URLQueueItem, opts *common.JobOptions) (*Matcher, error) {
+	if opts.Scope.IsEmpty() {
+		return nil, nil
+	}
+
+	now := time.Now()
+	key := cacheKey{jobId: item.JobId, originId: item.OriginId}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Sub(entry.createdOn) < c.maxAge {
+		return entry.matcher, nil
+	}
+
+	origin, err := c.sc.URLClient().GetURLById(item.OriginId)
+	if err != nil {
+		return nil, err
+	}
+	if origin == nil {
+		return nil, fmt.Errorf("origin URL %d not found", item.OriginId)
+	}
+	m, err := New(opts.Scope, origin.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if now.Sub(e.createdOn) >= c.maxAge {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{matcher: m, createdOn: now}
+
+	return m, nil
+}
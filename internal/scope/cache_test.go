@@ -0,0 +1,38 @@
+package scope
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCacheForItem(t *testing.T) {
+	sc, err := storage.NewClient(storage.ClientConfig{Driver: storage.DriverSQLite})
+	require.Nil(t, err, "Expect no storage error")
+	defer sc.Close()
+
+	origin, err := sc.URLClient().GetOrAddURLByURL("http://www.example.com/docs/", "text/html")
+	require.Nil(t, err, "Expect no error adding origin URL")
+
+	cache := NewCache(sc, 0)
+	item := &common.URLQueueItem{JobId: 1, OriginId: origin.Id}
+	opts := &common.JobOptions{Scope: common.ScopeRules{SameHost: true}}
+
+	m, err := cache.ForItem(item, opts)
+	require.Nil(t, err, "Expect no error getting matcher")
+	assert.True(t, m.InScope("http://www.example.com/about"), "Expect origin's host in scope")
+	assert.False(t, m.InScope("http://blog.example.com/"), "Expect other host out of scope")
+
+	cached, err := cache.ForItem(&common.URLQueueItem{JobId: 1, OriginId: origin.Id, URLId: 5}, opts)
+	require.Nil(t, err, "Expect no error getting cached matcher")
+	assert.True(t, m == cached, "Expect job's matcher reused")
+
+	m, err = cache.ForItem(item, &common.JobOptions{})
+	require.Nil(t, err, "Expect no error without scope rules")
+	assert.Nil(t, m, "Expect no matcher without scope rules")
+
+	_, err = cache.ForItem(&common.URLQueueItem{JobId: 2, OriginId: origin.Id + 1}, opts)
+	assert.NotNil(t, err, "Expect error for missing origin URL")
+}
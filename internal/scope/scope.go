@@ -0,0 +1,117 @@
+package scope
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"golang.org/x/net/publicsuffix"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Matches URLs against the scope rules of a job, relative to the origin URL
+// they descend from. A nil Matcher has no rules, and all URLs are in scope.
+type Matcher struct {
+	rules common.ScopeRules
+
+	// Host, and registrable domain of the origin URL
+	originHost   string
+	originDomain string
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// Creates a Matcher for the rules relative to the origin URL. If the rules
+// are empty nil is returned, and all URLs are in scope. An error is returned
+// if the origin URL, or a regular expression of the rules is not valid.
+func New(rules common.ScopeRules, originURL string) (*Matcher, error) {
+	if rules.IsEmpty() {
+		return nil, nil
+	}
+
+	origin, err := url.Parse(originURL)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Matcher{
+		rules:        rules,
+		originHost:   strings.ToLower(origin.Hostname()),
+		originDomain: registrableDomain(origin.Hostname()),
+	}
+	if m.include, err = compileAll(rules.Include); err != nil {
+		return nil, err
+	}
+	if m.exclude, err = compileAll(rules.Exclude); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Returns if the URL is in scope of the rules. URLs which are not valid are
+// out of scope.
+func (m *Matcher) InScope(rawURL string) bool {
+	if m == nil {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+
+	if m.rules.SameHost && host != m.originHost {
+		return false
+	}
+	if m.rules.SameDomain && registrableDomain(host) != m.originDomain {
+		return false
+	}
+	if m.rules.PathPrefix != "" && !strings.HasPrefix(u.Path, m.rules.PathPrefix) {
+		return false
+	}
+	if len(m.include) > 0 && !matchAny(m.include, rawURL) {
+		return false
+	}
+	if matchAny(m.exclude, rawURL) {
+		return false
+	}
+
+	return true
+}
+
+// Returns the registrable domain of the host using the public suffix list,
+// e.g: example.co.uk for www.example.co.uk. Hosts which do not have one,
+// e.g: IP addresses and localhost, are their own registrable domain.
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// Compiles each of the regular expressions.
+func compileAll(exprs []string) ([]*regexp.Regexp, error) {
+	regs := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		reg, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
+
+// Returns if any of the regular expressions match the string.
+func matchAny(regs []*regexp.Regexp, s string) bool {
+	for _, reg := range regs {
+		if reg.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
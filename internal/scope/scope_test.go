@@ -0,0 +1,69 @@
+package scope
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type inScopeTestCase struct {
+	URL     string
+	InScope bool
+}
+
+func testInScope(t *testing.T, rules common.ScopeRules, cases []inScopeTestCase) {
+	m, err := New(rules, "https://www.example.co.uk/docs/")
+	require.Nil(t, err, "Expect no error creating matcher")
+	for i, c := range cases {
+		assert.Equal(t, c.InScope, m.InScope(c.URL), "%d: %s expected in scope %t", i, c.URL, c.InScope)
+	}
+}
+
+func TestScopeEmpty(t *testing.T) {
+	m, err := New(common.ScopeRules{}, "https://www.example.co.uk/")
+	require.Nil(t, err, "Expect no error creating matcher")
+	assert.Nil(t, m, "Expect no matcher")
+	assert.True(t, m.InScope("https://cdn.example.net/x.js"), "Expect all URLs in scope")
+}
+
+func TestScopeSameHost(t *testing.T) {
+	testInScope(t, common.ScopeRules{SameHost: true}, []inScopeTestCase{
+		{"http://WWW.example.co.uk/other", true},
+		{"https://blog.example.co.uk/", false},
+		{"https://facebook.com/share", false},
+	})
+}
+
+func TestScopeSameDomain(t *testing.T) {
+	testInScope(t, common.ScopeRules{SameDomain: true}, []inScopeTestCase{
+		{"https://www.example.co.uk/other", true},
+		{"https://blog.example.co.uk/", true},
+		{"https://other.co.uk/", false},
+		{"https://example.com/", false},
+	})
+}
+
+func TestScopePathPrefix(t *testing.T) {
+	testInScope(t, common.ScopeRules{PathPrefix: "/docs/"}, []inScopeTestCase{
+		{"https://www.example.co.uk/docs/intro", true},
+		{"https://www.example.co.uk/blog/", false},
+	})
+}
+
+func TestScopeIncludeExclude(t *testing.T) {
+	testInScope(t, common.ScopeRules{
+		Include: []string{`example\.co\.uk`, `^https://cdn\.`},
+		Exclude: []string{`\.pdf$`},
+	}, []inScopeTestCase{
+		{"https://www.example.co.uk/page", true},
+		{"https://cdn.other.com/lib.js", true},
+		{"https://www.example.co.uk/guide.pdf", false},
+		{"https://social.example.com/", false},
+	})
+}
+
+func TestScopeInvalidExpression(t *testing.T) {
+	_, err := New(common.ScopeRules{Include: []string{"("}}, "https://example.com/")
+	assert.NotNil(t, err, "Expect invalid expression error")
+}
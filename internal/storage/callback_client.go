@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Columns of the job_callback table queried for a Callback. Used with scanCallback
+const callbackColumns = `id, job_id, event, url, state, attempts, next_attempt_on, created_on, delivered_on`
+
+// Provides a name spaced collection of job callback storage operations. A
+// callback is recorded once a job with a callback URL is done, and delivered
+// to the callback URL by the notifier. CallbackClient does not hold non
+// go-routine state, and is safe to share across multiples.
+type CallbackClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Records the job's callback if the job is done, and has a callback URL. A
+// job is done once it is cancelled, or all of its job URLs are complete. A
+// job whose job URLs all failed to be crawled is done with the failed event.
+// Only a single callback is recorded for each job, so it is safe to call
+// each time one of the job's URLs completes. Returns if the callback was
+// recorded by this call.
+func (c *CallbackClient) AddIfDone(jobId common.JobId) (bool, error) {
+	const queryCallbackInsert = `
+INSERT INTO job_callback (job_id, event, url, state, attempts, next_attempt_on, created_on)
+SELECT job.id,
+	CASE
+		WHEN job.state = $2 THEN $3
+		WHEN EXISTS (
+			SELECT 1 FROM job_url WHERE job_url.job_id = job.id AND NOT EXISTS (
+				SELECT 1 FROM dead_letter WHERE dead_letter.job_id = job.id AND dead_letter.url_id = job_url.url_id))
+			THEN $4
+		ELSE $5
+	END,
+	job.callback_url, $6, 0, $7, $7
+FROM job
+WHERE job.id = $1 AND job.callback_url != ''
+	AND EXISTS (SELECT 1 FROM job_url WHERE job_id = $1)
+	AND (job.state = $2 OR NOT EXISTS (SELECT 1 FROM job_url WHERE job_id = $1 AND completed_on IS NULL))
+	AND NOT EXISTS (SELECT 1 FROM job_callback WHERE job_id = $1)`
+
+	res, err := c.client.exec(queryCallbackInsert, jobId, common.JobStateCancelled, common.CallbackEventCancelled,
+		common.CallbackEventCompleted, common.CallbackEventFailed, common.CallbackStatePending, time.Now().UTC())
+	if err != nil {
+		// The callback may of been recorded concurrently, violating the
+		// job's unique index.
+		if cbs, listErr := c.list(jobId); listErr == nil && len(cbs) > 0 {
+			return false, nil
+		}
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Returns up to limit pending callbacks whose next attempt is due, oldest first.
+func (c *CallbackClient) Due(limit int) ([]*Callback, error) {
+	const queryCallbacksDue = `
+SELECT ` + callbackColumns + ` FROM job_callback
+WHERE state = $1 AND next_attempt_on <= $2
+ORDER BY next_attempt_on, id
+LIMIT $3`
+
+	rows, err := c.client.query(queryCallbacksDue, common.CallbackStatePending, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCallbacks(rows)
+}
+
+// Claims the due callback to attempt its delivery, so other notifiers will
+// not attempt it at the same time. The callback is not due again until the
+// lease expires, so if the attempt is never recorded the callback will be
+// attempted again. Returns false if the callback was already claimed, or is
+// no longer pending.
+func (c *CallbackClient) Claim(cb *Callback, lease time.Duration) (bool, error) {
+	const queryCallbackClaim = `
+UPDATE job_callback SET next_attempt_on = $1
+WHERE id = $2 AND state = $3 AND attempts = $4 AND next_attempt_on <= $5`
+
+	now := time.Now().UTC()
+	res, err := c.client.exec(queryCallbackClaim, now.Add(lease), cb.Id, common.CallbackStatePending, cb.Attempts, now)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Records the attempt to deliver the callback, and updates the callback's
+// delivery state. Pending callbacks will be attempted again at next.
+func (c *CallbackClient) RecordAttempt(cb *Callback, attempt *CallbackAttempt, state string, next time.Time) error {
+	const queryAttemptInsert = `
+INSERT INTO job_callback_attempt (callback_id, attempted_on, status_code, error)
+	VALUES ($1, $2, $3, $4)`
+	const queryCallbackUpdate = `
+UPDATE job_callback SET attempts = attempts + 1, state = $1, next_attempt_on = $2, delivered_on = $3
+WHERE id = $4`
+
+	if _, err := c.client.exec(queryAttemptInsert, cb.Id, attempt.AttemptedOn.UTC(), attempt.StatusCode, attempt.Error); err != nil {
+		return err
+	}
+
+	var deliveredOn interface{}
+	if state == common.CallbackStateDelivered {
+		deliveredOn = attempt.AttemptedOn.UTC()
+	}
+	if _, err := c.client.exec(queryCallbackUpdate, state, next.UTC(), deliveredOn, cb.Id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the callbacks recorded for the job, with their delivery attempts.
+// If the job has no callbacks an empty list will be returned.
+func (c *CallbackClient) List(jobId common.JobId) ([]*Callback, error) {
+	const queryAttempts = `
+SELECT attempted_on, status_code, error FROM job_callback_attempt
+WHERE callback_id = $1
+ORDER BY id`
+
+	cbs, err := c.list(jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cb := range cbs {
+		rows, err := c.client.query(queryAttempts, cb.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		cb.AttemptLog = []*CallbackAttempt{}
+		for rows.Next() {
+			var (
+				attemptedOn sql.NullTime
+				statusCode  sql.NullInt64
+				errStr      sql.NullString
+			)
+			if err := rows.Scan(&attemptedOn, &statusCode, &errStr); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			cb.AttemptLog = append(cb.AttemptLog, &CallbackAttempt{
+				AttemptedOn: attemptedOn.Time,
+				StatusCode:  int(statusCode.Int64),
+				Error:       errStr.String,
+			})
+		}
+		// Closed before the next query, since SQLite only has a single connection.
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return cbs, nil
+}
+
+// Returns the callbacks recorded for the job, without their delivery attempts.
+func (c *CallbackClient) list(jobId common.JobId) ([]*Callback, error) {
+	const queryCallbacks = `SELECT ` + callbackColumns + ` FROM job_callback WHERE job_id = $1 ORDER BY id`
+
+	rows, err := c.client.query(queryCallbacks, jobId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCallbacks(rows)
+}
+
+// Scans the callbackColumns of all rows into Callback records.
+func scanCallbacks(rows *sql.Rows) ([]*Callback, error) {
+	cbs := []*Callback{}
+	for rows.Next() {
+		var (
+			id            sql.NullInt64
+			jobId         sql.NullInt64
+			event         sql.NullString
+			url           sql.NullString
+			state         sql.NullString
+			attempts      sql.NullInt64
+			nextAttemptOn sql.NullTime
+			createdOn     sql.NullTime
+			deliveredOn   sql.NullTime
+		)
+		if err := rows.Scan(&id, &jobId, &event, &url, &state, &attempts, &nextAttemptOn, &createdOn, &deliveredOn); err != nil {
+			return nil, err
+		}
+		if !id.Valid || !jobId.Valid {
+			return nil, fmt.Errorf("Invalid callback result")
+		}
+
+		cbs = append(cbs, &Callback{
+			Id:            id.Int64,
+			JobId:         common.JobId(jobId.Int64),
+			Event:         event.String,
+			URL:           url.String,
+			State:         state.String,
+			Attempts:      int(attempts.Int64),
+			NextAttemptOn: nextAttemptOn.Time,
+			CreatedOn:     createdOn.Time,
+			DeliveredOn:   deliveredOn.Time,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cbs, nil
+}
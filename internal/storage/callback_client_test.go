@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Creates a job for the URLs which will be called back at the callback URL.
+func createCallbackJob(t *testing.T, sc *Client, callbackURL string, urls ...string) *Job {
+	spec := JobSpec{CallbackURL: callbackURL}
+	for _, u := range urls {
+		spec.URLs = append(spec.URLs, JobSpecURL{URL: u})
+	}
+	job, _, err := sc.JobClient().CreateJob(spec)
+	require.Nil(t, err, "Expect no error creating job")
+	return job
+}
+
+func TestCallbackAddIfDone(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	callbackClient := sc.CallbackClient()
+	urlClient := sc.URLClient()
+
+	job := createCallbackJob(t, sc, "http://example.org/done", "http://example.com", "http://example.net")
+
+	added, err := callbackClient.AddIfDone(job.Id)
+	require.Nil(t, err, "Expect no error adding callback")
+	assert.False(t, added, "Expect no callback while job URLs are incomplete")
+
+	require.Nil(t, urlClient.MarkJobURLComplete(job.Id, job.URLs[0].URLId), "Expect no error completing job URL")
+	require.Nil(t, urlClient.MarkJobURLComplete(job.Id, job.URLs[1].URLId), "Expect no error completing job URL")
+	require.Nil(t, sc.DeadLetterClient().Add(&DeadLetter{JobId: job.Id, URLId: job.URLs[0].URLId}), "Expect no error adding dead letter")
+
+	added, err = callbackClient.AddIfDone(job.Id)
+	require.Nil(t, err, "Expect no error adding callback")
+	assert.True(t, added, "Expect callback once job URLs are complete")
+
+	added, err = callbackClient.AddIfDone(job.Id)
+	require.Nil(t, err, "Expect no error adding callback again")
+	assert.False(t, added, "Expect only a single callback")
+
+	cbs, err := callbackClient.List(job.Id)
+	require.Nil(t, err, "Expect no error listing callbacks")
+	require.Len(t, cbs, 1, "Expect job's callback")
+	assert.Equal(t, common.CallbackEventCompleted, cbs[0].Event, "Expect completed event")
+	assert.Equal(t, "http://example.org/done", cbs[0].URL, "Expect job's callback URL")
+	assert.Equal(t, common.CallbackStatePending, cbs[0].State, "Expect callback pending")
+	assert.Len(t, cbs[0].AttemptLog, 0, "Expect no attempts")
+
+	// Jobs whose job URLs all failed are done with the failed event.
+	failed := createCallbackJob(t, sc, "http://example.org/done", "http://example.com")
+	require.Nil(t, urlClient.MarkJobURLComplete(failed.Id, failed.URLs[0].URLId), "Expect no error completing job URL")
+	require.Nil(t, sc.DeadLetterClient().Add(&DeadLetter{JobId: failed.Id, URLId: failed.URLs[0].URLId}), "Expect no error adding dead letter")
+	_, err = callbackClient.AddIfDone(failed.Id)
+	require.Nil(t, err, "Expect no error adding callback")
+	cbs, err = callbackClient.List(failed.Id)
+	require.Nil(t, err, "Expect no error listing callbacks")
+	require.Len(t, cbs, 1, "Expect job's callback")
+	assert.Equal(t, common.CallbackEventFailed, cbs[0].Event, "Expect failed event")
+
+	// Cancelled jobs are done, even though their job URLs are incomplete.
+	cancelled := createCallbackJob(t, sc, "http://example.org/done", "http://example.com")
+	_, err = sc.JobClient().Cancel(cancelled.Id)
+	require.Nil(t, err, "Expect no error cancelling job")
+	added, err = callbackClient.AddIfDone(cancelled.Id)
+	require.Nil(t, err, "Expect no error adding callback")
+	assert.True(t, added, "Expect callback of cancelled job")
+	cbs, err = callbackClient.List(cancelled.Id)
+	require.Nil(t, err, "Expect no error listing callbacks")
+	require.Len(t, cbs, 1, "Expect job's callback")
+	assert.Equal(t, common.CallbackEventCancelled, cbs[0].Event, "Expect cancelled event")
+
+	// Jobs without a callback URL are never called back.
+	none := createCallbackJob(t, sc, "", "http://example.com")
+	require.Nil(t, urlClient.MarkJobURLComplete(none.Id, none.URLs[0].URLId), "Expect no error completing job URL")
+	added, err = callbackClient.AddIfDone(none.Id)
+	require.Nil(t, err, "Expect no error adding callback")
+	assert.False(t, added, "Expect no callback without callback URL")
+}
+
+func TestCallbackDelivery(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	callbackClient := sc.CallbackClient()
+
+	job := createCallbackJob(t, sc, "http://example.org/done", "http://example.com")
+	require.Nil(t, sc.URLClient().MarkJobURLComplete(job.Id, job.URLs[0].URLId), "Expect no error completing job URL")
+	_, err := callbackClient.AddIfDone(job.Id)
+	require.Nil(t, err, "Expect no error adding callback")
+
+	due, err := callbackClient.Due(10)
+	require.Nil(t, err, "Expect no error getting due callbacks")
+	require.Len(t, due, 1, "Expect callback due")
+	cb := due[0]
+
+	claimed, err := callbackClient.Claim(cb, time.Minute)
+	require.Nil(t, err, "Expect no error claiming callback")
+	assert.True(t, claimed, "Expect callback claimed")
+	claimed, err = callbackClient.Claim(cb, time.Minute)
+	require.Nil(t, err, "Expect no error claiming callback")
+	assert.False(t, claimed, "Expect callback only claimed once")
+
+	due, err = callbackClient.Due(10)
+	require.Nil(t, err, "Expect no error getting due callbacks")
+	assert.Len(t, due, 0, "Expect claimed callback not due")
+
+	now := time.Now().UTC()
+	require.Nil(t, callbackClient.RecordAttempt(cb, &CallbackAttempt{AttemptedOn: now, StatusCode: 500, Error: "server error"},
+		common.CallbackStatePending, now.Add(-time.Second)), "Expect no error recording attempt")
+
+	due, err = callbackClient.Due(10)
+	require.Nil(t, err, "Expect no error getting due callbacks")
+	require.Len(t, due, 1, "Expect callback due for retry")
+	assert.Equal(t, 1, due[0].Attempts, "Expect attempt counted")
+
+	require.Nil(t, callbackClient.RecordAttempt(due[0], &CallbackAttempt{AttemptedOn: now, StatusCode: 200},
+		common.CallbackStateDelivered, now), "Expect no error recording attempt")
+
+	due, err = callbackClient.Due(10)
+	require.Nil(t, err, "Expect no error getting due callbacks")
+	assert.Len(t, due, 0, "Expect delivered callback not due")
+
+	cbs, err := callbackClient.List(job.Id)
+	require.Nil(t, err, "Expect no error listing callbacks")
+	require.Len(t, cbs, 1, "Expect job's callback")
+	assert.Equal(t, common.CallbackStateDelivered, cbs[0].State, "Expect callback delivered")
+	assert.Equal(t, 2, cbs[0].Attempts, "Expect attempts counted")
+	assert.False(t, cbs[0].DeliveredOn.IsZero(), "Expect delivered on set")
+	require.Len(t, cbs[0].AttemptLog, 2, "Expect attempts recorded")
+	assert.Equal(t, 500, cbs[0].AttemptLog[0].StatusCode, "Expect first attempt's status")
+	assert.Equal(t, "server error", cbs[0].AttemptLog[0].Error, "Expect first attempt's error")
+	assert.Equal(t, 200, cbs[0].AttemptLog[1].StatusCode, "Expect second attempt's status")
+}
@@ -3,24 +3,64 @@ package storage
 import (
 	"database/sql"
 	"fmt"
-	_ "github.com/lib/pq"
 )
 
+// Storage drivers the client is able to use.
+const (
+	// PostgreSQL database, configured via the ClientConfig's connection fields.
+	DriverPostgres = "postgres"
+
+	// Embedded SQLite database, stored in the ClientConfig's Path. The schema
+	// is created automatically when the client is created.
+	DriverSQLite = "sqlite3"
+)
+
+// Describes the differences between the SQL databases the storage client is
+// able to use. Queries are written with Postgres style '$N' placeholders, and
+// are rebound to the dialect's placeholder style before they are executed.
+type dialect interface {
+	// Opens and prepares the database described by the configuration.
+	open(cfg ClientConfig) (*sql.DB, error)
+
+	// Rewrites the query's '$N' placeholders into the dialect's style.
+	rebind(query string) string
+
+	// Executes an insert query, returning the 'id' column of the new row.
+	// The query should not include a RETURNING clause.
+	insertId(db *sql.DB, query string, args ...interface{}) (int64, error)
+
+	// Returns the condition matching the column against the regular
+	// expression of the placeholder.
+	regexp(column, placeholder string) string
+}
+
 // Client for communicating with the storage service. Provides a way to
 // Create jobs, update jobs, and manipulate URL entries
 type Client struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect
 }
 
 // Creates a new instance of the storage client. returning a client instance
 // to perform operations with. The client is safe across multiple go routines.
 func NewClient(cfg ClientConfig) (*Client, error) {
-	db, err := sql.Open("postgres", cfg.String())
+	var d dialect
+	switch cfg.Driver {
+	case "", DriverPostgres:
+		d = postgresDialect{}
+	case DriverSQLite:
+		d = sqliteDialect{}
+	default:
+		return nil, fmt.Errorf("Unknown storage driver %s", cfg.Driver)
+	}
+
+	db, err := d.open(cfg)
 	if err != nil {
 		return nil, err
 	}
 	return &Client{
-		db: db,
+		db:      db,
+		dialect: d,
 	}, nil
 }
 
@@ -46,8 +86,85 @@ func (c *Client) URLClient() *URLClient {
 	}
 }
 
+// Return a Robots client which can be used to cache and query the robots.txt
+// of sites.
+func (c *Client) RobotsClient() *RobotsClient {
+	return &RobotsClient{
+		client: c,
+	}
+}
+
+// Return a Host client which can be used to limit the requests made to
+// hosts across all workers.
+func (c *Client) HostClient() *HostClient {
+	return &HostClient{
+		client: c,
+	}
+}
+
+// Return a Dead Letter client which can be used to record and query the
+// URLs which failed to be crawled.
+func (c *Client) DeadLetterClient() *DeadLetterClient {
+	return &DeadLetterClient{
+		client: c,
+	}
+}
+
+// Return a Parked client which can be used to hold the queued items of
+// paused jobs until they are resumed.
+func (c *Client) ParkedClient() *ParkedClient {
+	return &ParkedClient{
+		client: c,
+	}
+}
+
+// Return a Scheduled client which can be used to hold items until they are
+// due to be sent to a queue.
+func (c *Client) ScheduledClient() *ScheduledClient {
+	return &ScheduledClient{
+		client: c,
+	}
+}
+
+// Return a Callback client which can be used to record and deliver the
+// callbacks of jobs once they are done.
+func (c *Client) CallbackClient() *CallbackClient {
+	return &CallbackClient{
+		client: c,
+	}
+}
+
+// Executes a query without returning any rows.
+func (c *Client) exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.Exec(c.dialect.rebind(query), args...)
+}
+
+// Executes a query that returns rows.
+func (c *Client) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.Query(c.dialect.rebind(query), args...)
+}
+
+// Executes a query that is expected to return at most one row.
+func (c *Client) queryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRow(c.dialect.rebind(query), args...)
+}
+
+// Executes an insert query, returning the 'id' of the newly inserted row.
+func (c *Client) insertId(query string, args ...interface{}) (int64, error) {
+	return c.dialect.insertId(c.db, query, args...)
+}
+
 // Configuration for the storage connection info
 type ClientConfig struct {
+	// Storage driver to use, "postgres" or "sqlite3". If not set
+	// postgres will be used.
+	Driver string `json:"driver"`
+
+	// Path of the database file for the sqlite3 driver. If not set
+	// an in-memory database will be used, which will not persist
+	// once the client is closed.
+	Path string `json:"path"`
+
 	// User name the storage will connect as
 	User string `json:"user"`
 	// Password for the user
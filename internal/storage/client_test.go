@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// Creates a new storage client backed by an empty in-memory SQLite database.
+func newTestClient(t *testing.T) *Client {
+	c, err := NewClient(ClientConfig{Driver: DriverSQLite})
+	require.Nil(t, err, "Expect no error creating client")
+	return c
+}
+
+func TestNewClientUnknownDriver(t *testing.T) {
+	c, err := NewClient(ClientConfig{Driver: "unknown"})
+	assert.NotNil(t, err, "Expect unknown driver to fail")
+	assert.Nil(t, c, "Expect no client")
+}
+
+func TestSQLiteRebind(t *testing.T) {
+	q := sqliteDialect{}.rebind(`SELECT 1 FROM url WHERE url = $1 AND id = $12`)
+	assert.Equal(t, `SELECT 1 FROM url WHERE url = ?1 AND id = ?12`, q, "Expect placeholders rewritten")
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Provides a name spaced collection of dead letter storage operations. Dead
+// letters are the URLs which failed to be crawled after all their attempts.
+// DeadLetterClient does not hold non go-routine state, and is safe to share
+// across multiples.
+type DeadLetterClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Records the URL as failed to be crawled for the job. The dead letter's
+// Id, URL, and CreatedOn fields are ignored.
+func (d *DeadLetterClient) Add(dl *DeadLetter) error {
+	const queryDeadLetterInsert = `
+INSERT INTO dead_letter (job_id, url_id, origin_id, refer_id, attempts, last_error, status_code, created_on)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	if _, err := d.client.exec(queryDeadLetterInsert, dl.JobId, dl.URLId, dl.OriginId, dl.ReferId,
+		dl.Attempts, dl.LastError, dl.StatusCode, time.Now().UTC()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns all dead letters recorded for the job, oldest first. If the job
+// has no dead letters an empty list will be returned.
+func (d *DeadLetterClient) List(jobId common.JobId) ([]*DeadLetter, error) {
+	const queryDeadLetters = `
+SELECT dead_letter.id, dead_letter.url_id, url.url, dead_letter.origin_id, dead_letter.refer_id,
+	dead_letter.attempts, dead_letter.last_error, dead_letter.status_code, dead_letter.created_on
+FROM dead_letter
+JOIN url ON url.id = dead_letter.url_id
+WHERE dead_letter.job_id = $1
+ORDER BY dead_letter.id`
+
+	rows, err := d.client.query(queryDeadLetters, jobId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dls := []*DeadLetter{}
+	for rows.Next() {
+		var (
+			id         sql.NullInt64
+			urlId      sql.NullInt64
+			u          sql.NullString
+			originId   sql.NullInt64
+			referId    sql.NullInt64
+			attempts   sql.NullInt64
+			lastError  sql.NullString
+			statusCode sql.NullInt64
+			createdOn  sql.NullTime
+		)
+		if err := rows.Scan(&id, &urlId, &u, &originId, &referId, &attempts, &lastError, &statusCode, &createdOn); err != nil {
+			return nil, err
+		}
+		if !id.Valid || !urlId.Valid || !u.Valid || !createdOn.Valid {
+			return nil, fmt.Errorf("Invalid dead letter result for job %d", jobId)
+		}
+
+		dls = append(dls, &DeadLetter{
+			Id:         id.Int64,
+			JobId:      jobId,
+			URLId:      common.URLId(urlId.Int64),
+			URL:        u.String,
+			OriginId:   common.URLId(originId.Int64),
+			ReferId:    common.URLId(referId.Int64),
+			Attempts:   int(attempts.Int64),
+			LastError:  lastError.String,
+			StatusCode: int(statusCode.Int64),
+			CreatedOn:  createdOn.Time,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return dls, nil
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDeadLetterAddList(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	dlClient := sc.DeadLetterClient()
+
+	origin, _ := sc.URLClient().Add("http://example.com", "text/html")
+	u, _ := sc.URLClient().Add("http://example.com/a", "text/html")
+
+	dls, err := dlClient.List(1)
+	require.Nil(t, err, "Expect no error listing dead letters")
+	assert.Len(t, dls, 0, "Expect no dead letters")
+
+	require.Nil(t, dlClient.Add(&DeadLetter{
+		JobId:      1,
+		URLId:      u.Id,
+		OriginId:   origin.Id,
+		ReferId:    origin.Id,
+		Attempts:   3,
+		LastError:  "server error",
+		StatusCode: 500,
+	}), "Expect no error adding dead letter")
+	require.Nil(t, dlClient.Add(&DeadLetter{JobId: 2, URLId: u.Id}), "Expect no error adding dead letter")
+
+	dls, err = dlClient.List(1)
+	require.Nil(t, err, "Expect no error listing dead letters")
+	require.Len(t, dls, 1, "Expect only the job's dead letters")
+	assert.Equal(t, "http://example.com/a", dls[0].URL, "Expect URL of the dead letter")
+	assert.Equal(t, origin.Id, dls[0].ReferId, "Expect refer of the dead letter")
+	assert.Equal(t, 3, dls[0].Attempts, "Expect attempts of the dead letter")
+	assert.Equal(t, "server error", dls[0].LastError, "Expect last error of the dead letter")
+	assert.Equal(t, 500, dls[0].StatusCode, "Expect status code of the dead letter")
+	assert.False(t, dls[0].CreatedOn.IsZero(), "Expect created on set")
+}
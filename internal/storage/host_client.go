@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Duration a host connection acquired via HostClient.Acquire is held for
+// before it is considered abandoned. Prevents a worker which exited without
+// releasing its connections from blocking the host forever.
+const hostLeaseTimeout = 5 * time.Minute
+
+// Provides a name spaced collection of host request limiting storage
+// operations. The limits are stored so that they are shared by all workers.
+// HostClient does not hold non go-routine state, and is safe to share
+// across multiples.
+type HostClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Attempts to acquire a connection to the host. The host is the scheme and
+// host of a site, e.g: https://example.com. A connection is acquired if
+// the host has fewer than maxConns active connections, the interval since
+// the last acquired connection has passed, and the host is not backing off.
+// If the connection is acquired zero is returned, and Release must be called
+// once the request is complete. Otherwise the duration to wait before trying
+// again is returned.
+func (h *HostClient) Acquire(host string, interval time.Duration, maxConns int) (time.Duration, error) {
+	const queryHostInsert = `
+INSERT INTO host_limit (host, active)
+	SELECT $1, 0
+	WHERE NOT EXISTS (SELECT 1 FROM host_limit WHERE host = $1)`
+
+	// Active connections are reset if all the leases have expired.
+	const queryHostAcquire = `
+UPDATE host_limit SET
+	active = CASE WHEN lease_expires_on <= $2 THEN 1 ELSE active + 1 END,
+	next_request_on = $3,
+	lease_expires_on = $4
+WHERE host = $1
+	AND (active < $5 OR lease_expires_on <= $2)
+	AND (next_request_on IS NULL OR next_request_on <= $2)
+	AND (backoff_until IS NULL OR backoff_until <= $2)`
+
+	const queryHostLimit = `SELECT active, next_request_on, backoff_until FROM host_limit WHERE host = $1`
+
+	if _, err := h.client.exec(queryHostInsert, host); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	res, err := h.client.exec(queryHostAcquire, host, now, now.Add(interval), now.Add(hostLeaseTimeout), maxConns)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return 0, err
+	} else if n > 0 {
+		return 0, nil
+	}
+
+	var (
+		active        sql.NullInt64
+		nextRequestOn sql.NullTime
+		backoffUntil  sql.NullTime
+	)
+	if err := h.client.queryRow(queryHostLimit, host).Scan(&active, &nextRequestOn, &backoffUntil); err != nil {
+		return 0, err
+	}
+
+	// Wait until the host is no longer backing off, and the request interval
+	// has passed. If those have passed the host is at its connection limit,
+	// so wait at least the interval for a connection to be released.
+	wait := interval
+	if nextRequestOn.Valid && nextRequestOn.Time.Sub(now) > wait {
+		wait = nextRequestOn.Time.Sub(now)
+	}
+	if backoffUntil.Valid && backoffUntil.Time.Sub(now) > wait {
+		wait = backoffUntil.Time.Sub(now)
+	}
+	if wait <= 0 {
+		wait = time.Second
+	}
+
+	return wait, nil
+}
+
+// Releases a connection to the host previously acquired with Acquire.
+func (h *HostClient) Release(host string) error {
+	const queryHostRelease = `
+UPDATE host_limit SET active = CASE WHEN active > 0 THEN active - 1 ELSE 0 END
+WHERE host = $1`
+
+	if _, err := h.client.exec(queryHostRelease, host); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Prevents any connections to the host from being acquired until the time
+// provided. Used when the host asks for requests to be retried later. If
+// the host is already backing off until a later time, that time is kept.
+func (h *HostClient) Backoff(host string, until time.Time) error {
+	const queryHostBackoff = `
+UPDATE host_limit SET backoff_until = $1
+WHERE host = $2 AND (backoff_until IS NULL OR backoff_until < $1)`
+
+	if _, err := h.client.exec(queryHostBackoff, until.UTC(), host); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHostAcquireInterval(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	hostClient := sc.HostClient()
+
+	wait, err := hostClient.Acquire("http://example.com", time.Hour, 2)
+	require.Nil(t, err, "Expect no error acquiring host")
+	assert.Equal(t, time.Duration(0), wait, "Expect connection acquired")
+
+	wait, err = hostClient.Acquire("http://example.com", time.Hour, 2)
+	require.Nil(t, err, "Expect no error acquiring host")
+	assert.True(t, wait > 59*time.Minute, "Expect to wait for interval, %s", wait)
+
+	wait, err = hostClient.Acquire("http://example.org", time.Hour, 2)
+	require.Nil(t, err, "Expect no error acquiring host")
+	assert.Equal(t, time.Duration(0), wait, "Expect other hosts not limited")
+}
+
+func TestHostAcquireMaxConns(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	hostClient := sc.HostClient()
+
+	wait, _ := hostClient.Acquire("http://example.com", 0, 1)
+	assert.Equal(t, time.Duration(0), wait, "Expect connection acquired")
+
+	wait, _ = hostClient.Acquire("http://example.com", 0, 1)
+	assert.True(t, wait > 0, "Expect to wait for connection to be released")
+
+	require.Nil(t, hostClient.Release("http://example.com"), "Expect no error releasing host")
+	wait, _ = hostClient.Acquire("http://example.com", 0, 1)
+	assert.Equal(t, time.Duration(0), wait, "Expect connection acquired after release")
+}
+
+func TestHostBackoff(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	hostClient := sc.HostClient()
+
+	hostClient.Acquire("http://example.com", 0, 1)
+	hostClient.Release("http://example.com")
+	require.Nil(t, hostClient.Backoff("http://example.com", time.Now().Add(time.Hour)), "Expect no error backing off")
+	require.Nil(t, hostClient.Backoff("http://example.com", time.Now().Add(time.Minute)), "Expect earlier backoff ignored")
+
+	wait, err := hostClient.Acquire("http://example.com", 0, 1)
+	require.Nil(t, err, "Expect no error acquiring host")
+	assert.True(t, wait > 59*time.Minute, "Expect to wait for backoff, %s", wait)
+}
@@ -1,10 +1,13 @@
 package storage
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/jasdel/harvester/internal/common"
-	"github.com/lib/pq"
+	"strings"
+	"time"
 )
 
 // Provides a name spaced collection of Job based storage operations. JobClient
@@ -14,20 +17,43 @@ type JobClient struct {
 	client *Client
 }
 
+// Columns of the job table read by getJobFromRow, and getJobFromRows.
+const jobColumns = `id, created_on, options, tags, callback_url, idempotency_key, state, cancelled_on`
+
 // Extracts a job from a QueryRow.  Nil for the job will be returned
 // if the job does not exist.
-// Expects the query columns to be in the order of:
-// 		job_id, created_on
+// Expects the query columns to be in the order of jobColumns.
 func getJobFromRow(row *sql.Row) (*Job, error) {
+	job, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Extracts a job from a Query of rows.
+// Expects the query columns to be in the order of jobColumns.
+func getJobFromRows(rows *sql.Rows) (*Job, error) {
+	return scanJob(rows)
+}
+
+// Scans the jobColumns of a row into a job. Satisfied by both sql.Row and
+// sql.Rows.
+func scanJob(row interface {
+	Scan(dest ...interface{}) error
+}) (*Job, error) {
 	var (
-		id        sql.NullInt64
-		createdOn pq.NullTime
+		id             sql.NullInt64
+		createdOn      sql.NullTime
+		options        sql.NullString
+		tags           sql.NullString
+		callbackURL    sql.NullString
+		idempotencyKey sql.NullString
+		state          sql.NullString
+		cancelledOn    sql.NullTime
 	)
 
-	if err := row.Scan(&id, &createdOn); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
+	if err := row.Scan(&id, &createdOn, &options, &tags, &callbackURL, &idempotencyKey, &state, &cancelledOn); err != nil {
 		return nil, err
 	}
 
@@ -35,10 +61,29 @@ func getJobFromRow(row *sql.Row) (*Job, error) {
 		return nil, fmt.Errorf("Invalid result for get job")
 	}
 
-	return &Job{
-		Id:        common.JobId(id.Int64),
-		CreatedOn: createdOn.Time,
-	}, nil
+	job := &Job{
+		Id:             common.JobId(id.Int64),
+		CreatedOn:      createdOn.Time,
+		CallbackURL:    callbackURL.String,
+		IdempotencyKey: idempotencyKey.String,
+		State:          state.String,
+		CancelledOn:    cancelledOn.Time,
+	}
+	if job.State == "" {
+		job.State = common.JobStateRunning
+	}
+	if options.Valid && options.String != "" {
+		if err := json.Unmarshal([]byte(options.String), &job.Options); err != nil {
+			return nil, fmt.Errorf("Invalid options for job %d, %v", job.Id, err)
+		}
+	}
+	if tags.Valid && tags.String != "" {
+		if err := json.Unmarshal([]byte(tags.String), &job.Tags); err != nil {
+			return nil, fmt.Errorf("Invalid tags for job %d, %v", job.Id, err)
+		}
+	}
+
+	return job, nil
 }
 
 // Extracts the Job URLs from a Query of rows.
@@ -49,7 +94,7 @@ func getJobURLFromRows(rows *sql.Rows) (jobURL JobURL, err error) {
 		jobId       sql.NullInt64
 		urlId       sql.NullInt64
 		urlStr      sql.NullString
-		completedOn pq.NullTime
+		completedOn sql.NullTime
 	)
 
 	if err = rows.Scan(&jobId, &urlId, &urlStr, &completedOn); err != nil {
@@ -73,54 +118,140 @@ func getJobURLFromRows(rows *sql.Rows) (jobURL JobURL, err error) {
 	return jobURL, nil
 }
 
-// Create a new job entry with its URLS, returning a pointer to the newly
-// created Job.
-func (j *JobClient) CreateJobFromURLs(urls []string) (*Job, error) {
-	const queryInsertJob = `INSERT INTO job DEFAULT VALUES RETURNING id,created_on`
-	const queryInsertJobURLs = `INSERT INTO job_url (job_id, url_id) VALUES ($1, $2)`
+// Create a new job entry with its URLS and options, returning a pointer to
+// the newly created Job.
+func (j *JobClient) CreateJobFromURLs(urls []string, opts common.JobOptions) (*Job, error) {
+	spec := JobSpec{Options: opts}
+	for _, u := range urls {
+		spec.URLs = append(spec.URLs, JobSpecURL{URL: u})
+	}
+
+	job, _, err := j.CreateJob(spec)
+	return job, err
+}
+
+// Create a new job entry from the spec, returning a pointer to the newly
+// created Job. If the spec has an idempotency key, and a job was already
+// created with the key, the existing job will be returned instead, and
+// false for created.
+func (j *JobClient) CreateJob(spec JobSpec) (*Job, bool, error) {
+	const queryInsertJob = `
+INSERT INTO job (created_on, options, tags, callback_url, idempotency_key)
+	VALUES ($1, $2, $3, $4, $5)`
+	const queryJob = `SELECT ` + jobColumns + ` FROM job WHERE id = $1`
+	const queryInsertJobURLs = `INSERT INTO job_url (job_id, url_id, options) VALUES ($1, $2, $3)`
+
+	if spec.IdempotencyKey != "" {
+		if job, err := j.GetJobByIdempotencyKey(spec.IdempotencyKey); err != nil || job != nil {
+			return job, false, err
+		}
+	}
 
-	job, err := getJobFromRow(j.client.db.QueryRow(queryInsertJob))
+	options, err := json.Marshal(spec.Options)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	tags := spec.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	tagsJSON, err := json.Marshal(tags)
+	if err != nil {
+		return nil, false, err
+	}
+	var idempotencyKey interface{}
+	if spec.IdempotencyKey != "" {
+		idempotencyKey = spec.IdempotencyKey
+	}
+
+	id, err := j.client.insertId(queryInsertJob, time.Now().UTC(), string(options), string(tagsJSON), spec.CallbackURL, idempotencyKey)
+	if err != nil {
+		if spec.IdempotencyKey != "" {
+			// A concurrent request with the same key may of created the
+			// job first, violating the key's unique index.
+			if job, getErr := j.GetJobByIdempotencyKey(spec.IdempotencyKey); getErr == nil && job != nil {
+				return job, false, nil
+			}
+		}
+		return nil, false, err
+	}
+
+	job, err := getJobFromRow(j.client.queryRow(queryJob, id))
+	if err != nil {
+		return nil, false, err
 	}
 	if job == nil {
-		return nil, fmt.Errorf("Failed to get created job")
+		return nil, false, fmt.Errorf("Failed to get created job")
 	}
 
-	job.URLs = make([]JobURL, 0, len(urls))
-	for _, u := range urls {
-		url, err := j.client.URLClient().GetOrAddURLByURL(u, common.DefaultURLMime)
+	job.URLs = make([]JobURL, 0, len(spec.URLs))
+	for _, u := range spec.URLs {
+		url, err := j.client.URLClient().GetOrAddURLByURL(u.URL, common.DefaultURLMime)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 
-		if _, err := j.client.db.Exec(queryInsertJobURLs, job.Id, url.Id); err != nil {
-			return nil, err
+		var urlOptions sql.NullString
+		if u.Options != nil {
+			b, err := json.Marshal(u.Options)
+			if err != nil {
+				return nil, false, err
+			}
+			urlOptions = sql.NullString{String: string(b), Valid: true}
 		}
-		job.URLs = append(job.URLs, JobURL{JobId: job.Id, URLId: url.Id})
+
+		if _, err := j.client.exec(queryInsertJobURLs, job.Id, url.Id, urlOptions); err != nil {
+			return nil, false, err
+		}
+		job.URLs = append(job.URLs, JobURL{JobId: job.Id, URLId: url.Id, URL: u.URL})
 	}
 
-	return job, nil
+	return job, true, nil
+}
+
+// Searches for the job created with the idempotency key, and returns it and
+// its URLs if the job exists. Nil is returned if the job does not exist.
+func (j *JobClient) GetJobByIdempotencyKey(key string) (*Job, error) {
+	const queryJobByKey = `SELECT id FROM job WHERE idempotency_key = $1`
+
+	var id sql.NullInt64
+	if err := j.client.queryRow(queryJobByKey, key).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return j.GetJob(common.JobId(id.Int64))
 }
 
 // Searches for a job, and returns it and its URLs if the job exist. Nil is return if
 // the job does not exist
 func (j *JobClient) GetJob(id common.JobId) (*Job, error) {
-	const queryJob = `SELECT id,created_on FROM job WHERE id = $1`
+	const queryJob = `SELECT ` + jobColumns + ` FROM job WHERE id = $1`
 
-	job, err := getJobFromRow(j.client.db.QueryRow(queryJob, id))
+	job, err := getJobFromRow(j.client.queryRow(queryJob, id))
 	if err != nil || job == nil {
 		return nil, err
 	}
 
+	if err := j.loadJobURLs(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Loads the URLs of the job, and the number of its parked items.
+func (j *JobClient) loadJobURLs(job *Job) error {
 	const queryJobURLs = `
 SELECT job_url.job_id, job_url.url_id, url.url, job_url.completed_on
 FROM job_url
 LEFT JOIN url AS url on job_url.url_id = url.id
 WHERE job_url.job_id = $1`
-	rows, err := j.client.db.Query(queryJobURLs, job.Id)
+	rows, err := j.client.query(queryJobURLs, job.Id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
@@ -128,15 +259,351 @@ WHERE job_url.job_id = $1`
 	for rows.Next() {
 		jobURL, err := getJobURLFromRows(rows)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		job.URLs = append(job.URLs, jobURL)
 	}
 	if err = rows.Err(); err != nil {
+		return err
+	}
+	// Closed before the next query, since SQLite only has a single connection.
+	rows.Close()
+
+	job.Parked, err = j.client.ParkedClient().Count(job.Id)
+	return err
+}
+
+// Sort orders of listed jobs.
+const (
+	// Sorts jobs by the time stamp they were created on.
+	JobSortCreated = "created"
+
+	// Sorts jobs by their id.
+	JobSortId = "id"
+
+	// Sorts jobs by their state.
+	JobSortState = "state"
+)
+
+// Maximum number of jobs listed in a single page.
+const MaxJobListLimit = 500
+
+// Filters, sort order, and page of jobs to be listed. Zero values of the
+// filters match all jobs.
+type JobListQuery struct {
+	// Only jobs in the state, e.g: common.JobStateCompleted
+	State string
+
+	// Only jobs created on or after the time stamp
+	CreatedAfter time.Time
+
+	// Only jobs created before the time stamp
+	CreatedBefore time.Time
+
+	// Only jobs scheduled with the tag
+	Tag string
+
+	// Only jobs with an origin URL containing the value. Not case
+	// sensitive.
+	URL string
+
+	// Order the jobs are sorted by, e.g: JobSortCreated. Defaults to
+	// JobSortCreated.
+	Sort string
+
+	// Sort the jobs in ascending order, instead of descending.
+	Ascending bool
+
+	// Maximum number of jobs to return, up to MaxJobListLimit. Defaults
+	// to MaxJobListLimit.
+	Limit int
+
+	// Number of matching jobs to skip.
+	Offset int
+}
+
+// Lists the jobs matching the query's filters, with their URLs. The total
+// number of jobs matching the filters, regardless of the page, is also
+// returned.
+func (j *JobClient) List(q JobListQuery) ([]*Job, int, error) {
+	where, args, err := jobListWhere(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total sql.NullInt64
+	if err := j.client.queryRow(`SELECT count(*) FROM job`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	var order string
+	switch q.Sort {
+	case JobSortCreated, "":
+		order = "created_on"
+	case JobSortId:
+		order = "id"
+	case JobSortState:
+		order = "state"
+	default:
+		return nil, 0, fmt.Errorf("Unknown job sort %s", q.Sort)
+	}
+	dir := " DESC"
+	if q.Ascending {
+		dir = " ASC"
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > MaxJobListLimit {
+		limit = MaxJobListLimit
+	}
+	offset := q.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	queryJobs := fmt.Sprintf(`SELECT %s FROM job%s ORDER BY %s%s, id%s LIMIT $%d OFFSET $%d`,
+		jobColumns, where, order, dir, dir, len(args)+1, len(args)+2)
+	rows, err := j.client.query(queryJobs, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := getJobFromRows(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	// Closed before the job's URLs are queried, since SQLite only has a
+	// single connection.
+	rows.Close()
+
+	for _, job := range jobs {
+		if err := j.loadJobURLs(job); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return jobs, int(total.Int64), nil
+}
+
+// Returns the where clause, and its arguments, of the job list query's
+// filters. The states are matched the same way as Job.Status reports them.
+func jobListWhere(q JobListQuery) (string, []interface{}, error) {
+	const incomplete = `EXISTS (SELECT 1 FROM job_url WHERE job_url.job_id = job.id AND job_url.completed_on IS NULL)`
+
+	conds := []string{}
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	switch q.State {
+	case "":
+	case common.JobStateCancelled:
+		conds = append(conds, "job.state = "+arg(common.JobStateCancelled))
+	case common.JobStateCompleted:
+		conds = append(conds, "job.state <> "+arg(common.JobStateCancelled)+" AND NOT "+incomplete)
+	case common.JobStateRunning, common.JobStatePaused:
+		conds = append(conds, "job.state = "+arg(q.State)+" AND "+incomplete)
+	default:
+		return "", nil, fmt.Errorf("Unknown job state %s", q.State)
+	}
+
+	if !q.CreatedAfter.IsZero() {
+		conds = append(conds, "job.created_on >= "+arg(q.CreatedAfter.UTC()))
+	}
+	if !q.CreatedBefore.IsZero() {
+		conds = append(conds, "job.created_on < "+arg(q.CreatedBefore.UTC()))
+	}
+	if q.Tag != "" {
+		// Tags are stored as a JSON list, so the tag is matched with its
+		// JSON encoding, including its quotes.
+		tag, err := json.Marshal(q.Tag)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, `job.tags LIKE `+arg("%"+escapeLike(string(tag))+"%")+` ESCAPE '\'`)
+	}
+	if q.URL != "" {
+		conds = append(conds, `EXISTS (SELECT 1 FROM job_url JOIN url ON url.id = job_url.url_id
+	WHERE job_url.job_id = job.id AND lower(url.url) LIKE `+arg("%"+escapeLike(strings.ToLower(q.URL))+"%")+` ESCAPE '\')`)
+	}
+
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// Escapes the LIKE wildcards of the value, so it is matched literally with
+// a '\' escape character.
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// Replaces the LIKE wildcards, and escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Returns the options of a job. Nil is returned if the job does not exist.
+func (j *JobClient) GetOptions(id common.JobId) (*common.JobOptions, error) {
+	const queryJobOptions = `SELECT options FROM job WHERE id = $1`
+
+	var options sql.NullString
+	if err := j.client.queryRow(queryJobOptions, id).Scan(&options); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
 		return nil, err
 	}
 
-	return job, err
+	opts := &common.JobOptions{}
+	if options.Valid && options.String != "" {
+		if err := json.Unmarshal([]byte(options.String), opts); err != nil {
+			return nil, fmt.Errorf("Invalid options for job %d, %v", id, err)
+		}
+	}
+	return opts, nil
+}
+
+// Returns the options of a job's origin URL, and its descendants, are
+// crawled with. These are the options of the job, unless the URL was
+// scheduled with its own. Nil is returned if the job does not exist.
+func (j *JobClient) GetOriginOptions(id common.JobId, originId common.URLId) (*common.JobOptions, error) {
+	const queryOriginOptions = `
+SELECT options FROM job_url WHERE job_id = $1 AND url_id = $2 AND options IS NOT NULL`
+
+	var options sql.NullString
+	if err := j.client.queryRow(queryOriginOptions, id, originId).Scan(&options); err != nil {
+		if err == sql.ErrNoRows {
+			return j.GetOptions(id)
+		}
+		return nil, err
+	}
+
+	opts := &common.JobOptions{}
+	if err := json.Unmarshal([]byte(options.String), opts); err != nil {
+		return nil, fmt.Errorf("Invalid options for job %d URL %d, %v", id, originId, err)
+	}
+	return opts, nil
+}
+
+// Returns the state the job was set to, either common.JobStateRunning,
+// common.JobStatePaused, or common.JobStateCancelled. Empty is returned if
+// the job does not exist.
+func (j *JobClient) GetState(id common.JobId) (string, error) {
+	const queryJobState = `SELECT state FROM job WHERE id = $1`
+
+	var state sql.NullString
+	if err := j.client.queryRow(queryJobState, id).Scan(&state); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+	return state.String, nil
+}
+
+// Cancels the job, so its remaining URLs are not crawled, and deletes its
+// pending URL records, and parked items. False is returned if the job does
+// not exist, has already been cancelled, or all of its URLs have already
+// been crawled.
+func (j *JobClient) Cancel(id common.JobId) (bool, error) {
+	const queryJobCancel = `
+UPDATE job SET state = $2, cancelled_on = $3
+	WHERE id = $1 AND state <> $2
+	AND EXISTS (SELECT 1 FROM job_url WHERE job_id = $1 AND completed_on IS NULL)`
+	const queryJobDeletePending = `DELETE FROM url_pending WHERE job_id = $1`
+	const queryJobDeleteParked = `DELETE FROM parked_item WHERE job_id = $1`
+
+	res, err := j.client.exec(queryJobCancel, id, common.JobStateCancelled, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		return false, nil
+	}
+
+	if _, err := j.client.exec(queryJobDeletePending, id); err != nil {
+		return true, err
+	}
+	if _, err := j.client.exec(queryJobDeleteParked, id); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Pauses the running job, so its queued items are parked until it is
+// resumed. False is returned if the job does not exist, is not running, or
+// all of its URLs have already been crawled.
+func (j *JobClient) Pause(id common.JobId) (bool, error) {
+	const queryJobPause = `
+UPDATE job SET state = $2
+	WHERE id = $1 AND state = $3
+	AND EXISTS (SELECT 1 FROM job_url WHERE job_id = $1 AND completed_on IS NULL)`
+
+	return j.setState(queryJobPause, id, common.JobStatePaused, common.JobStateRunning)
+}
+
+// Resumes the paused job. The job's parked items need to be taken, and
+// queued again by the caller. False is returned if the job does not exist,
+// or is not paused.
+func (j *JobClient) Resume(id common.JobId) (bool, error) {
+	const queryJobResume = `UPDATE job SET state = $2 WHERE id = $1 AND state = $3`
+
+	return j.setState(queryJobResume, id, common.JobStateRunning, common.JobStatePaused)
+}
+
+// Executes the query updating the state of the job, and returns if the job
+// was updated.
+func (j *JobClient) setState(query string, args ...interface{}) (bool, error) {
+	res, err := j.client.exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Reserves a page of the job's max pages to be crawled. False is returned if
+// the job has already crawled its max pages, or downloaded its max bytes. A
+// max of zero is unlimited.
+func (j *JobClient) ReservePage(id common.JobId, maxPages int, maxBytes int64) (bool, error) {
+	const queryJobReservePage = `
+UPDATE job SET pages_crawled = pages_crawled + 1
+	WHERE id = $1 AND ($2 = 0 OR pages_crawled < $2) AND ($3 = 0 OR bytes_crawled < $3)`
+
+	res, err := j.client.exec(queryJobReservePage, id, maxPages, maxBytes)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Adds to the number of content bytes downloaded by the job.
+func (j *JobClient) AddBytes(id common.JobId, n int64) error {
+	const queryJobAddBytes = `UPDATE job SET bytes_crawled = bytes_crawled + $2 WHERE id = $1`
+
+	if _, err := j.client.exec(queryJobAddBytes, id, n); err != nil {
+		return err
+	}
+	return nil
 }
 
 // Returns if the Job id matches an existing job.
@@ -144,7 +611,7 @@ func (j *JobClient) JobExists(id common.JobId) (bool, error) {
 	const queryJobExists = `SELECT exists(SELECT 1 FROM job WHERE id = $1)`
 
 	var exists sql.NullBool
-	if err := j.client.db.QueryRow(queryJobExists, id).Scan(&exists); err != nil {
+	if err := j.client.queryRow(queryJobExists, id).Scan(&exists); err != nil {
 		return false, err
 	}
 
@@ -155,58 +622,297 @@ func (j *JobClient) JobExists(id common.JobId) (bool, error) {
 // Queries the result URLs for a job by id, and generates the JobResult object.
 // Results will be grouped in list under the refer URL which those result URLs
 // were found from.  Duplicate results under the same refer URL will be removed,
-// and not included in the JobResults returned.
-func (j *JobClient) Result(id common.JobId, mimeFilter string) (common.JobResults, error) {
-	if exists, err := j.JobExists(id); err != nil {
+// and not included in the JobResults returned. Only results matching the
+// query's filters are included.
+func (j *JobClient) Result(id common.JobId, q ResultQuery) (common.JobResults, error) {
+	result := make(common.JobResults)
+	knownResults := make(map[string]map[string]struct{})
+	err := j.EachResult(id, q, func(r *JobResult) error {
+		if _, ok := result[r.Refer]; !ok {
+			result[r.Refer] = []string{}
+			knownResults[r.Refer] = make(map[string]struct{})
+		} else {
+			if _, ok := knownResults[r.Refer][r.URL]; ok {
+				// Prevent duplicate entries
+				return nil
+			}
+		}
+		knownResults[r.Refer][r.URL] = struct{}{}
+
+		result[r.Refer] = append(result[r.Refer], r.URL)
+		return nil
+	})
+	if err != nil {
 		return nil, err
+	}
+
+	return result, nil
+}
+
+// Links between a result and the URL it was found on, used to filter results.
+const (
+	// The result's host is the same as the URL it was found on.
+	ResultLinksInternal = "internal"
+
+	// The result's host is different from the URL it was found on.
+	ResultLinksExternal = "external"
+)
+
+// Range of HTTP status codes, including both the min and max.
+type StatusRange struct {
+	Min int
+	Max int
+}
+
+// Filters and page of a job's results to be queried. Zero values of the
+// filters match all results. Filters with multiple values match results
+// matching any of the values, and results must match all of the filters.
+type ResultQuery struct {
+	// Prefixes of the result's mime type, e.g: image
+	Mimes []string
+
+	// Hosts of the result's URL, including the port if the URL has one,
+	// e.g: example.com. Not case sensitive.
+	Hosts []string
+
+	// Glob pattern of the result's URL. A '*' matches any characters, and
+	// a '?' matches a single character, e.g: http://example.com/*.png
+	URLGlob string
+
+	// Regular expression of the result's URL. On Postgres the expression
+	// is a POSIX regular expression, and on SQLite uses Go's syntax.
+	URLRegexp string
+
+	// Number of links from the job's URL to the result, e.g: 1 for the
+	// results found on the job's URL.
+	Levels []int
+
+	// Ranges of the HTTP status code of the result's last fetch.
+	Statuses []StatusRange
+
+	// URL the result was found on.
+	Refer string
+
+	// If the result links within the same host, or to another host, either
+	// ResultLinksInternal or ResultLinksExternal.
+	Links string
+
+	// Only results added after the cursor, the id of a previous result.
+	After int64
+
+	// Maximum number of results to return. Zero is unlimited.
+	Limit int
+}
+
+// Returns the conditions, and their arguments, of the result query's
+// filters. Each condition is on a column of the job_result, url, or refer
+// url tables. The arguments' placeholders are numbered following first.
+func (j *JobClient) resultWhere(q ResultQuery, first int) (string, []interface{}, error) {
+	conds := []string{}
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", first+len(args)-1)
+	}
+	anyOf := func(n int, cond func(i int) string) {
+		if n == 0 {
+			return
+		}
+		or := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			or = append(or, cond(i))
+		}
+		conds = append(conds, "("+strings.Join(or, " OR ")+")")
+	}
+
+	anyOf(len(q.Mimes), func(i int) string {
+		return `url.mime LIKE ` + arg(escapeLike(q.Mimes[i])+"%") + ` ESCAPE '\'`
+	})
+	anyOf(len(q.Hosts), func(i int) string {
+		return "url.host = " + arg(strings.ToLower(q.Hosts[i]))
+	})
+	anyOf(len(q.Levels), func(i int) string {
+		return "job_result.level = " + arg(q.Levels[i])
+	})
+	anyOf(len(q.Statuses), func(i int) string {
+		return "url.status_code BETWEEN " + arg(q.Statuses[i].Min) + " AND " + arg(q.Statuses[i].Max)
+	})
+
+	if q.URLGlob != "" {
+		conds = append(conds, `url.url LIKE `+arg(globToLike(q.URLGlob))+` ESCAPE '\'`)
+	}
+	if q.URLRegexp != "" {
+		conds = append(conds, j.client.dialect.regexp("url.url", arg(q.URLRegexp)))
+	}
+	if q.Refer != "" {
+		// The refer's id is looked up first, so the job_result_pair index
+		// can be used to find the results.
+		conds = append(conds, "job_result.refer_id = (SELECT id FROM url WHERE url = "+arg(q.Refer)+")")
+	}
+
+	switch q.Links {
+	case "":
+	case ResultLinksInternal:
+		conds = append(conds, "url.host = refer.host")
+	case ResultLinksExternal:
+		conds = append(conds, "url.host <> refer.host")
+	default:
+		return "", nil, fmt.Errorf("Unknown result links %s", q.Links)
+	}
+
+	if len(conds) == 0 {
+		return "", args, nil
+	}
+	return " AND " + strings.Join(conds, " AND "), args, nil
+}
+
+// Converts the glob pattern into a LIKE pattern with a '\' escape character.
+// A '*' matches any characters, and a '?' matches a single character. All
+// other characters are matched literally.
+func globToLike(glob string) string {
+	var like bytes.Buffer
+	for _, r := range glob {
+		switch r {
+		case '*':
+			like.WriteRune('%')
+		case '?':
+			like.WriteRune('_')
+		case '%', '_', '\\':
+			like.WriteRune('\\')
+			like.WriteRune(r)
+		default:
+			like.WriteRune(r)
+		}
+	}
+	return like.String()
+}
+
+// Queries the result URLs for a job by id, calling fn with each result as it
+// is read, in the order the results were added. The results are not held in
+// memory, so jobs with any number of results can be read. If fn returns an
+// error, no more results are read and the error is returned. Since the rows
+// stay open while fn is called, fn must not make other storage queries.
+func (j *JobClient) EachResult(id common.JobId, q ResultQuery, fn func(*JobResult) error) error {
+	if exists, err := j.JobExists(id); err != nil {
+		return err
 	} else if exists == false {
-		return nil, fmt.Errorf("Job does not exist")
+		return fmt.Errorf("Job does not exist")
+	}
+
+	where, whereArgs, err := j.resultWhere(q, 3)
+	if err != nil {
+		return err
 	}
 
-	const queryJobResult = `
-SELECT refer.url as refer, url.url as url, url.mime as mime
+	queryJobResult := `
+SELECT job_result.id, job_result.refer_id, refer.url as refer, job_result.url_id, url.url as url, url.mime as mime, url.status_code, job_result.level
 FROM job_result
 LEFT JOIN url AS url on job_result.url_id = url.id
 LEFT join url as refer on job_result.refer_id = refer.id
-WHERE job_result.job_id = $1 and url.mime LIKE $2`
+WHERE job_result.job_id = $1 AND job_result.id > $2` + where + `
+ORDER BY job_result.id`
+	args := append([]interface{}{id, q.After}, whereArgs...)
+	if q.Limit > 0 {
+		queryJobResult += fmt.Sprintf(`
+LIMIT $%d`, len(args)+1)
+		args = append(args, q.Limit)
+	}
 
-	rows, err := j.client.db.Query(queryJobResult, id, mimeFilter+"%")
+	rows, err := j.client.query(queryJobResult, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	result := make(common.JobResults)
-	knownResults := make(map[string]map[string]struct{})
 	for rows.Next() {
-		var refer sql.NullString
-		var u sql.NullString
-		var mime sql.NullString
-		if err := rows.Scan(&refer, &u, &mime); err != nil {
-			return nil, err
+		var (
+			resultId   sql.NullInt64
+			referId    sql.NullInt64
+			refer      sql.NullString
+			urlId      sql.NullInt64
+			u          sql.NullString
+			mime       sql.NullString
+			statusCode sql.NullInt64
+			level      sql.NullInt64
+		)
+		if err := rows.Scan(&resultId, &referId, &refer, &urlId, &u, &mime, &statusCode, &level); err != nil {
+			return err
 		}
 		if !refer.Valid || !u.Valid {
 			// Invalid mimes are ignored, because they might be null, if the URL
 			// wasn't crawled deeper.
-			return nil, fmt.Errorf("Invalid job result for job id %d", id)
+			return fmt.Errorf("Invalid job result for job id %d", id)
 		}
 
-		if _, ok := result[refer.String]; !ok {
-			result[refer.String] = []string{}
-			knownResults[refer.String] = make(map[string]struct{})
-		} else {
-			if _, ok := knownResults[refer.String][u.String]; ok {
-				// Prevent duplicate entries
-				continue
-			}
+		err := fn(&JobResult{
+			Id:         resultId.Int64,
+			ReferId:    referId.Int64,
+			Refer:      refer.String,
+			URLId:      urlId.Int64,
+			URL:        u.String,
+			Mime:       mime.String,
+			StatusCode: int(statusCode.Int64),
+			Level:      int(level.Int64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Queries the result URLs for a job by id which failed to be fetched. A URL
+// failed to be fetched if the site responded with a 4xx or 5xx status, or the
+// request failed, e.g: DNS, TLS, or timeout errors. The broken links are
+// grouped in a list under the refer URL which they were found from.
+func (j *JobClient) BrokenLinks(id common.JobId) (map[string][]BrokenLink, error) {
+	if exists, err := j.JobExists(id); err != nil {
+		return nil, err
+	} else if exists == false {
+		return nil, fmt.Errorf("Job does not exist")
+	}
+
+	const queryJobBrokenLinks = `
+SELECT refer.url as refer, url.url as url, url.status_code, url.fetch_error, url.fetch_error_kind
+FROM job_result
+LEFT JOIN url AS url on job_result.url_id = url.id
+LEFT join url as refer on job_result.refer_id = refer.id
+WHERE job_result.job_id = $1 AND (url.status_code >= 400 OR url.fetch_error <> '')
+ORDER BY refer.url, url.url`
+
+	rows, err := j.client.query(queryJobBrokenLinks, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make(map[string][]BrokenLink)
+	for rows.Next() {
+		var (
+			refer      sql.NullString
+			u          sql.NullString
+			statusCode sql.NullInt64
+			fetchError sql.NullString
+			errorKind  sql.NullString
+		)
+		if err := rows.Scan(&refer, &u, &statusCode, &fetchError, &errorKind); err != nil {
+			return nil, err
+		}
+		if !refer.Valid || !u.Valid {
+			return nil, fmt.Errorf("Invalid job broken link for job id %d", id)
 		}
-		knownResults[refer.String][u.String] = struct{}{}
 
-		result[refer.String] = append(result[refer.String], u.String)
+		links[refer.String] = append(links[refer.String], BrokenLink{
+			URL:        u.String,
+			StatusCode: int(statusCode.Int64),
+			Error:      fetchError.String,
+			ErrorKind:  errorKind.String,
+		})
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	return links, nil
 }
@@ -0,0 +1,507 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCreateAndGetJob(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+
+	job, err := sc.JobClient().CreateJobFromURLs([]string{"http://example.com", "http://example.org"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	require.NotNil(t, job, "Expect job")
+	assert.Len(t, job.URLs, 2, "Expect job URLs")
+
+	got, err := sc.JobClient().GetJob(job.Id)
+	require.Nil(t, err, "Expect no error getting job")
+	require.NotNil(t, got, "Expect job to exist")
+	assert.Equal(t, job.Id, got.Id, "Expect job ids to match")
+	require.Len(t, got.URLs, 2, "Expect job URLs")
+	assert.Equal(t, "http://example.com", got.URLs[0].URL, "Expect URL to match")
+	assert.False(t, got.URLs[0].Completed, "Expect URL not complete")
+
+	status := got.Status()
+	assert.Equal(t, 2, status.Pending, "Expect job URLs pending")
+
+	missing, err := sc.JobClient().GetJob(job.Id + 1)
+	assert.Nil(t, err, "Expect no error for missing job")
+	assert.Nil(t, missing, "Expect no job")
+}
+
+// Adds the result, failing the test if it was not added.
+func addTestResult(t *testing.T, urlClient *URLClient, jobId common.JobId, referId, urlId common.URLId, level int) {
+	added, err := urlClient.AddResult(jobId, referId, urlId, level)
+	require.Nil(t, err, "Expect no error adding result")
+	require.True(t, added, "Expect result added")
+}
+
+func TestJobResult(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+
+	urlClient := sc.URLClient()
+	job, err := sc.JobClient().CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	origin := job.URLs[0].URLId
+
+	page, _ := urlClient.Add("http://example.com/page", "text/html")
+	img, _ := urlClient.Add("http://example.com/img.png", "image/png")
+	addTestResult(t, urlClient, job.Id, origin, page.Id, 1)
+	addTestResult(t, urlClient, job.Id, origin, img.Id, 1)
+	added, err := urlClient.AddResult(job.Id, origin, img.Id, 1)
+	require.Nil(t, err, "Expect no error adding duplicate result")
+	assert.False(t, added, "Expect duplicate result ignored")
+
+	result, err := sc.JobClient().Result(job.Id, ResultQuery{})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.Equal(t, common.JobResults{
+		"http://example.com": {"http://example.com/page", "http://example.com/img.png"},
+	}, result, "Expect all results")
+
+	result, err = sc.JobClient().Result(job.Id, ResultQuery{Mimes: []string{"image"}})
+	require.Nil(t, err, "Expect no error getting result")
+	assert.Equal(t, common.JobResults{
+		"http://example.com": {"http://example.com/img.png"},
+	}, result, "Expect only image results")
+
+	_, err = sc.JobClient().Result(job.Id+1, ResultQuery{})
+	assert.NotNil(t, err, "Expect error for missing job")
+}
+
+func TestJobEachResult(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+
+	urlClient := sc.URLClient()
+	job, err := sc.JobClient().CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	origin := job.URLs[0].URLId
+
+	urls := []string{"http://example.com/a", "http://example.com/b.png", "http://example.com/c"}
+	for _, u := range urls {
+		rec, _ := urlClient.Add(u, common.GuessURLsMime(u))
+		addTestResult(t, urlClient, job.Id, origin, rec.Id, 1)
+	}
+
+	each := func(q ResultQuery) []*JobResult {
+		results := []*JobResult{}
+		err := sc.JobClient().EachResult(job.Id, q, func(r *JobResult) error {
+			results = append(results, r)
+			return nil
+		})
+		require.Nil(t, err, "Expect no error reading results")
+		return results
+	}
+
+	all := each(ResultQuery{})
+	require.Len(t, all, 3, "Expect all results")
+	for i, r := range all {
+		assert.Equal(t, urls[i], r.URL, "Expect results in the order added")
+		assert.Equal(t, "http://example.com", r.Refer, "Expect refer URL")
+		if i > 0 {
+			assert.True(t, r.Id > all[i-1].Id, "Expect increasing cursor")
+		}
+	}
+
+	page := each(ResultQuery{Limit: 2})
+	assert.Equal(t, all[:2], page, "Expect first page")
+	page = each(ResultQuery{After: page[1].Id, Limit: 2})
+	assert.Equal(t, all[2:], page, "Expect results after cursor")
+	assert.Len(t, each(ResultQuery{After: all[2].Id}), 0, "Expect no results after last cursor")
+
+	images := each(ResultQuery{Mimes: []string{"image"}})
+	require.Len(t, images, 1, "Expect only image results")
+	assert.Equal(t, "image/png", images[0].Mime, "Expect image mime")
+
+	err = sc.JobClient().EachResult(job.Id, ResultQuery{}, func(r *JobResult) error {
+		return fmt.Errorf("stop")
+	})
+	assert.NotNil(t, err, "Expect fn's error returned")
+
+	err = sc.JobClient().EachResult(job.Id+1, ResultQuery{}, func(r *JobResult) error { return nil })
+	assert.NotNil(t, err, "Expect error for missing job")
+}
+
+func TestJobResultFilters(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+
+	urlClient := sc.URLClient()
+	job, err := sc.JobClient().CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	origin := job.URLs[0].URLId
+
+	page, _ := urlClient.Add("http://example.com/about", "text/html")
+	img, _ := urlClient.Add("http://example.com/img/logo.png", "image/png")
+	external, _ := urlClient.Add("http://Other.example.org:8080/a_b", "text/html")
+	style, _ := urlClient.Add("http://example.com/about.css", "text/css")
+	addTestResult(t, urlClient, job.Id, origin, page.Id, 1)
+	addTestResult(t, urlClient, job.Id, origin, img.Id, 1)
+	addTestResult(t, urlClient, job.Id, origin, external.Id, 1)
+	addTestResult(t, urlClient, job.Id, page.Id, style.Id, 2)
+
+	require.Nil(t, urlClient.MarkChecked(page.Id, "", &Fetch{StatusCode: 200}), "Expect no error marking checked")
+	require.Nil(t, urlClient.MarkChecked(img.Id, "", &Fetch{StatusCode: 404}), "Expect no error marking checked")
+	require.Nil(t, urlClient.MarkChecked(external.Id, "", &Fetch{StatusCode: 503}), "Expect no error marking checked")
+
+	urls := func(q ResultQuery) []string {
+		results := []string{}
+		err := sc.JobClient().EachResult(job.Id, q, func(r *JobResult) error {
+			results = append(results, r.URL)
+			return nil
+		})
+		require.Nil(t, err, "Expect no error reading results")
+		return results
+	}
+
+	assert.Equal(t, []string{"http://example.com/img/logo.png", "http://example.com/about.css"},
+		urls(ResultQuery{Mimes: []string{"image", "text/css"}}), "Expect any of the mimes")
+	assert.Equal(t, []string{"http://Other.example.org:8080/a_b"},
+		urls(ResultQuery{Hosts: []string{"other.EXAMPLE.org:8080"}}), "Expect host without case")
+	assert.Equal(t, []string{"http://example.com/img/logo.png", "http://example.com/about.css"},
+		urls(ResultQuery{URLGlob: "http://example.com/*.???"}), "Expect URLs matching glob")
+	assert.Equal(t, []string{"http://Other.example.org:8080/a_b"},
+		urls(ResultQuery{URLGlob: "*/a_b"}), "Expect glob's wildcards only")
+	assert.Len(t, urls(ResultQuery{URLGlob: "*/a?b_"}), 0, "Expect glob's LIKE wildcards escaped")
+	assert.Equal(t, []string{"http://example.com/about", "http://example.com/about.css"},
+		urls(ResultQuery{URLRegexp: `/about(\.css)?$`}), "Expect URLs matching regexp")
+	assert.Equal(t, []string{"http://example.com/about.css"},
+		urls(ResultQuery{Levels: []int{2}}), "Expect results of level")
+	assert.Equal(t, []string{"http://example.com/img/logo.png", "http://Other.example.org:8080/a_b"},
+		urls(ResultQuery{Statuses: []StatusRange{{404, 404}, {500, 599}}}), "Expect results of statuses")
+	assert.Equal(t, []string{"http://example.com/about.css"},
+		urls(ResultQuery{Refer: "http://example.com/about"}), "Expect results of refer")
+	assert.Len(t, urls(ResultQuery{Refer: "http://example.com/unknown"}), 0, "Expect no results of unknown refer")
+	assert.Equal(t, []string{"http://Other.example.org:8080/a_b"},
+		urls(ResultQuery{Links: ResultLinksExternal}), "Expect external links")
+	assert.Equal(t, []string{"http://example.com/about", "http://example.com/about.css"},
+		urls(ResultQuery{Links: ResultLinksInternal, Mimes: []string{"text"}}), "Expect all filters matched")
+
+	err = sc.JobClient().EachResult(job.Id, ResultQuery{Links: "other"}, func(r *JobResult) error { return nil })
+	assert.NotNil(t, err, "Expect error for unknown links")
+}
+
+func TestJobBrokenLinks(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+
+	urlClient := sc.URLClient()
+	job, err := sc.JobClient().CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	origin := job.URLs[0].URLId
+
+	ok, _ := urlClient.Add("http://example.com/ok", "text/html")
+	missing, _ := urlClient.Add("http://example.com/missing", "text/html")
+	unresolved, _ := urlClient.Add("http://unresolved.example.com", "")
+	unchecked, _ := urlClient.Add("http://example.com/unchecked", "")
+	for _, u := range []*URL{ok, missing, unresolved, unchecked} {
+		addTestResult(t, urlClient, job.Id, origin, u.Id, 1)
+	}
+
+	require.Nil(t, urlClient.MarkChecked(ok.Id, "", &Fetch{StatusCode: 200}), "Expect no error marking checked")
+	require.Nil(t, urlClient.MarkChecked(missing.Id, "text/html", &Fetch{StatusCode: 404}), "Expect no error marking checked")
+	require.Nil(t, urlClient.MarkFetchFailed(unresolved.Id, &Fetch{Error: "no such host", ErrorKind: common.FetchErrorDNS}), "Expect no error marking failed")
+
+	links, err := sc.JobClient().BrokenLinks(job.Id)
+	require.Nil(t, err, "Expect no error getting broken links")
+	assert.Equal(t, map[string][]BrokenLink{
+		"http://example.com": {
+			{URL: "http://example.com/missing", StatusCode: 404},
+			{URL: "http://unresolved.example.com", Error: "no such host", ErrorKind: common.FetchErrorDNS},
+		},
+	}, links, "Expect only broken links")
+
+	_, err = sc.JobClient().BrokenLinks(job.Id + 1)
+	assert.NotNil(t, err, "Expect error for missing job")
+}
+
+func TestJobOptions(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+
+	opts := common.JobOptions{
+		MaxDepth:     3,
+		MaxPages:     10,
+		CacheMaxAge:  time.Hour,
+		AllowedMimes: []string{"text/html"},
+		ForceCrawl:   true,
+	}
+	job, err := sc.JobClient().CreateJobFromURLs([]string{"http://example.com"}, opts)
+	require.Nil(t, err, "Expect no error creating job")
+
+	got, err := sc.JobClient().GetOptions(job.Id)
+	require.Nil(t, err, "Expect no error getting options")
+	assert.Equal(t, &opts, got, "Expect options stored")
+
+	gotJob, err := sc.JobClient().GetJob(job.Id)
+	require.Nil(t, err, "Expect no error getting job")
+	assert.Equal(t, opts, gotJob.Options, "Expect job options")
+
+	missing, err := sc.JobClient().GetOptions(job.Id + 1)
+	assert.Nil(t, err, "Expect no error for missing job")
+	assert.Nil(t, missing, "Expect no options")
+
+	cache := NewJobOptionsCache(sc, 0)
+	cached, err := cache.Get(job.Id, job.URLs[0].URLId)
+	require.Nil(t, err, "Expect no error getting cached options")
+	assert.Equal(t, &opts, cached, "Expect cached options")
+	_, err = cache.Get(job.Id+1, job.URLs[0].URLId)
+	assert.NotNil(t, err, "Expect error for missing job")
+}
+
+func TestCreateJobSpec(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+
+	urlOpts := &common.JobOptions{MaxDepth: 1}
+	spec := JobSpec{
+		URLs: []JobSpecURL{
+			{URL: "http://example.com"},
+			{URL: "http://example.org", Options: urlOpts},
+		},
+		Options:        common.JobOptions{MaxDepth: 3},
+		Tags:           []string{"nightly", "docs"},
+		CallbackURL:    "https://example.net/done",
+		IdempotencyKey: "abc",
+	}
+	job, created, err := sc.JobClient().CreateJob(spec)
+	require.Nil(t, err, "Expect no error creating job")
+	assert.True(t, created, "Expect job created")
+	require.Len(t, job.URLs, 2, "Expect job URLs")
+	assert.Equal(t, "http://example.org", job.URLs[1].URL, "Expect job URL")
+
+	got, err := sc.JobClient().GetJob(job.Id)
+	require.Nil(t, err, "Expect no error getting job")
+	assert.Equal(t, []string{"nightly", "docs"}, got.Tags, "Expect tags")
+	assert.Equal(t, "https://example.net/done", got.CallbackURL, "Expect callback URL")
+	assert.Equal(t, "abc", got.IdempotencyKey, "Expect idempotency key")
+	assert.Equal(t, []string{"nightly", "docs"}, got.Status().Tags, "Expect status tags")
+
+	opts, err := sc.JobClient().GetOriginOptions(job.Id, job.URLs[0].URLId)
+	require.Nil(t, err, "Expect no error getting origin options")
+	assert.Equal(t, &spec.Options, opts, "Expect job options for URL without its own")
+	opts, err = sc.JobClient().GetOriginOptions(job.Id, job.URLs[1].URLId)
+	require.Nil(t, err, "Expect no error getting origin options")
+	assert.Equal(t, urlOpts, opts, "Expect URL's own options")
+
+	again, created, err := sc.JobClient().CreateJob(spec)
+	require.Nil(t, err, "Expect no error for repeated key")
+	assert.False(t, created, "Expect job not created again")
+	assert.Equal(t, job.Id, again.Id, "Expect existing job")
+	assert.Len(t, again.URLs, 2, "Expect existing job URLs")
+
+	other, created, err := sc.JobClient().CreateJob(JobSpec{URLs: []JobSpecURL{{URL: "http://example.com"}}})
+	require.Nil(t, err, "Expect no error creating job without key")
+	assert.True(t, created, "Expect job created")
+	assert.NotEqual(t, job.Id, other.Id, "Expect new job")
+	_, created, err = sc.JobClient().CreateJob(JobSpec{URLs: []JobSpecURL{{URL: "http://example.com"}}})
+	require.Nil(t, err, "Expect no error creating another job without key")
+	assert.True(t, created, "Expect jobs without keys not to collide")
+}
+
+func TestJobReservePage(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	jobClient := sc.JobClient()
+
+	job, err := jobClient.CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+
+	for i := 0; i < 2; i++ {
+		ok, err := jobClient.ReservePage(job.Id, 2, 0)
+		require.Nil(t, err, "Expect no error reserving page")
+		assert.True(t, ok, "Expect page %d reserved", i)
+	}
+	ok, err := jobClient.ReservePage(job.Id, 2, 0)
+	require.Nil(t, err, "Expect no error reserving page")
+	assert.False(t, ok, "Expect max pages reached")
+
+	ok, err = jobClient.ReservePage(job.Id, 0, 100)
+	require.Nil(t, err, "Expect no error reserving page")
+	assert.True(t, ok, "Expect unlimited pages reserved")
+
+	require.Nil(t, jobClient.AddBytes(job.Id, 100), "Expect no error adding bytes")
+	ok, err = jobClient.ReservePage(job.Id, 0, 100)
+	require.Nil(t, err, "Expect no error reserving page")
+	assert.False(t, ok, "Expect max bytes reached")
+}
+
+func TestJobCancel(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	jobClient := sc.JobClient()
+	urlClient := sc.URLClient()
+
+	job, err := jobClient.CreateJobFromURLs([]string{"http://example.com", "http://example.org"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	originId := job.URLs[0].URLId
+	require.Nil(t, urlClient.AddPending(job.Id, originId, originId), "Expect no error adding pending")
+	require.Nil(t, urlClient.MarkJobURLComplete(job.Id, job.URLs[1].URLId), "Expect no error completing job URL")
+
+	state, err := jobClient.GetState(job.Id)
+	require.Nil(t, err, "Expect no error getting state")
+	assert.Equal(t, common.JobStateRunning, state, "Expect job running")
+
+	cancelled, err := jobClient.Cancel(job.Id)
+	require.Nil(t, err, "Expect no error cancelling job")
+	assert.True(t, cancelled, "Expect job cancelled")
+
+	state, err = jobClient.GetState(job.Id)
+	require.Nil(t, err, "Expect no error getting state")
+	assert.Equal(t, common.JobStateCancelled, state, "Expect job cancelled")
+
+	pending, err := urlClient.HasPending(job.Id, originId)
+	require.Nil(t, err, "Expect no error checking pending")
+	assert.False(t, pending, "Expect pending URLs deleted")
+
+	require.Nil(t, urlClient.MarkJobURLComplete(job.Id, originId), "Expect no error completing job URL")
+	got, err := jobClient.GetJob(job.Id)
+	require.Nil(t, err, "Expect no error getting job")
+	status := got.Status()
+	assert.Equal(t, common.JobStateCancelled, status.State, "Expect cancelled status")
+	assert.Equal(t, 1, status.Completed, "Expect completed count kept")
+	assert.Equal(t, 1, status.Pending, "Expect pending count kept")
+	assert.False(t, got.CancelledOn.IsZero(), "Expect cancelled time")
+
+	cancelled, err = jobClient.Cancel(job.Id)
+	require.Nil(t, err, "Expect no error cancelling job again")
+	assert.False(t, cancelled, "Expect job already cancelled")
+
+	completed, err := jobClient.CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	require.Nil(t, urlClient.MarkJobURLComplete(completed.Id, originId), "Expect no error completing job URL")
+	cancelled, err = jobClient.Cancel(completed.Id)
+	require.Nil(t, err, "Expect no error cancelling completed job")
+	assert.False(t, cancelled, "Expect completed job not cancelled")
+
+	state, err = jobClient.GetState(completed.Id + 1)
+	require.Nil(t, err, "Expect no error for missing job")
+	assert.Equal(t, "", state, "Expect no state")
+}
+
+func TestJobPauseResume(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	jobClient := sc.JobClient()
+
+	job, err := jobClient.CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+
+	resumed, err := jobClient.Resume(job.Id)
+	require.Nil(t, err, "Expect no error resuming job")
+	assert.False(t, resumed, "Expect running job not resumed")
+
+	paused, err := jobClient.Pause(job.Id)
+	require.Nil(t, err, "Expect no error pausing job")
+	assert.True(t, paused, "Expect job paused")
+	require.Nil(t, sc.ParkedClient().Park(&common.URLQueueItem{JobId: job.Id, URLId: job.URLs[0].URLId}), "Expect no error parking item")
+
+	got, err := jobClient.GetJob(job.Id)
+	require.Nil(t, err, "Expect no error getting job")
+	assert.Equal(t, common.JobStatePaused, got.Status().State, "Expect paused status")
+	assert.Equal(t, 1, got.Status().Parked, "Expect parked count")
+
+	paused, err = jobClient.Pause(job.Id)
+	require.Nil(t, err, "Expect no error pausing job again")
+	assert.False(t, paused, "Expect job already paused")
+
+	resumed, err = jobClient.Resume(job.Id)
+	require.Nil(t, err, "Expect no error resuming job")
+	assert.True(t, resumed, "Expect job resumed")
+	state, err := jobClient.GetState(job.Id)
+	require.Nil(t, err, "Expect no error getting state")
+	assert.Equal(t, common.JobStateRunning, state, "Expect job running")
+
+	_, err = jobClient.Pause(job.Id)
+	require.Nil(t, err, "Expect no error pausing job")
+	cancelled, err := jobClient.Cancel(job.Id)
+	require.Nil(t, err, "Expect no error cancelling paused job")
+	assert.True(t, cancelled, "Expect paused job cancelled")
+	count, err := sc.ParkedClient().Count(job.Id)
+	require.Nil(t, err, "Expect no error counting parked items")
+	assert.Equal(t, 0, count, "Expect cancelled job's parked items deleted")
+}
+
+func TestJobList(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	jobClient := sc.JobClient()
+
+	create := func(u string, tags ...string) *Job {
+		job, _, err := jobClient.CreateJob(JobSpec{URLs: []JobSpecURL{{URL: u}}, Tags: tags})
+		require.Nil(t, err, "Expect no error creating job")
+		return job
+	}
+	running := create("http://example.com/docs", "nightly", "docs_50%")
+	completed := create("http://example.org", "nightly")
+	cancelled := create("http://Example.net")
+	require.Nil(t, sc.URLClient().MarkJobURLComplete(completed.Id, completed.URLs[0].URLId), "Expect no error completing job URL")
+	_, err := jobClient.Cancel(cancelled.Id)
+	require.Nil(t, err, "Expect no error cancelling job")
+
+	ids := func(q JobListQuery) ([]common.JobId, int) {
+		jobs, total, err := jobClient.List(q)
+		require.Nil(t, err, "Expect no error listing jobs")
+		ids := []common.JobId{}
+		for _, job := range jobs {
+			ids = append(ids, job.Id)
+		}
+		return ids, total
+	}
+
+	got, total := ids(JobListQuery{})
+	assert.Equal(t, []common.JobId{cancelled.Id, completed.Id, running.Id}, got, "Expect newest jobs first")
+	assert.Equal(t, 3, total, "Expect total jobs")
+
+	got, _ = ids(JobListQuery{Sort: JobSortId, Ascending: true})
+	assert.Equal(t, []common.JobId{running.Id, completed.Id, cancelled.Id}, got, "Expect jobs sorted by id")
+
+	got, total = ids(JobListQuery{Sort: JobSortId, Ascending: true, Limit: 1, Offset: 1})
+	assert.Equal(t, []common.JobId{completed.Id}, got, "Expect page of jobs")
+	assert.Equal(t, 3, total, "Expect total of all pages")
+
+	for state, want := range map[string]common.JobId{
+		common.JobStateRunning:   running.Id,
+		common.JobStateCompleted: completed.Id,
+		common.JobStateCancelled: cancelled.Id,
+	} {
+		got, _ = ids(JobListQuery{State: state})
+		assert.Equal(t, []common.JobId{want}, got, "Expect %s jobs", state)
+	}
+	got, _ = ids(JobListQuery{State: common.JobStatePaused})
+	assert.Empty(t, got, "Expect no paused jobs")
+
+	got, _ = ids(JobListQuery{Tag: "nightly", Sort: JobSortId, Ascending: true})
+	assert.Equal(t, []common.JobId{running.Id, completed.Id}, got, "Expect jobs with tag")
+	got, _ = ids(JobListQuery{Tag: "docs_50%"})
+	assert.Equal(t, []common.JobId{running.Id}, got, "Expect tag matched literally")
+	got, _ = ids(JobListQuery{Tag: "night"})
+	assert.Empty(t, got, "Expect partial tags not matched")
+
+	got, _ = ids(JobListQuery{URL: "example.net"})
+	assert.Equal(t, []common.JobId{cancelled.Id}, got, "Expect jobs with URL, regardless of case")
+	got, _ = ids(JobListQuery{URL: "/docs"})
+	assert.Equal(t, []common.JobId{running.Id}, got, "Expect jobs with URL substring")
+
+	got, _ = ids(JobListQuery{CreatedAfter: time.Now().Add(time.Hour)})
+	assert.Empty(t, got, "Expect no jobs created in the future")
+	got, total = ids(JobListQuery{CreatedAfter: time.Now().Add(-time.Hour), CreatedBefore: time.Now().Add(time.Hour)})
+	assert.Equal(t, 3, total, "Expect jobs created in range")
+
+	jobs, _, err := jobClient.List(JobListQuery{State: common.JobStateCompleted})
+	require.Nil(t, err, "Expect no error listing jobs")
+	require.Len(t, jobs, 1, "Expect completed job")
+	assert.Equal(t, common.JobStateCompleted, jobs[0].Status().State, "Expect listed job's status")
+	assert.Equal(t, []string{"nightly"}, jobs[0].Tags, "Expect listed job's tags")
+
+	_, _, err = jobClient.List(JobListQuery{State: "unknown"})
+	assert.NotNil(t, err, "Expect unknown state error")
+	_, _, err = jobClient.List(JobListQuery{Sort: "unknown"})
+	assert.NotNil(t, err, "Expect unknown sort error")
+}
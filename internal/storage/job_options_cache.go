@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"sync"
+	"time"
+)
+
+// Default duration job options are cached for before they are read from
+// storage again.
+const DefaultJobOptionsMaxAge = 10 * time.Minute
+
+// Caches the options of jobs' origin URLs, so they are not read from storage
+// for each of a job's queued items. Entries expire so options of finished
+// jobs do not stay in memory. JobOptionsCache is safe to share across go-routines.
+type JobOptionsCache struct {
+	sc     *Client
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	entries map[jobOptionsKey]jobOptionsEntry
+}
+
+// Job and origin URL options are cached for.
+type jobOptionsKey struct {
+	jobId    common.JobId
+	originId common.URLId
+}
+
+// Cached options of a job, and when they were read from storage.
+type jobOptionsEntry struct {
+	opts   *common.JobOptions
+	readOn time.Time
+}
+
+// Creates a new job options cache reading options from the storage client.
+// If maxAge is not set DefaultJobOptionsMaxAge will be used.
+func NewJobOptionsCache(sc *Client, maxAge time.Duration) *JobOptionsCache {
+	if maxAge <= 0 {
+		maxAge = DefaultJobOptionsMaxAge
+	}
+	return &JobOptionsCache{
+		sc:      sc,
+		maxAge:  maxAge,
+		entries: make(map[jobOptionsKey]jobOptionsEntry),
+	}
+}
+
+// Returns the options the job's origin URL, and its descendants, are crawled
+// with, reading them from storage if they are not cached, or the cached
+// options have expired. An error is returned if the job does not exist.
+func (c *JobOptionsCache) Get(id common.JobId, originId common.URLId) (*common.JobOptions, error) {
+	now := time.Now()
+	key := jobOptionsKey{jobId: id, originId: originId}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Sub(entry.readOn) < c.maxAge {
+		return entry.opts, nil
+	}
+
+	opts, err := c.sc.JobClient().GetOriginOptions(id, originId)
+	if err != nil {
+		return nil, err
+	}
+	if opts == nil {
+		return nil, fmt.Errorf("Job %d does not exist", id)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if now.Sub(e.readOn) >= c.maxAge {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = jobOptionsEntry{opts: opts, readOn: now}
+
+	return opts, nil
+}
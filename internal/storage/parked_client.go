@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Provides a name spaced collection of parked item storage operations. Parked
+// items are the queued items of paused jobs, held until the job is resumed.
+// ParkedClient does not hold non go-routine state, and is safe to share
+// across multiples.
+type ParkedClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Holds the queued item until its job is resumed.
+func (p *ParkedClient) Park(item *common.URLQueueItem) error {
+	const queryParkedInsert = `INSERT INTO parked_item (job_id, item, created_on) VALUES ($1, $2, $3)`
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.client.exec(queryParkedInsert, item.JobId, string(b), time.Now().UTC()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the number of items parked for the job.
+func (p *ParkedClient) Count(jobId common.JobId) (int, error) {
+	const queryParkedCount = `SELECT count(*) FROM parked_item WHERE job_id = $1`
+
+	var count sql.NullInt64
+	if err := p.client.queryRow(queryParkedCount, jobId).Scan(&count); err != nil {
+		return 0, err
+	}
+	return int(count.Int64), nil
+}
+
+// Removes the items parked for the job, and returns them oldest first so
+// they can be queued again. Each item is only returned to one caller, even
+// if the job's items are taken concurrently. If an error is returned the
+// items taken before it are still returned, and need to be queued.
+func (p *ParkedClient) Take(jobId common.JobId) ([]*common.URLQueueItem, error) {
+	const queryParkedItems = `SELECT id, item FROM parked_item WHERE job_id = $1 ORDER BY id`
+	const queryParkedDelete = `DELETE FROM parked_item WHERE id = $1`
+
+	rows, err := p.client.query(queryParkedItems, jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	type parked struct {
+		id   int64
+		item string
+	}
+	found := []parked{}
+	for rows.Next() {
+		var (
+			id   sql.NullInt64
+			item sql.NullString
+		)
+		if err := rows.Scan(&id, &item); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found = append(found, parked{id: id.Int64, item: item.String})
+	}
+	// The rows are closed before the items are deleted, since SQLite only
+	// has a single connection.
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	items := []*common.URLQueueItem{}
+	for _, f := range found {
+		item := &common.URLQueueItem{}
+		if err := json.Unmarshal([]byte(f.item), item); err != nil {
+			return items, fmt.Errorf("Invalid parked item %d for job %d, %v", f.id, jobId, err)
+		}
+
+		// Only the caller which deletes the item takes it.
+		res, err := p.client.exec(queryParkedDelete, f.id)
+		if err != nil {
+			return items, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return items, err
+		} else if n > 0 {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
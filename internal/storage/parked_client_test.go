@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParkedItems(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	parkedClient := sc.ParkedClient()
+
+	first := &common.URLQueueItem{JobId: 1, OriginId: 2, ReferId: 2, URLId: 3, Level: 1}
+	second := &common.URLQueueItem{JobId: 1, OriginId: 2, ReferId: 3, URLId: 4, Level: 2, CheckOnly: true}
+	other := &common.URLQueueItem{JobId: 2, OriginId: 5, URLId: 5}
+	for _, item := range []*common.URLQueueItem{first, second, other} {
+		require.Nil(t, parkedClient.Park(item), "Expect no error parking item")
+	}
+
+	count, err := parkedClient.Count(1)
+	require.Nil(t, err, "Expect no error counting parked items")
+	assert.Equal(t, 2, count, "Expect job's parked items")
+
+	items, err := parkedClient.Take(1)
+	require.Nil(t, err, "Expect no error taking parked items")
+	assert.Equal(t, []*common.URLQueueItem{first, second}, items, "Expect job's items oldest first")
+
+	items, err = parkedClient.Take(1)
+	require.Nil(t, err, "Expect no error taking parked items")
+	assert.Empty(t, items, "Expect items only taken once")
+
+	count, err = parkedClient.Count(2)
+	require.Nil(t, err, "Expect no error counting parked items")
+	assert.Equal(t, 1, count, "Expect other job's items kept")
+}
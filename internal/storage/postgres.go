@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"database/sql"
+	_ "github.com/lib/pq"
+)
+
+// Dialect for the PostgreSQL database. The schema is expected to already
+// exist, see setup/db.sql.
+type postgresDialect struct{}
+
+// Opens the connection to the PostgreSQL database.
+func (postgresDialect) open(cfg ClientConfig) (*sql.DB, error) {
+	return sql.Open("postgres", cfg.String())
+}
+
+// Postgres natively supports '$N' placeholders, so the query is unchanged.
+func (postgresDialect) rebind(query string) string {
+	return query
+}
+
+// Postgres matches POSIX regular expressions with the '~' operator.
+func (postgresDialect) regexp(column, placeholder string) string {
+	return column + " ~ " + placeholder
+}
+
+// Executes the insert with a RETURNING clause to get the new row's id.
+func (postgresDialect) insertId(db *sql.DB, query string, args ...interface{}) (int64, error) {
+	var id sql.NullInt64
+	if err := db.QueryRow(query+" RETURNING id", args...).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id.Int64, nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Provides a name spaced collection of robots.txt based storage operations.
+// RobotsClient does not hold non go-routine state, and is safe to share
+// across multiples.
+type RobotsClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Requests the cached robots.txt for the site's host. The host is the scheme
+// and host of the site, e.g: https://example.com. If the robots.txt was not
+// fetched within the max age, or has never been fetched, nil will be returned.
+func (r *RobotsClient) Get(host string, maxAge time.Duration) (*Robots, error) {
+	const queryRobots = `SELECT host,status_code,body,fetched_on FROM robots WHERE host = $1 AND fetched_on > $2`
+
+	var (
+		h          sql.NullString
+		statusCode sql.NullInt64
+		body       sql.NullString
+		fetchedOn  sql.NullTime
+	)
+
+	minFetchedOn := time.Now().UTC().Add(-maxAge)
+	if err := r.client.queryRow(queryRobots, host, minFetchedOn).Scan(&h, &statusCode, &body, &fetchedOn); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !h.Valid || !statusCode.Valid || !fetchedOn.Valid {
+		return nil, fmt.Errorf("Invalid robots result for host %s", host)
+	}
+
+	return &Robots{
+		Host:       h.String,
+		StatusCode: int(statusCode.Int64),
+		Body:       []byte(body.String),
+		FetchedOn:  fetchedOn.Time,
+	}, nil
+}
+
+// Stores the robots.txt fetched for the site's host, replacing the previously
+// cached robots.txt if there was one.
+func (r *RobotsClient) Put(host string, statusCode int, body []byte) error {
+	const queryRobotsUpdate = `UPDATE robots SET status_code = $1, body = $2, fetched_on = $3 WHERE host = $4`
+	const queryRobotsInsert = `
+INSERT INTO robots (host, status_code, body, fetched_on)
+	SELECT $1, $2, $3, $4
+	WHERE NOT EXISTS (SELECT 1 FROM robots WHERE host = $1)`
+
+	fetchedOn := time.Now().UTC()
+	res, err := r.client.exec(queryRobotsUpdate, statusCode, string(body), fetchedOn, host)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+
+	if _, err := r.client.exec(queryRobotsInsert, host, statusCode, string(body), fetchedOn); err != nil {
+		return err
+	}
+	return nil
+}
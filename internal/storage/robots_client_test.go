@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRobotsPutGet(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	robotsClient := sc.RobotsClient()
+
+	r, err := robotsClient.Get("http://example.com", time.Hour)
+	require.Nil(t, err, "Expect no error getting robots")
+	assert.Nil(t, r, "Expect no robots cached")
+
+	require.Nil(t, robotsClient.Put("http://example.com", 200, []byte("User-agent: *")), "Expect no error putting robots")
+	require.Nil(t, robotsClient.Put("http://example.com", 404, nil), "Expect no error replacing robots")
+
+	r, err = robotsClient.Get("http://example.com", time.Hour)
+	require.Nil(t, err, "Expect no error getting robots")
+	require.NotNil(t, r, "Expect robots cached")
+	assert.Equal(t, 404, r.StatusCode, "Expect replaced status code")
+	assert.Len(t, r.Body, 0, "Expect replaced body")
+
+	r, err = robotsClient.Get("http://example.com", 0)
+	require.Nil(t, err, "Expect no error getting robots")
+	assert.Nil(t, r, "Expect expired robots not returned")
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Queues a scheduled item can be sent to once it is due.
+const (
+	// URL queue, filtered by the foremen. Used for retries.
+	ScheduledURLQueue = "url"
+
+	// Work queue, crawled by the workers. Used for deferred items.
+	ScheduledWorkQueue = "work"
+)
+
+// Provides a name spaced collection of scheduled item storage operations.
+// Scheduled items are held in storage until they are due to be sent to a
+// queue, so they are not lost if the process which scheduled them exits.
+// ScheduledClient does not hold non go-routine state, and is safe to share
+// across multiples.
+type ScheduledClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Holds the item until it is due to be sent to the queue.
+func (s *ScheduledClient) Schedule(queue string, item *common.URLQueueItem, dueOn time.Time) error {
+	const queryScheduledInsert = `
+INSERT INTO scheduled_item (job_id, queue, item, due_on, created_on) VALUES ($1, $2, $3, $4, $5)`
+
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.client.exec(queryScheduledInsert, item.JobId, queue, string(b), dueOn.UTC(), time.Now().UTC()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns up to limit items which are due, oldest first.
+func (s *ScheduledClient) Due(limit int) ([]*ScheduledItem, error) {
+	const queryScheduledDue = `
+SELECT id, queue, item, due_on FROM scheduled_item
+WHERE due_on <= $1
+ORDER BY due_on, id
+LIMIT $2`
+
+	rows, err := s.client.query(queryScheduledDue, time.Now().UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*ScheduledItem{}
+	for rows.Next() {
+		var (
+			id    sql.NullInt64
+			queue sql.NullString
+			item  sql.NullString
+			dueOn sql.NullTime
+		)
+		if err := rows.Scan(&id, &queue, &item, &dueOn); err != nil {
+			return nil, err
+		}
+
+		scheduled := &ScheduledItem{
+			Id:    id.Int64,
+			Queue: queue.String,
+			Item:  &common.URLQueueItem{},
+			DueOn: dueOn.Time,
+		}
+		if err := json.Unmarshal([]byte(item.String), scheduled.Item); err != nil {
+			return nil, fmt.Errorf("Invalid scheduled item %d, %v", scheduled.Id, err)
+		}
+		items = append(items, scheduled)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Claims the due item to send it, so other callers will not send it at the
+// same time. The item is not due again until the lease expires, so if it is
+// never removed it will be sent again. Returns false if the item was already
+// claimed, or removed.
+func (s *ScheduledClient) Claim(item *ScheduledItem, lease time.Duration) (bool, error) {
+	const queryScheduledClaim = `UPDATE scheduled_item SET due_on = $1 WHERE id = $2 AND due_on <= $3`
+
+	now := time.Now().UTC()
+	res, err := s.client.exec(queryScheduledClaim, now.Add(lease), item.Id, now)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Removes the item once it has been sent to its queue.
+func (s *ScheduledClient) Remove(item *ScheduledItem) error {
+	const queryScheduledDelete = `DELETE FROM scheduled_item WHERE id = $1`
+
+	if _, err := s.client.exec(queryScheduledDelete, item.Id); err != nil {
+		return err
+	}
+	return nil
+}
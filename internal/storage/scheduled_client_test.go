@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestScheduledItems(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	scheduledClient := sc.ScheduledClient()
+
+	retry := &common.URLQueueItem{JobId: 1, OriginId: 2, ReferId: 2, URLId: 3, Level: 1, Attempt: 1}
+	deferred := &common.URLQueueItem{JobId: 1, OriginId: 2, ReferId: 3, URLId: 4, Level: 2}
+	later := &common.URLQueueItem{JobId: 2, OriginId: 5, URLId: 5}
+	now := time.Now()
+	require.Nil(t, scheduledClient.Schedule(ScheduledURLQueue, retry, now.Add(-2*time.Second)), "Expect no error scheduling item")
+	require.Nil(t, scheduledClient.Schedule(ScheduledWorkQueue, deferred, now.Add(-time.Second)), "Expect no error scheduling item")
+	require.Nil(t, scheduledClient.Schedule(ScheduledURLQueue, later, now.Add(time.Hour)), "Expect no error scheduling item")
+
+	due, err := scheduledClient.Due(10)
+	require.Nil(t, err, "Expect no error getting due items")
+	require.Len(t, due, 2, "Expect only due items")
+	assert.Equal(t, ScheduledURLQueue, due[0].Queue, "Expect item's queue")
+	assert.Equal(t, retry, due[0].Item, "Expect oldest due item first")
+	assert.Equal(t, ScheduledWorkQueue, due[1].Queue, "Expect item's queue")
+	assert.Equal(t, deferred, due[1].Item, "Expect due item")
+
+	due, err = scheduledClient.Due(1)
+	require.Nil(t, err, "Expect no error getting due items")
+	assert.Len(t, due, 1, "Expect due items limited")
+
+	claimed, err := scheduledClient.Claim(due[0], time.Minute)
+	require.Nil(t, err, "Expect no error claiming item")
+	assert.True(t, claimed, "Expect due item claimed")
+
+	claimed, err = scheduledClient.Claim(due[0], time.Minute)
+	require.Nil(t, err, "Expect no error claiming item again")
+	assert.False(t, claimed, "Expect item only claimed once")
+
+	due, err = scheduledClient.Due(10)
+	require.Nil(t, err, "Expect no error getting due items")
+	require.Len(t, due, 1, "Expect claimed item not due")
+	assert.Equal(t, deferred, due[0].Item, "Expect unclaimed item still due")
+
+	require.Nil(t, scheduledClient.Remove(due[0]), "Expect no error removing item")
+	claimed, err = scheduledClient.Claim(due[0], time.Minute)
+	require.Nil(t, err, "Expect no error claiming removed item")
+	assert.False(t, claimed, "Expect removed item not claimed")
+}
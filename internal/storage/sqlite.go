@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/mattn/go-sqlite3"
+	"regexp"
+	"sync"
+)
+
+// Name the SQLite driver is registered with. The driver is the same as
+// go-sqlite3's, with the regexp function SQLite's REGEXP operator calls.
+const sqliteDriverName = "sqlite3_harvester"
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", sqliteRegexp, true)
+		},
+	})
+}
+
+// The last regular expression compiled by sqliteRegexp. The same expression
+// is matched against every row of a query, so it is only compiled once.
+var sqliteLastRegexp struct {
+	sync.Mutex
+	re *regexp.Regexp
+}
+
+// Implements SQLite's regexp function, called for 'value REGEXP pattern'.
+// The pattern uses Go's regular expression syntax.
+func sqliteRegexp(pattern, value string) (bool, error) {
+	sqliteLastRegexp.Lock()
+	re := sqliteLastRegexp.re
+	if re == nil || re.String() != pattern {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			sqliteLastRegexp.Unlock()
+			return false, err
+		}
+		sqliteLastRegexp.re = re
+	}
+	sqliteLastRegexp.Unlock()
+
+	return re.MatchString(value), nil
+}
+
+// Schema of the embedded SQLite database. Mirrors setup/db.sql, and is
+// created when the client is opened if the tables do not already exist.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS url (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    mime         TEXT,
+    url          TEXT NOT NULL,
+    host         TEXT,
+    crawled_on   TIMESTAMP,
+    crawl_status TEXT,
+
+    status_code    INTEGER,
+    final_url      TEXT,
+    content_length INTEGER,
+    etag           TEXT,
+    last_modified  TEXT,
+    response_time  INTEGER,
+    fetch_error    TEXT,
+    fetch_error_kind TEXT,
+    fetched_on     TIMESTAMP,
+    lastmod        TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS url_unique ON url(url);
+CREATE INDEX IF NOT EXISTS url_host ON url(host);
+
+CREATE TABLE IF NOT EXISTS url_link (
+    url_id   INTEGER NOT NULL,
+    refer_id INTEGER NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS url_link_pair ON url_link (url_id, refer_id);
+CREATE INDEX IF NOT EXISTS url_link_refer ON url_link (refer_id, url_id);
+
+CREATE TABLE IF NOT EXISTS job (
+    id         INTEGER   PRIMARY KEY AUTOINCREMENT,
+    created_on TIMESTAMP NOT NULL,
+    options    TEXT      NOT NULL DEFAULT '{}',
+    pages_crawled INTEGER NOT NULL DEFAULT 0,
+    bytes_crawled INTEGER NOT NULL DEFAULT 0,
+    tags          TEXT    NOT NULL DEFAULT '[]',
+    callback_url  TEXT    NOT NULL DEFAULT '',
+    idempotency_key TEXT,
+    state         TEXT    NOT NULL DEFAULT 'running',
+    cancelled_on  TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS job_idempotency_key ON job(idempotency_key);
+
+CREATE TABLE IF NOT EXISTS job_url (
+    job_id       INTEGER NOT NULL,
+    url_id       INTEGER NOT NULL,
+    completed_on TIMESTAMP,
+    options      TEXT,
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+
+CREATE TABLE IF NOT EXISTS job_result (
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id   INTEGER NOT NULL,
+    refer_id INTEGER NOT NULL,
+    url_id   INTEGER NOT NULL,
+    level    INTEGER NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (refer_id) REFERENCES url(id),
+    FOREIGN KEY (url_id)   REFERENCES url(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS job_result_pair ON job_result(job_id,refer_id,url_id);
+CREATE INDEX IF NOT EXISTS job_result_cursor ON job_result(job_id,id);
+CREATE INDEX IF NOT EXISTS job_result_level ON job_result(job_id,level);
+
+CREATE TABLE IF NOT EXISTS url_pending (
+    job_id    INTEGER NOT NULL,
+    origin_id INTEGER NOT NULL,
+    url_id    INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS robots (
+    host        TEXT      PRIMARY KEY,
+    status_code INTEGER   NOT NULL,
+    body        TEXT,
+    fetched_on  TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS host_limit (
+    host             TEXT    PRIMARY KEY,
+    active           INTEGER NOT NULL DEFAULT 0,
+    next_request_on  TIMESTAMP,
+    backoff_until    TIMESTAMP,
+    lease_expires_on TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS dead_letter (
+    id          INTEGER   PRIMARY KEY AUTOINCREMENT,
+    job_id      INTEGER   NOT NULL,
+    url_id      INTEGER   NOT NULL,
+    origin_id   INTEGER   NOT NULL,
+    refer_id    INTEGER   NOT NULL,
+    attempts    INTEGER   NOT NULL,
+    last_error  TEXT      NOT NULL,
+    status_code INTEGER   NOT NULL,
+    created_on  TIMESTAMP NOT NULL,
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+CREATE INDEX IF NOT EXISTS dead_letter_job ON dead_letter(job_id);
+
+CREATE TABLE IF NOT EXISTS parked_item (
+    id         INTEGER   PRIMARY KEY AUTOINCREMENT,
+    job_id     INTEGER   NOT NULL,
+    item       TEXT      NOT NULL,
+    created_on TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS parked_item_job ON parked_item(job_id);
+
+CREATE TABLE IF NOT EXISTS scheduled_item (
+    id         INTEGER   PRIMARY KEY AUTOINCREMENT,
+    job_id     INTEGER   NOT NULL,
+    queue      TEXT      NOT NULL,
+    item       TEXT      NOT NULL,
+    due_on     TIMESTAMP NOT NULL,
+    created_on TIMESTAMP NOT NULL
+);
+CREATE INDEX IF NOT EXISTS scheduled_item_due ON scheduled_item(due_on);
+
+CREATE TABLE IF NOT EXISTS job_callback (
+    id              INTEGER   PRIMARY KEY AUTOINCREMENT,
+    job_id          INTEGER   NOT NULL,
+    event           TEXT      NOT NULL,
+    url             TEXT      NOT NULL,
+    state           TEXT      NOT NULL,
+    attempts        INTEGER   NOT NULL DEFAULT 0,
+    next_attempt_on TIMESTAMP NOT NULL,
+    created_on      TIMESTAMP NOT NULL,
+    delivered_on    TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS job_callback_job ON job_callback(job_id);
+CREATE INDEX IF NOT EXISTS job_callback_due ON job_callback(state, next_attempt_on);
+
+CREATE TABLE IF NOT EXISTS job_callback_attempt (
+    id           INTEGER   PRIMARY KEY AUTOINCREMENT,
+    callback_id  INTEGER   NOT NULL REFERENCES job_callback(id),
+    attempted_on TIMESTAMP NOT NULL,
+    status_code  INTEGER   NOT NULL,
+    error        TEXT      NOT NULL
+);
+CREATE INDEX IF NOT EXISTS job_callback_attempt_callback ON job_callback_attempt(callback_id);
+`
+
+// Matches the Postgres style '$N' placeholders so they can be rewritten.
+var sqlitePlaceholderRegexp = regexp.MustCompile(`\$(\d+)`)
+
+// Dialect for the embedded SQLite database.
+type sqliteDialect struct{}
+
+// Opens the SQLite database file, creating it and its schema if needed.
+// SQLite only allows a single writer at a time, so the database is limited
+// to a single connection. Because of this rows must be closed before
+// another query is made, or the query will block. LIKE is made case
+// sensitive to match Postgres.
+func (sqliteDialect) open(cfg ClientConfig) (*sql.DB, error) {
+	path := cfg.Path
+	if path == "" {
+		path = ":memory:"
+	}
+
+	db, err := sql.Open(sqliteDriverName, "file:"+path+"?_foreign_keys=1&_busy_timeout=5000&_case_sensitive_like=1")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Rewrites the '$N' placeholders into SQLite's numbered '?N' placeholders.
+func (sqliteDialect) rebind(query string) string {
+	return sqlitePlaceholderRegexp.ReplaceAllString(query, "?$1")
+}
+
+// SQLite's REGEXP operator calls the regexp function registered with the
+// driver.
+func (sqliteDialect) regexp(column, placeholder string) string {
+	return column + " REGEXP " + placeholder
+}
+
+// Executes the insert, and uses the last insert id as the new row's id.
+func (d sqliteDialect) insertId(db *sql.DB, query string, args ...interface{}) (int64, error) {
+	res, err := db.Exec(d.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -28,6 +28,146 @@ type URL struct {
 
 	// The time stamp the URL entry was created.
 	CrawledOn time.Time
+
+	// Outcome of the URL's last crawl, e.g: common.CrawlStatusCrawled.
+	// Empty if the URL has not been crawled.
+	CrawlStatus string
+
+	// HTTP metadata of the URL's last fetch. Zero value if the URL
+	// has not been fetched.
+	Fetch Fetch
+
+	// The time stamp a sitemap listed the URL's content as last
+	// modified. Zero if no sitemap listed it.
+	LastMod time.Time
+}
+
+// HTTP metadata of fetching a URL's content.
+type Fetch struct {
+	// HTTP status code of the response. Zero if there was no response.
+	StatusCode int
+
+	// URL of the response after following any redirects.
+	FinalURL string
+
+	// Length of the response's content in bytes. -1 if unknown.
+	ContentLength int64
+
+	// ETag header of the response.
+	ETag string
+
+	// Last-Modified header of the response.
+	LastModified string
+
+	// Duration from making the request until the response's content
+	// was read.
+	ResponseTime time.Duration
+
+	// Error the fetch failed with. Empty if the fetch succeeded.
+	Error string
+
+	// Kind of error the fetch failed with, e.g: common.FetchErrorDNS.
+	// Empty if the fetch succeeded.
+	ErrorKind string
+
+	// The time stamp the URL was fetched. Set by storage when the fetch
+	// is recorded.
+	FetchedOn time.Time
+}
+
+// A URL of a job's results which failed to be fetched.
+type BrokenLink struct {
+	// URL which failed to be fetched
+	URL string
+
+	// HTTP status code of the response. Zero if there was no response.
+	StatusCode int
+
+	// Error the fetch failed with.
+	Error string
+
+	// Kind of error the fetch failed with, e.g: common.FetchErrorDNS.
+	ErrorKind string
+}
+
+// A URL of a job's results, and the refer URL it was found on.
+type JobResult struct {
+	// Id of the 'job_result' record. Ids increase as results are added, so
+	// the id is the cursor the following results are queried after.
+	Id int64
+
+	// Id of the URL the result was found on
+	ReferId int64
+
+	// URL the result was found on
+	Refer string
+
+	// Id of the result's URL
+	URLId int64
+
+	// URL of the result
+	URL string
+
+	// Mime type of the result's content, if known.
+	Mime string
+
+	// HTTP status code of the result's last fetch. Zero if the result was
+	// not fetched, or there was no response.
+	StatusCode int
+
+	// Number of links from the job's URL to the result.
+	Level int
+}
+
+// Definition of a 'robots' table record. Caches the robots.txt fetched
+// for a site.
+type Robots struct {
+	// Scheme and host of the site, e.g: https://example.com
+	Host string
+
+	// HTTP status code of the robots.txt request. Zero if the site
+	// could not be reached.
+	StatusCode int
+
+	// Content of the robots.txt
+	Body []byte
+
+	// The time stamp the robots.txt was fetched.
+	FetchedOn time.Time
+}
+
+// Definition of a 'dead_letter' table record. Records a URL which failed
+// to be crawled for a job after all of its attempts.
+type DeadLetter struct {
+	// ID (primary key) of this entry
+	Id int64
+
+	// The JobId the URL was crawled for.
+	JobId common.JobId
+
+	// URL which failed to be crawled
+	URLId common.URLId
+
+	// The URL string of the URLId. Only set when the dead letter is queried.
+	URL string
+
+	// Job URL which the URL is a descendant of
+	OriginId common.URLId
+
+	// URL which the URL was found on
+	ReferId common.URLId
+
+	// Number of times the URL was attempted to be crawled
+	Attempts int
+
+	// Error of the last attempt
+	LastError string
+
+	// HTTP status code of the last attempt. Zero if there was no response.
+	StatusCode int
+
+	// The time stamp the URL was given up on.
+	CreatedOn time.Time
 }
 
 // Job Entry for the 'job' record. The Job also includes the
@@ -42,12 +182,68 @@ type Job struct {
 
 	// The time stamp the Job was created on.
 	CreatedOn time.Time
+
+	// Options the job is crawled with
+	Options common.JobOptions
+
+	// Tags the job was scheduled with, e.g: the client or campaign the
+	// job belongs to.
+	Tags []string
+
+	// URL the client asked to be called back on. Empty if not set.
+	CallbackURL string
+
+	// Key supplied by the client identifying the request the job was
+	// scheduled by. Empty if not set.
+	IdempotencyKey string
+
+	// State the job was set to, either common.JobStateRunning,
+	// common.JobStatePaused, or common.JobStateCancelled. Jobs which are
+	// running have completed once all of their URLs have.
+	State string
+
+	// Number of queued items held while the job is paused.
+	Parked int
+
+	// The time stamp the job was cancelled. Only valid if the job's
+	// state is cancelled.
+	CancelledOn time.Time
+}
+
+// Definition of a new job to be created.
+type JobSpec struct {
+	// URLs of the job, and their options
+	URLs []JobSpecURL
+
+	// Options the job is crawled with
+	Options common.JobOptions
+
+	// Tags the job is scheduled with
+	Tags []string
+
+	// URL the client asked to be called back on
+	CallbackURL string
+
+	// Key supplied by the client identifying the request. If a job was
+	// already created with the same key, that job is used instead of
+	// creating a new one.
+	IdempotencyKey string
+}
+
+// URL of a new job to be created.
+type JobSpecURL struct {
+	// URL to be crawled
+	URL string
+
+	// Options the URL and its descendants are crawled with. If nil the
+	// job's options are used.
+	Options *common.JobOptions
 }
 
 // Returns the status of the job.  The status includes the progress
 // of completed vs pending, and total elapsed time.
 func (j *Job) Status() *common.JobStatus {
-	status := &common.JobStatus{Id: j.Id}
+	status := &common.JobStatus{Id: j.Id, Tags: j.Tags, Parked: j.Parked}
 	var compTime time.Time
 	status.URLs = make(map[string]bool)
 	for _, u := range j.URLs {
@@ -62,8 +258,18 @@ func (j *Job) Status() *common.JobStatus {
 		status.URLs[u.URL] = u.Completed
 	}
 
-	if status.Pending != 0 {
+	switch {
+	case j.State == common.JobStateCancelled:
+		status.State = common.JobStateCancelled
+		compTime = j.CancelledOn
+	case status.Pending != 0:
+		status.State = common.JobStateRunning
+		if j.State == common.JobStatePaused {
+			status.State = common.JobStatePaused
+		}
 		compTime = time.Now().UTC()
+	default:
+		status.State = common.JobStateCompleted
 	}
 	status.Elapsed = compTime.Sub(j.CreatedOn)
 
@@ -89,3 +295,64 @@ type JobURL struct {
 	// The JobId this URL belongs to.
 	JobId common.JobId
 }
+
+// Callback of a job to its callback URL, made once the job is done.
+type Callback struct {
+	// ID (primary key) of this entry
+	Id int64
+
+	// The job the callback is made for.
+	JobId common.JobId
+
+	// Event the callback is made for, e.g: common.CallbackEventCompleted
+	Event string
+
+	// URL the callback is delivered to.
+	URL string
+
+	// Delivery state of the callback, e.g: common.CallbackStatePending
+	State string
+
+	// Number of delivery attempts made.
+	Attempts int
+
+	// Earliest time the next delivery attempt can be made.
+	NextAttemptOn time.Time
+
+	// The time stamp the job was done.
+	CreatedOn time.Time
+
+	// The time stamp the callback was delivered. Zero if not delivered.
+	DeliveredOn time.Time
+
+	// Delivery attempts made, oldest first. Only set when the job's
+	// callbacks are listed.
+	AttemptLog []*CallbackAttempt
+}
+
+// Attempt to deliver a job's callback.
+type CallbackAttempt struct {
+	// The time stamp the attempt was made.
+	AttemptedOn time.Time
+
+	// HTTP status code of the response. Zero if there was no response.
+	StatusCode int
+
+	// Error the attempt failed with. Empty if the callback was delivered.
+	Error string
+}
+
+// Item waiting to be sent to a queue once it is due.
+type ScheduledItem struct {
+	// ID (primary key) of this entry
+	Id int64
+
+	// Queue the item is sent to, e.g: ScheduledURLQueue
+	Queue string
+
+	// The item to send to the queue.
+	Item *common.URLQueueItem
+
+	// Earliest time the item can be sent.
+	DueOn time.Time
+}
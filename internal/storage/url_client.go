@@ -4,10 +4,16 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/jasdel/harvester/internal/common"
-	"github.com/lib/pq"
+	"strings"
 	"time"
 )
 
+// Columns of the url table selected to be scanned into a URL record by
+// getURLFromRow and getURLFromRows.
+const urlColumns = `url.id, url.url, url.mime, url.crawled_on, url.crawl_status,
+	url.status_code, url.final_url, url.content_length, url.etag, url.last_modified,
+	url.response_time, url.fetch_error, url.fetch_error_kind, url.fetched_on, url.lastmod`
+
 // Provides a name spaced collection of URL based storage operations. JURLClient
 // does not hold non go-routine state, and is safe to share across multiples.
 type URLClient struct {
@@ -18,16 +24,16 @@ type URLClient struct {
 // Requests a URL record by Id.
 // If no URL is found, nil will be returned for the URL
 func (u *URLClient) GetURLById(id common.URLId) (*URL, error) {
-	const queryURLById = `SELECT id,url,mime,crawled_on FROM url WHERE id = $1`
-	return getURLFromRow(u.client.db.QueryRow(queryURLById, id))
+	const queryURLById = `SELECT ` + urlColumns + ` FROM url WHERE id = $1`
+	return getURLFromRow(u.client.queryRow(queryURLById, id))
 
 }
 
 // Requests a URL record for the URL by URL string value.
 // If no URL is found, nil will be returned for the URL
 func (u *URLClient) GetURLByURL(url string) (*URL, error) {
-	const queryURLByName = `SELECT id,url,mime,crawled_on FROM url WHERE url = $1`
-	return getURLFromRow(u.client.db.QueryRow(queryURLByName, url))
+	const queryURLByName = `SELECT ` + urlColumns + ` FROM url WHERE url = $1`
+	return getURLFromRow(u.client.queryRow(queryURLByName, url))
 }
 
 // Attempts to get a URL if it already exists. If the URL does not
@@ -52,12 +58,67 @@ func (u *URLClient) GetOrAddURLByURL(urlStr, mime string) (*URL, error) {
 // will be the 'refer' value for each of the returned URLs, if there are any.
 func (u *URLClient) GetAllURLsWithReferById(referId common.URLId) ([]*URL, error) {
 	const queryAllURLsWithRefer = `
-SELECT url.id, url.url, url.mime, url.crawled_on
+SELECT ` + urlColumns + `
 FROM url_link
 LEFT JOIN url on url_link.url_id = url.id
 WHERE url_link.refer_id = $1`
 
-	rows, err := u.client.db.Query(queryAllURLsWithRefer, referId)
+	return u.queryURLs(queryAllURLsWithRefer, referId)
+}
+
+// Returns up to limit URLs which link to the URL, ordered by id. The links
+// are from all crawls, not just a single job's.
+func (u *URLClient) GetInboundLinks(urlId common.URLId, limit int) ([]*URL, error) {
+	const queryInboundLinks = `
+SELECT ` + urlColumns + `
+FROM url_link
+JOIN url on url_link.refer_id = url.id
+WHERE url_link.url_id = $1
+ORDER BY url.id
+LIMIT $2`
+
+	return u.queryURLs(queryInboundLinks, urlId, limit)
+}
+
+// Returns up to limit URLs the URL links to, ordered by id. The links are
+// from all crawls, not just a single job's.
+func (u *URLClient) GetOutboundLinks(referId common.URLId, limit int) ([]*URL, error) {
+	const queryOutboundLinks = `
+SELECT ` + urlColumns + `
+FROM url_link
+JOIN url on url_link.url_id = url.id
+WHERE url_link.refer_id = $1
+ORDER BY url.id
+LIMIT $2`
+
+	return u.queryURLs(queryOutboundLinks, referId, limit)
+}
+
+// Returns up to limit pages which use the asset, e.g: an image or script,
+// ordered by id. A page uses the asset if it links to the asset directly, or
+// links to a stylesheet which refers to the asset. Only URLs with a HTML mime
+// type are pages.
+func (u *URLClient) GetPagesLinkingTo(assetId common.URLId, limit int) ([]*URL, error) {
+	const queryPagesLinkingTo = `
+SELECT ` + urlColumns + `
+FROM url
+WHERE url.mime LIKE 'text/html%' AND url.id IN (
+	SELECT refer_id FROM url_link WHERE url_id = $1
+	UNION
+	SELECT page_link.refer_id FROM url_link AS page_link
+	JOIN url_link AS asset_link ON page_link.url_id = asset_link.refer_id
+	JOIN url AS css ON css.id = asset_link.refer_id
+	WHERE asset_link.url_id = $1 AND css.mime LIKE 'text/css%')
+ORDER BY url.id
+LIMIT $2`
+
+	return u.queryURLs(queryPagesLinkingTo, assetId, limit)
+}
+
+// Queries the URLs selected by the query. Expects the query columns to be
+// urlColumns.
+func (u *URLClient) queryURLs(query string, args ...interface{}) ([]*URL, error) {
+	rows, err := u.client.query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -79,29 +140,177 @@ WHERE url_link.refer_id = $1`
 	return urls, nil
 }
 
+// Default number of links ShortestLinkPath follows, if no depth is requested.
+const DefaultLinkPathDepth = 6
+
+// Maximum number of links ShortestLinkPath can follow.
+const MaxLinkPathDepth = 10
+
+// Maximum number of URLs ShortestLinkPath visits before it gives up.
+const maxLinkPathVisited = 100000
+
+// Maximum number of URL ids in a single query. Kept well below SQLite's
+// limit on the number of query variables.
+const maxLinkQueryIds = 500
+
+// Error returned by ShortestLinkPath if the URLs are too well linked to search
+// between them.
+var ErrLinkPathLimit = fmt.Errorf("Link path search visited more than %d URLs", maxLinkPathVisited)
+
+// A URL visited searching for a link path, and the URL it was reached from.
+type linkVisit struct {
+	// URL the visited URL was reached from
+	prev common.URLId
+
+	// Number of links from the end the search started at
+	dist int
+}
+
+// Returns the shortest path of links from the URL to the URL, including both
+// URLs. The links are searched from both ends at once, a level at a time,
+// following up to maxDepth links in total. Nil is returned if there is no
+// path within maxDepth links. ErrLinkPathLimit is returned if too many URLs
+// were visited before finding a path.
+func (u *URLClient) ShortestLinkPath(fromId, toId common.URLId, maxDepth int) ([]*URL, error) {
+	forward := map[common.URLId]linkVisit{fromId: {prev: fromId}}
+	backward := map[common.URLId]linkVisit{toId: {prev: toId}}
+	forwardFrontier := []common.URLId{fromId}
+	backwardFrontier := []common.URLId{toId}
+
+	meet, found := fromId, fromId == toId
+	for depth := 0; !found && depth < maxDepth; depth++ {
+		if len(forwardFrontier) == 0 || len(backwardFrontier) == 0 {
+			return nil, nil
+		}
+		if len(forward)+len(backward) > maxLinkPathVisited {
+			return nil, ErrLinkPathLimit
+		}
+
+		// The smaller frontier is expanded, so the fewest URLs are visited.
+		var err error
+		if len(forwardFrontier) <= len(backwardFrontier) {
+			forwardFrontier, meet, found, err = u.expandLinkPath(forwardFrontier, forward, backward, true)
+		} else {
+			backwardFrontier, meet, found, err = u.expandLinkPath(backwardFrontier, backward, forward, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	ids := []common.URLId{meet}
+	for id := meet; id != fromId; {
+		id = forward[id].prev
+		ids = append([]common.URLId{id}, ids...)
+	}
+	for id := meet; id != toId; {
+		id = backward[id].prev
+		ids = append(ids, id)
+	}
+
+	path := make([]*URL, 0, len(ids))
+	for _, id := range ids {
+		url, err := u.GetURLById(id)
+		if err != nil {
+			return nil, err
+		}
+		if url == nil {
+			return nil, fmt.Errorf("URL %d of link path not found", id)
+		}
+		path = append(path, url)
+	}
+
+	return path, nil
+}
+
+// Expands the search for a link path by a level, following the links of the
+// frontier's URLs. Outbound links are followed when searching forward from
+// the start, and inbound links when searching back from the end. The URLs
+// visited are added to visited, and returned as the next frontier. If URLs
+// already visited by the other end's search are reached, the one with the
+// shortest path is returned as where the searches meet.
+func (u *URLClient) expandLinkPath(frontier []common.URLId, visited, other map[common.URLId]linkVisit, outbound bool) ([]common.URLId, common.URLId, bool, error) {
+	fromCol := "url_id"
+	if outbound {
+		fromCol = "refer_id"
+	}
+
+	next := []common.URLId{}
+	var meet common.URLId
+	found, meetDist := false, 0
+	for len(frontier) > 0 {
+		n := len(frontier)
+		if n > maxLinkQueryIds {
+			n = maxLinkQueryIds
+		}
+		chunk := frontier[:n]
+		frontier = frontier[n:]
+
+		args := make([]interface{}, 0, len(chunk))
+		placeholders := make([]string, 0, len(chunk))
+		for _, id := range chunk {
+			args = append(args, id)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+
+		rows, err := u.client.query(`SELECT refer_id, url_id FROM url_link WHERE `+fromCol+` IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+		if err != nil {
+			return nil, meet, false, err
+		}
+
+		for rows.Next() {
+			var referId, urlId sql.NullInt64
+			if err := rows.Scan(&referId, &urlId); err != nil {
+				rows.Close()
+				return nil, meet, false, err
+			}
+
+			from, to := common.URLId(urlId.Int64), common.URLId(referId.Int64)
+			if outbound {
+				from, to = to, from
+			}
+			if _, ok := visited[to]; ok {
+				continue
+			}
+			visited[to] = linkVisit{prev: from, dist: visited[from].dist + 1}
+			next = append(next, to)
+
+			if v, ok := other[to]; ok {
+				if dist := visited[to].dist + v.dist; !found || dist < meetDist {
+					meet, found, meetDist = to, true, dist
+				}
+			}
+		}
+		// Closed before the next query, since SQLite only has a single connection.
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, meet, false, err
+		}
+	}
+
+	return next, meet, found, nil
+}
+
 // Adds a new URL to the database returning a URL object for it.
 // If no mime is known us common.DefaultMime in its place.
 func (u *URLClient) Add(url, mime string) (*URL, error) {
-	// magic
+	// Ignores the insert if the URL already exists, so that the id can
+	// be selected regardless of if the URL was just added or not.
 	const queryURLAdd = `
-WITH s AS (
-    SELECT id, url
-    FROM url
-    WHERE url = $1
-), i as (
-    INSERT INTO url (url, mime)
-    SELECT $1, $2
-    WHERE NOT EXISTS (SELECT 1 FROM s)
-    RETURNING id
-)
-SELECT id
-from i
-union all
-select id
-from s`
+INSERT INTO url (url, mime, host)
+	SELECT $1, $2, $3
+	WHERE NOT EXISTS (SELECT 1 FROM url WHERE url = $1)`
+	const queryURLId = `SELECT id FROM url WHERE url = $1`
+
+	if _, err := u.client.exec(queryURLAdd, url, mime, common.URLHost(url)); err != nil {
+		return nil, err
+	}
 
 	var id sql.NullInt64
-	if err := u.client.db.QueryRow(queryURLAdd, url, mime).Scan(&id); err != nil {
+	if err := u.client.queryRow(queryURLId, url).Scan(&id); err != nil {
 		return nil, err
 	}
 	if !id.Valid {
@@ -122,18 +331,99 @@ INSERT INTO url_link (url_id, refer_id)
 	SELECT $1, $2
 	WHERE NOT EXISTS (SELECT 1 FROM url_link WHERE url_id = $1 AND refer_id = $2)`
 
-	if _, err := u.client.db.Exec(queryURLInsertLink, urlId, referId); err != nil {
+	if _, err := u.client.exec(queryURLInsertLink, urlId, referId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Updates the mime content-type and fetch metadata of a preexisting URL,
+// and marks it as crawled.
+func (u *URLClient) MarkCrawled(urlId common.URLId, mime string, fetch *Fetch) error {
+	queryURLUpdateCrawled := `
+UPDATE url SET mime = $1, crawled_on = $2, crawl_status = $3, ` + fetchColumnsUpdate(5) + `
+WHERE id = $4`
+
+	crawledOn := time.Now().UTC()
+	args := append([]interface{}{mime, crawledOn, common.CrawlStatusCrawled, urlId}, fetchArgs(fetch, crawledOn)...)
+	if _, err := u.client.exec(queryURLUpdateCrawled, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Updates the fetch metadata of a preexisting URL which was only checked,
+// without its content being scraped. The URL's mime is only updated if one
+// is provided. The URL is not marked as crawled.
+func (u *URLClient) MarkChecked(urlId common.URLId, mime string, fetch *Fetch) error {
+	queryURLUpdateChecked := `
+UPDATE url SET mime = CASE WHEN $1 = '' THEN mime ELSE $1 END, ` + fetchColumnsUpdate(3) + `
+WHERE id = $2`
+
+	args := append([]interface{}{mime, urlId}, fetchArgs(fetch, time.Now().UTC())...)
+	if _, err := u.client.exec(queryURLUpdateChecked, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Updates the fetch metadata of a preexisting URL which failed to be fetched.
+// The URL's crawled on time is not changed, so a URL which has not been
+// crawled before can still be crawled again.
+func (u *URLClient) MarkFetchFailed(urlId common.URLId, fetch *Fetch) error {
+	queryURLUpdateFailed := `
+UPDATE url SET crawl_status = $1, ` + fetchColumnsUpdate(3) + `
+WHERE id = $2`
+
+	args := append([]interface{}{common.CrawlStatusFailed, urlId}, fetchArgs(fetch, time.Now().UTC())...)
+	if _, err := u.client.exec(queryURLUpdateFailed, args...); err != nil {
 		return err
 	}
 	return nil
 }
 
-// Updates the mime content-type of a preexisting URL.
-func (u *URLClient) MarkCrawled(urlId common.URLId, mime string) error {
-	const queryURLUpdateMime = `UPDATE url SET mime = $1, crawled_on = $2 WHERE id = $3`
+// Returns the assignments of the fetch metadata columns for a URL update
+// query, with placeholders numbered from first. The query's arguments for
+// the placeholders are returned by fetchArgs.
+func fetchColumnsUpdate(first int) string {
+	columns := []string{
+		"status_code", "final_url", "content_length", "etag", "last_modified",
+		"response_time", "fetch_error", "fetch_error_kind", "fetched_on",
+	}
+
+	sets := make([]string, len(columns))
+	for i, c := range columns {
+		sets[i] = fmt.Sprintf("%s = $%d", c, first+i)
+	}
+	return strings.Join(sets, ", ")
+}
+
+// Returns the query arguments for the fetchColumnsUpdate placeholders.
+func fetchArgs(fetch *Fetch, fetchedOn time.Time) []interface{} {
+	return []interface{}{
+		fetch.StatusCode, fetch.FinalURL, fetch.ContentLength, fetch.ETag, fetch.LastModified,
+		fetch.ResponseTime.Milliseconds(), fetch.Error, fetch.ErrorKind, fetchedOn,
+	}
+}
+
+// Marks a preexisting URL as crawled, but blocked by the site's robots.txt.
+// The URL's mime is not changed since the URL was never requested.
+func (u *URLClient) MarkRobotsBlocked(urlId common.URLId) error {
+	const queryURLUpdateBlocked = `UPDATE url SET crawled_on = $1, crawl_status = $2 WHERE id = $3`
 
 	crawledOn := time.Now().UTC()
-	if _, err := u.client.db.Exec(queryURLUpdateMime, mime, crawledOn, urlId); err != nil {
+	if _, err := u.client.exec(queryURLUpdateBlocked, crawledOn, common.CrawlStatusRobotsBlocked, urlId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Records the time stamp a sitemap listed a preexisting URL's content as
+// last modified.
+func (u *URLClient) SetLastMod(urlId common.URLId, lastMod time.Time) error {
+	const queryURLUpdateLastMod = `UPDATE url SET lastmod = $1 WHERE id = $2`
+
+	if _, err := u.client.exec(queryURLUpdateLastMod, lastMod.UTC(), urlId); err != nil {
 		return err
 	}
 	return nil
@@ -147,7 +437,7 @@ INSERT INTO url_pending (job_id, url_id, origin_id)
 	SELECT $1, $2, $3
 	WHERE NOT EXISTS (SELECT 1 FROM url_pending WHERE job_id = $1 AND url_id = $2 AND origin_id = $3)`
 
-	if _, err := u.client.db.Exec(queryURLAddPending, jobId, urlId, originId); err != nil {
+	if _, err := u.client.exec(queryURLAddPending, jobId, urlId, originId); err != nil {
 		return err
 	}
 	return nil
@@ -159,7 +449,7 @@ INSERT INTO url_pending (job_id, url_id, origin_id)
 func (u *URLClient) DeletePending(jobId common.JobId, urlId, originId common.URLId) error {
 	const queryURLDeletePending = `DELETE FROM url_pending WHERE job_id = $1 AND url_id = $2 AND origin_id = $3`
 
-	if _, err := u.client.db.Exec(queryURLDeletePending, jobId, urlId, originId); err != nil {
+	if _, err := u.client.exec(queryURLDeletePending, jobId, urlId, originId); err != nil {
 		return err
 	}
 	return nil
@@ -170,31 +460,38 @@ func (u *URLClient) HasPending(jobId common.JobId, originId common.URLId) (bool,
 	const queryURLHasPending = `SELECT exists(SELECT 1 FROM url_pending WHERE job_id = $1 AND origin_id = $2)`
 
 	var pending sql.NullBool
-	if err := u.client.db.QueryRow(queryURLHasPending, jobId, originId).Scan(&pending); err != nil {
+	if err := u.client.queryRow(queryURLHasPending, jobId, originId).Scan(&pending); err != nil {
 		return false, err
 	}
 
 	return pending.Valid && pending.Bool, nil
 }
 
-// Records a new crawled URL into the job results, for a specific jobId. If the result record
-// already exists, the insert statement will be ignored.
-func (u *URLClient) AddResult(jobId common.JobId, referId, urlId common.URLId) error {
+// Records a new crawled URL into the job results, for a specific jobId. The level
+// is the number of links from the job's URL to the result. If the result record
+// already exists, the insert statement will be ignored. Returns if the result
+// was added.
+func (u *URLClient) AddResult(jobId common.JobId, referId, urlId common.URLId, level int) (bool, error) {
 	const queryURLInsertResult = `
-INSERT INTO job_result (job_id, refer_id, url_id)
-	SELECT $1, $2, $3
+INSERT INTO job_result (job_id, refer_id, url_id, level)
+	SELECT $1, $2, $3, $4
 	WHERE NOT EXISTS (SELECT 1 FROM job_result WHERE job_id = $1 AND refer_id = $2 AND url_id = $3)`
 
-	if _, err := u.client.db.Exec(queryURLInsertResult, jobId, referId, urlId); err != nil {
-		return err
+	res, err := u.client.exec(queryURLInsertResult, jobId, referId, urlId, level)
+	if err != nil {
+		return false, err
 	}
-	return nil
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
 }
 
 // Adds a batch of URLs to the job results. Will update the job result for each job Id provided
-func (u *URLClient) AddURLsToResults(jobId common.JobId, referId common.URLId, urls []*URL) error {
+func (u *URLClient) AddURLsToResults(jobId common.JobId, referId common.URLId, level int, urls []*URL) error {
 	for _, url := range urls {
-		if err := u.AddResult(jobId, referId, url.Id); err != nil {
+		if _, err := u.AddResult(jobId, referId, url.Id, level); err != nil {
 			return err
 		}
 	}
@@ -202,14 +499,16 @@ func (u *URLClient) AddURLsToResults(jobId common.JobId, referId common.URLId, u
 }
 
 // Marks a pre-existing job's URL as completed. This means that all descendants have been
-// crawled up to the max level.
+// crawled up to the max level. URLs of cancelled jobs are not marked, so the job keeps
+// the counts it was cancelled with.
 func (u *URLClient) MarkJobURLComplete(jobId common.JobId, urlId common.URLId) error {
 	const queryURLJobURComplete = `
 UPDATE job_url SET completed_on = $1
-	WHERE job_id = $2 AND url_id = $3 AND completed_on IS NULL`
+	WHERE job_id = $2 AND url_id = $3 AND completed_on IS NULL
+	AND NOT EXISTS (SELECT 1 FROM job WHERE id = $2 AND state = $4)`
 
 	curTime := time.Now().UTC()
-	if _, err := u.client.db.Exec(queryURLJobURComplete, curTime, jobId, urlId); err != nil {
+	if _, err := u.client.exec(queryURLJobURComplete, curTime, jobId, urlId, common.JobStateCancelled); err != nil {
 		return err
 	}
 	return nil
@@ -230,48 +529,47 @@ func (u *URLClient) UpdateJobURLIfComplete(jobId common.JobId, urlId common.URLI
 }
 
 // Extracts the URL from a QueryRow row. If no URL is found, nil will be returned for the URL
-// Expects the query columns to be the following order:
-//		id, url, mime, crawled_on
+// Expects the query columns to be urlColumns.
 func getURLFromRow(row *sql.Row) (*URL, error) {
-	var (
-		id        sql.NullInt64
-		url       sql.NullString
-		mime      sql.NullString
-		crawledOn pq.NullTime
-	)
-
-	if err := row.Scan(&id, &url, &mime, &crawledOn); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+	url, err := scanURL(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-
-	if !id.Valid || !url.Valid {
-		return nil, fmt.Errorf("Invalid URL result from QueryRow scan")
-	}
-
-	return &URL{
-		Id:        common.URLId(id.Int64),
-		URL:       url.String,
-		Mime:      mime.String,
-		Crawled:   crawledOn.Valid,
-		CrawledOn: crawledOn.Time,
-	}, nil
+	return url, err
 }
 
-// Extracts the URL fields from a Query rows. If no URL is found, nil will be returned for the URL
-// Expects the query columns to be the following order:
-//		id, url, mime, crawled_on
+// Extracts the URL fields from a Query rows.
+// Expects the query columns to be urlColumns.
 func getURLFromRows(rows *sql.Rows) (*URL, error) {
+	return scanURL(rows)
+}
+
+// Scans the urlColumns of a row into a URL record. Satisfied by both
+// sql.Row and sql.Rows.
+func scanURL(row interface {
+	Scan(dest ...interface{}) error
+}) (*URL, error) {
 	var (
-		id        sql.NullInt64
-		url       sql.NullString
-		mime      sql.NullString
-		crawledOn pq.NullTime
+		id            sql.NullInt64
+		url           sql.NullString
+		mime          sql.NullString
+		crawledOn     sql.NullTime
+		crawlStatus   sql.NullString
+		statusCode    sql.NullInt64
+		finalURL      sql.NullString
+		contentLength sql.NullInt64
+		etag          sql.NullString
+		lastModified  sql.NullString
+		responseTime  sql.NullInt64
+		fetchError    sql.NullString
+		errorKind     sql.NullString
+		fetchedOn     sql.NullTime
+		lastMod       sql.NullTime
 	)
 
-	if err := rows.Scan(&id, &url, &mime, &crawledOn); err != nil {
+	if err := row.Scan(&id, &url, &mime, &crawledOn, &crawlStatus,
+		&statusCode, &finalURL, &contentLength, &etag, &lastModified,
+		&responseTime, &fetchError, &errorKind, &fetchedOn, &lastMod); err != nil {
 		return nil, err
 	}
 
@@ -280,10 +578,23 @@ func getURLFromRows(rows *sql.Rows) (*URL, error) {
 	}
 
 	return &URL{
-		Id:        common.URLId(id.Int64),
-		URL:       url.String,
-		Mime:      mime.String,
-		Crawled:   crawledOn.Valid,
-		CrawledOn: crawledOn.Time,
+		Id:          common.URLId(id.Int64),
+		URL:         url.String,
+		Mime:        mime.String,
+		Crawled:     crawledOn.Valid,
+		CrawledOn:   crawledOn.Time,
+		CrawlStatus: crawlStatus.String,
+		Fetch: Fetch{
+			StatusCode:    int(statusCode.Int64),
+			FinalURL:      finalURL.String,
+			ContentLength: contentLength.Int64,
+			ETag:          etag.String,
+			LastModified:  lastModified.String,
+			ResponseTime:  time.Duration(responseTime.Int64) * time.Millisecond,
+			Error:         fetchError.String,
+			ErrorKind:     errorKind.String,
+			FetchedOn:     fetchedOn.Time,
+		},
+		LastMod: lastMod.Time,
 	}, nil
 }
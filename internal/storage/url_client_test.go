@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestURLAdd(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	urlClient := sc.URLClient()
+
+	u, err := urlClient.Add("http://example.com", "text/html")
+	require.Nil(t, err, "Expect no error adding URL")
+
+	again, err := urlClient.GetOrAddURLByURL("http://example.com", "")
+	require.Nil(t, err, "Expect no error getting URL")
+	assert.Equal(t, u.Id, again.Id, "Expect same URL record")
+	assert.Equal(t, "text/html", again.Mime, "Expect mime to be unchanged")
+	assert.False(t, again.Crawled, "Expect URL not crawled")
+
+	fetch := &Fetch{
+		StatusCode:    200,
+		FinalURL:      "http://example.com/",
+		ContentLength: 42,
+		ETag:          `"abc"`,
+		LastModified:  "Sun, 01 Mar 2015 12:00:00 GMT",
+		ResponseTime:  150 * time.Millisecond,
+	}
+	require.Nil(t, urlClient.MarkCrawled(u.Id, "text/plain", fetch), "Expect no error marking crawled")
+	crawled, err := urlClient.GetURLById(u.Id)
+	require.Nil(t, err, "Expect no error getting URL")
+	assert.True(t, crawled.Crawled, "Expect URL crawled")
+	assert.Equal(t, "text/plain", crawled.Mime, "Expect mime updated")
+	assert.False(t, crawled.Fetch.FetchedOn.IsZero(), "Expect fetched on set")
+	fetch.FetchedOn = crawled.Fetch.FetchedOn
+	assert.Equal(t, *fetch, crawled.Fetch, "Expect fetch metadata stored")
+
+	require.Nil(t, urlClient.MarkFetchFailed(u.Id, &Fetch{StatusCode: 500, Error: "server error"}), "Expect no error marking failed")
+	failed, err := urlClient.GetURLById(u.Id)
+	require.Nil(t, err, "Expect no error getting URL")
+	assert.Equal(t, common.CrawlStatusFailed, failed.CrawlStatus, "Expect URL failed")
+	assert.Equal(t, 500, failed.Fetch.StatusCode, "Expect failed status code")
+	assert.Equal(t, "server error", failed.Fetch.Error, "Expect fetch error")
+
+	lastMod := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.Nil(t, urlClient.SetLastMod(u.Id, lastMod), "Expect no error setting lastmod")
+	modified, err := urlClient.GetURLById(u.Id)
+	require.Nil(t, err, "Expect no error getting URL")
+	assert.True(t, lastMod.Equal(modified.LastMod), "Expect lastmod stored")
+
+	missing, err := urlClient.GetURLByURL("http://example.org")
+	assert.Nil(t, err, "Expect no error for missing URL")
+	assert.Nil(t, missing, "Expect no URL")
+}
+
+func TestURLLinks(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	urlClient := sc.URLClient()
+
+	refer, _ := urlClient.Add("http://example.com", "text/html")
+	a, _ := urlClient.Add("http://example.com/a", "text/html")
+	b, _ := urlClient.Add("http://example.com/b", "text/html")
+
+	require.Nil(t, urlClient.AddLink(a.Id, refer.Id), "Expect no error adding link")
+	require.Nil(t, urlClient.AddLink(b.Id, refer.Id), "Expect no error adding link")
+	require.Nil(t, urlClient.AddLink(b.Id, refer.Id), "Expect duplicate link ignored")
+
+	urls, err := urlClient.GetAllURLsWithReferById(refer.Id)
+	require.Nil(t, err, "Expect no error getting descendants")
+	require.Len(t, urls, 2, "Expect descendants")
+	assert.Equal(t, "http://example.com/a", urls[0].URL, "Expect descendant to match")
+	assert.Equal(t, "http://example.com/b", urls[1].URL, "Expect descendant to match")
+}
+
+func TestURLLinkGraph(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	urlClient := sc.URLClient()
+
+	home, _ := urlClient.Add("http://example.com", "text/html")
+	a, _ := urlClient.Add("http://example.com/a", "text/html")
+	css, _ := urlClient.Add("http://example.com/style.css", "text/css")
+	b, _ := urlClient.Add("http://example.com/b", "text/html")
+	c, _ := urlClient.Add("http://example.com/c", "text/html")
+	logo, _ := urlClient.Add("http://example.com/logo.png", "image/png")
+
+	for _, link := range [][2]*URL{{home, a}, {home, css}, {a, b}, {b, c}, {css, logo}, {b, logo}, {c, a}} {
+		require.Nil(t, urlClient.AddLink(link[1].Id, link[0].Id), "Expect no error adding link")
+	}
+
+	urlsOf := func(urls []*URL, err error) []string {
+		require.Nil(t, err, "Expect no error")
+		strs := []string{}
+		for _, u := range urls {
+			strs = append(strs, u.URL)
+		}
+		return strs
+	}
+
+	assert.Equal(t, []string{"http://example.com/style.css", "http://example.com/b"}, urlsOf(urlClient.GetInboundLinks(logo.Id, 10)), "Expect inbound links")
+	assert.Equal(t, []string{"http://example.com/style.css"}, urlsOf(urlClient.GetInboundLinks(logo.Id, 1)), "Expect inbound links limited")
+	assert.Equal(t, []string{"http://example.com/a", "http://example.com/style.css"}, urlsOf(urlClient.GetOutboundLinks(home.Id, 10)), "Expect outbound links")
+	assert.Equal(t, []string{}, urlsOf(urlClient.GetOutboundLinks(logo.Id, 10)), "Expect no outbound links")
+	assert.Equal(t, []string{"http://example.com", "http://example.com/b"}, urlsOf(urlClient.GetPagesLinkingTo(logo.Id, 10)), "Expect pages using the asset directly, or by stylesheet")
+
+	assert.Equal(t, []string{"http://example.com", "http://example.com/a", "http://example.com/b", "http://example.com/c"}, urlsOf(urlClient.ShortestLinkPath(home.Id, c.Id, DefaultLinkPathDepth)), "Expect shortest path")
+	assert.Equal(t, []string{"http://example.com/c", "http://example.com/a", "http://example.com/b", "http://example.com/logo.png"}, urlsOf(urlClient.ShortestLinkPath(c.Id, logo.Id, DefaultLinkPathDepth)), "Expect shortest path")
+	assert.Equal(t, []string{"http://example.com"}, urlsOf(urlClient.ShortestLinkPath(home.Id, home.Id, DefaultLinkPathDepth)), "Expect path to itself")
+
+	path, err := urlClient.ShortestLinkPath(home.Id, c.Id, 2)
+	assert.Nil(t, err, "Expect no error")
+	assert.Nil(t, path, "Expect no path within depth")
+	path, err = urlClient.ShortestLinkPath(c.Id, home.Id, DefaultLinkPathDepth)
+	assert.Nil(t, err, "Expect no error")
+	assert.Nil(t, path, "Expect no path against the links")
+}
+
+func TestURLPendingCompletesJob(t *testing.T) {
+	sc := newTestClient(t)
+	defer sc.Close()
+	urlClient := sc.URLClient()
+
+	job, err := sc.JobClient().CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	origin := job.URLs[0].URLId
+	child, _ := urlClient.Add("http://example.com/a", "text/html")
+
+	require.Nil(t, urlClient.AddPending(job.Id, origin, origin), "Expect no error adding pending")
+	require.Nil(t, urlClient.AddPending(job.Id, child.Id, origin), "Expect no error adding pending")
+	require.Nil(t, urlClient.DeletePending(job.Id, origin, origin), "Expect no error deleting pending")
+
+	complete, err := urlClient.UpdateJobURLIfComplete(job.Id, origin)
+	require.Nil(t, err, "Expect no error updating job URL")
+	assert.False(t, complete, "Expect job URL still pending")
+
+	require.Nil(t, urlClient.DeletePending(job.Id, child.Id, origin), "Expect no error deleting pending")
+	complete, err = urlClient.UpdateJobURLIfComplete(job.Id, origin)
+	require.Nil(t, err, "Expect no error updating job URL")
+	assert.True(t, complete, "Expect job URL complete")
+
+	got, _ := sc.JobClient().GetJob(job.Id)
+	assert.True(t, got.URLs[0].Completed, "Expect job URL marked complete")
+}
@@ -0,0 +1,35 @@
+package web
+
+import (
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"net/http"
+	"path"
+)
+
+// Creates the HTTP handler to be able to provide an interface for serving
+// job requests. All routes are based off of the root path. Scheduled Job URLs
+// will be published to the URL queue. Job status streams are fed by the
+// progress subscriber. If the subscriber is nil job status streams are not
+// supported.
+func NewHandler(rootPath string, urlQueuePub queue.Publisher, progressSub queue.ProgressSubscriber, sc *storage.Client) http.Handler {
+	mux := http.NewServeMux()
+
+	var progress *progressHub
+	if progressSub != nil {
+		progress = newProgressHub(progressSub)
+	}
+
+	// The Trailing '/' have to be append because path.Join will strip off the trailing '/'
+	mux.Handle(path.Join("/", rootPath), &JobScheduleHandler{urlQueuePub: urlQueuePub, sc: sc})
+	mux.Handle(path.Join("/", rootPath, "jobs"), &JobListHandler{sc: sc})
+	mux.Handle(path.Join("/", rootPath, "status")+"/", &JobStatusHandler{sc: sc, progress: progress})
+	mux.Handle(path.Join("/", rootPath, "job")+"/", &JobControlHandler{urlQueuePub: urlQueuePub, sc: sc})
+	mux.Handle(path.Join("/", rootPath, "result")+"/", &JobResultHandler{sc: sc})
+	mux.Handle(path.Join("/", rootPath, "deadletters")+"/", &JobDeadLetterHandler{sc: sc})
+	mux.Handle(path.Join("/", rootPath, "callbacks")+"/", &JobCallbackHandler{sc: sc})
+	mux.Handle(path.Join("/", rootPath, "report")+"/", &JobReportHandler{sc: sc})
+	mux.Handle(path.Join("/", rootPath, "links")+"/", &LinkHandler{sc: sc})
+
+	return mux
+}
@@ -0,0 +1,149 @@
+package web
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"time"
+)
+
+// A callback of the job to its callback URL, and its delivery attempts.
+type jobCallbackMsg struct {
+	// Event the callback was made for, e.g: job.completed
+	Event string `json:"event"`
+
+	// URL the callback is delivered to
+	URL string `json:"url"`
+
+	// Delivery state of the callback, either pending, delivered, or failed
+	State string `json:"state"`
+
+	// Number of delivery attempts made
+	Attempts int `json:"attempts"`
+
+	// The time stamp the job was done.
+	CreatedOn time.Time `json:"createdOn"`
+
+	// The time stamp the callback was delivered, if it was.
+	DeliveredOn *time.Time `json:"deliveredOn,omitempty"`
+
+	// Earliest time the next delivery attempt will be made, if the
+	// callback is still pending.
+	NextAttemptOn *time.Time `json:"nextAttemptOn,omitempty"`
+
+	// Delivery attempts made, oldest first.
+	AttemptLog []jobCallbackAttemptMsg `json:"attemptLog"`
+}
+
+// Attempt to deliver a job's callback.
+type jobCallbackAttemptMsg struct {
+	// The time stamp the attempt was made.
+	AttemptedOn time.Time `json:"attemptedOn"`
+
+	// HTTP status code of the response. Zero if there was no response.
+	StatusCode int `json:"statusCode"`
+
+	// Error the attempt failed with, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// Handles the request for the callbacks of a previously scheduled job, and
+// their delivery attempts. A callback is made to the job's callback URL once
+// the job is completed, or cancelled. Returns an error if the job isn't found,
+// or invalid input. If the job does not exists a 404 status code and message
+// will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/callbacks/1234"
+//
+// Response:
+//	- Success: [{event: job.completed, url: <url>, state: delivered, attempts: 2, createdOn: <time>, deliveredOn: <time>, attemptLog: [{attemptedOn: <time>, statusCode: 500, error: <error>}, ...]}]
+//	- Failure: {code: <code>, message: <message>}
+type JobCallbackHandler struct {
+	sc *storage.Client
+}
+
+func (h *JobCallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobCallback request failed.", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cbs, jobErr := h.jobCallbacks(id)
+	if jobErr != nil {
+		log.Println("routeJobCallback request job callbacks failed.", jobErr)
+		writeJSONError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	msgs := make([]jobCallbackMsg, 0, len(cbs))
+	for _, cb := range cbs {
+		msgs = append(msgs, newJobCallbackMsg(cb))
+	}
+
+	writeJSON(w, msgs, http.StatusOK)
+}
+
+// Creates the response message of the job's callback.
+func newJobCallbackMsg(cb *storage.Callback) jobCallbackMsg {
+	msg := jobCallbackMsg{
+		Event:      cb.Event,
+		URL:        cb.URL,
+		State:      cb.State,
+		Attempts:   cb.Attempts,
+		CreatedOn:  cb.CreatedOn,
+		AttemptLog: make([]jobCallbackAttemptMsg, 0, len(cb.AttemptLog)),
+	}
+	if !cb.DeliveredOn.IsZero() {
+		deliveredOn := cb.DeliveredOn
+		msg.DeliveredOn = &deliveredOn
+	}
+	if cb.State == common.CallbackStatePending {
+		nextAttemptOn := cb.NextAttemptOn
+		msg.NextAttemptOn = &nextAttemptOn
+	}
+	for _, a := range cb.AttemptLog {
+		msg.AttemptLog = append(msg.AttemptLog, jobCallbackAttemptMsg{
+			AttemptedOn: a.AttemptedOn,
+			StatusCode:  a.StatusCode,
+			Error:       a.Error,
+		})
+	}
+
+	return msg
+}
+
+// Connects to the remote service hosting job information, and
+// the job's callbacks. The job must exist.
+func (h *JobCallbackHandler) jobCallbacks(id common.JobId) ([]*storage.Callback, *ErroMsg) {
+	job, err := h.sc.JobClient().GetJob(id)
+	if err != nil || job == nil {
+		return nil, &ErroMsg{
+			Source: "jobCallbacks",
+			Info:   fmt.Sprintf("Failed to get job %d", id),
+			Err:    err,
+		}
+	}
+
+	cbs, err := h.sc.CallbackClient().List(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobCallbacks",
+			Info:   fmt.Sprintf("Failed to get job %d callbacks", id),
+			Err:    err,
+		}
+	}
+
+	return cbs, nil
+}
@@ -0,0 +1,184 @@
+package web
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Actions which can be taken on a job.
+const (
+	jobActionCancel = "cancel"
+	jobActionPause  = "pause"
+	jobActionResume = "resume"
+)
+
+// Handles the requests to cancel, pause, or resume a previously scheduled job.
+// Returns an error if the job isn't found, can't take the action, or invalid
+// input. If the action was taken, or the job was already in the action's
+// state, the job's status will be returned.
+//
+// Cancelled jobs' remaining URLs will not be crawled, and their queued URLs
+// are dropped by the foreman and workers as they come off the queues.
+// Completed jobs can't be cancelled. If the job has a callback URL the
+// cancellation is delivered to it.
+//
+// Paused jobs' queued URLs are parked by the foreman instead of being sent
+// to the workers. URLs already sent to the workers are still crawled. When
+// the job is resumed its parked URLs are queued again. Only running jobs can
+// be paused.
+//
+// e.g:
+// curl -X DELETE "http://localhost:8080/job/1234"
+// curl -X POST "http://localhost:8080/job/1234/cancel"
+// curl -X POST "http://localhost:8080/job/1234/pause"
+// curl -X POST "http://localhost:8080/job/1234/resume"
+//
+// Response:
+//	- Success: {state: paused, completed: 2, pending: 3, parked: 10, elapsed: 5m10s, urls: { <url>: <complete> } }
+//	- Failure: {code: <code>, message: <message>}
+type JobControlHandler struct {
+	urlQueuePub queue.Publisher
+	sc          *storage.Client
+}
+
+func (h *JobControlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	idStr, action := path.Base(r.URL.Path), jobActionCancel
+	switch r.Method {
+	case "DELETE":
+	case "POST":
+		idStr, action = path.Base(path.Dir(r.URL.Path)), idStr
+	default:
+		w.Header().Set("Allow", "DELETE, POST")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := jobIdFromString(idStr)
+	if err != nil {
+		log.Println("routeJobControl request failed.", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		status *common.JobStatus
+		jobErr *ErroMsg
+		// States the job can be in after the action
+		allowed []string
+	)
+	switch action {
+	case jobActionCancel:
+		status, jobErr = h.cancelJob(id)
+		allowed = []string{common.JobStateCancelled}
+	case jobActionPause:
+		status, jobErr = h.pauseJob(id)
+		allowed = []string{common.JobStatePaused}
+	case jobActionResume:
+		status, jobErr = h.resumeJob(id)
+		allowed = []string{common.JobStateRunning, common.JobStateCompleted}
+	default:
+		writeJSONError(w, "NotFound", fmt.Sprintf("Unknown job action %s", action), http.StatusNotFound)
+		return
+	}
+	if jobErr != nil {
+		log.Println("routeJobControl request job", action, "failed.", jobErr)
+		writeJSONError(w, "DependancyFailure", jobErr.Short(), http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		writeJSONError(w, "NotFound", fmt.Sprintf("Job %d not found", id), http.StatusNotFound)
+		return
+	}
+
+	for _, state := range allowed {
+		if status.State == state {
+			writeJSON(w, newJobStatusMsg(status), http.StatusOK)
+			return
+		}
+	}
+	writeJSONError(w, "Conflict", fmt.Sprintf("Job %d can't %s, it is %s", id, action, status.State), http.StatusConflict)
+}
+
+// Cancels the job, and returns its status. The job's callback is recorded
+// so the notifier will deliver it. Nil is returned if the job does not exist.
+func (h *JobControlHandler) cancelJob(id common.JobId) (*common.JobStatus, *ErroMsg) {
+	cancelled, err := h.sc.JobClient().Cancel(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "cancelJob",
+			Info:   fmt.Sprintf("Failed to cancel job %d", id),
+			Err:    err,
+		}
+	}
+	if cancelled {
+		if _, err := h.sc.CallbackClient().AddIfDone(id); err != nil {
+			log.Println("cancelJob failed to add job callback", id, err)
+		}
+	}
+
+	return h.jobStatus(id)
+}
+
+// Pauses the job, and returns its status. Nil is returned if the job
+// does not exist.
+func (h *JobControlHandler) pauseJob(id common.JobId) (*common.JobStatus, *ErroMsg) {
+	if _, err := h.sc.JobClient().Pause(id); err != nil {
+		return nil, &ErroMsg{
+			Source: "pauseJob",
+			Info:   fmt.Sprintf("Failed to pause job %d", id),
+			Err:    err,
+		}
+	}
+
+	return h.jobStatus(id)
+}
+
+// Resumes the job, queuing its parked items again, and returns its status.
+// Nil is returned if the job does not exist.
+func (h *JobControlHandler) resumeJob(id common.JobId) (*common.JobStatus, *ErroMsg) {
+	if _, err := h.sc.JobClient().Resume(id); err != nil {
+		return nil, &ErroMsg{
+			Source: "resumeJob",
+			Info:   fmt.Sprintf("Failed to resume job %d", id),
+			Err:    err,
+		}
+	}
+
+	// Items are taken even if the job was already resumed, so items
+	// parked while it was being resumed are not left behind.
+	items, err := h.sc.ParkedClient().Take(id)
+	for _, item := range items {
+		h.urlQueuePub.Send(item)
+	}
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "resumeJob",
+			Info:   fmt.Sprintf("Failed to queue parked items of job %d", id),
+			Err:    err,
+		}
+	}
+
+	return h.jobStatus(id)
+}
+
+// Returns the status of the job. Nil is returned if the job does not exist.
+func (h *JobControlHandler) jobStatus(id common.JobId) (*common.JobStatus, *ErroMsg) {
+	job, err := h.sc.JobClient().GetJob(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobStatus",
+			Info:   fmt.Sprintf("Failed to get job %d status", id),
+			Err:    err,
+		}
+	}
+	if job == nil {
+		return nil, nil
+	}
+
+	return job.Status(), nil
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"time"
+)
+
+// A URL which failed to be crawled for the job after all of its attempts.
+type jobDeadLetterMsg struct {
+	// URL which failed to be crawled
+	URL string `json:"url"`
+
+	// Number of times the URL was attempted to be crawled
+	Attempts int `json:"attempts"`
+
+	// Error of the last attempt
+	LastError string `json:"lastError"`
+
+	// HTTP status code of the last attempt. Zero if there was no response.
+	StatusCode int `json:"statusCode"`
+
+	// The time stamp the URL was given up on.
+	CreatedOn time.Time `json:"createdOn"`
+}
+
+// Handles the request for the URLs of a previously scheduled job which
+// failed to be crawled after all of their attempts. Returns an error if
+// the job isn't found, or invalid input. If the job does not exists a 404
+// status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/deadletters/1234"
+//
+// Response:
+//	- Success: [{url: <url>, attempts: 3, lastError: <error>, statusCode: 500, createdOn: <time>}, ...]
+//	- Failure: {code: <code>, message: <message>}
+type JobDeadLetterHandler struct {
+	sc *storage.Client
+}
+
+func (h *JobDeadLetterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobDeadLetter request failed.", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dls, jobErr := h.jobDeadLetters(id)
+	if jobErr != nil {
+		log.Println("routeJobDeadLetter request job dead letters failed.", jobErr)
+		writeJSONError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	msgs := make([]jobDeadLetterMsg, 0, len(dls))
+	for _, dl := range dls {
+		msgs = append(msgs, jobDeadLetterMsg{
+			URL:        dl.URL,
+			Attempts:   dl.Attempts,
+			LastError:  dl.LastError,
+			StatusCode: dl.StatusCode,
+			CreatedOn:  dl.CreatedOn,
+		})
+	}
+
+	writeJSON(w, msgs, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and
+// the job's dead letters. The job must exist.
+func (h *JobDeadLetterHandler) jobDeadLetters(id common.JobId) ([]*storage.DeadLetter, *ErroMsg) {
+	job, err := h.sc.JobClient().GetJob(id)
+	if err != nil || job == nil {
+		return nil, &ErroMsg{
+			Source: "jobDeadLetters",
+			Info:   fmt.Sprintf("Failed to get job %d", id),
+			Err:    err,
+		}
+	}
+
+	dls, err := h.sc.DeadLetterClient().List(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobDeadLetters",
+			Info:   fmt.Sprintf("Failed to get job %d dead letters", id),
+			Err:    err,
+		}
+	}
+
+	return dls, nil
+}
@@ -0,0 +1,188 @@
+package web
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Default number of jobs listed in a page, if no limit is requested.
+const defaultJobListLimit = 50
+
+// Response to a successful request to list jobs
+type jobListMsg struct {
+	// Jobs of the requested page
+	Jobs []jobListEntryMsg `json:"jobs"`
+
+	// Number of jobs matching the filters, across all pages
+	Total int `json:"total"`
+
+	// Number of matching jobs skipped before this page
+	Offset int `json:"offset"`
+
+	// Maximum number of jobs in the page
+	Limit int `json:"limit"`
+}
+
+// Summary of a listed job, including its status.
+type jobListEntryMsg struct {
+	// Id of the job
+	Id common.JobId `json:"id"`
+
+	// The time stamp the job was created on.
+	CreatedOn time.Time `json:"createdOn"`
+
+	jobStatusMsg
+}
+
+// Handles the request to list previously scheduled jobs. The jobs can be
+// filtered, sorted, and paged with query parameters. Each listed job includes
+// its status.
+//
+// Parameters:
+//	- state: Only jobs in the state, either running, paused, completed, or cancelled
+//	- createdAfter: Only jobs created on or after the time, e.g: 2015-06-01, or 2015-06-01T12:00:00Z
+//	- createdBefore: Only jobs created before the time
+//	- tag: Only jobs scheduled with the tag
+//	- url: Only jobs with a Job URL containing the value, not case sensitive
+//	- sort: Order of the jobs, either created (default), id, or state
+//	- order: Direction of the sort, either desc (default), or asc
+//	- limit: Maximum number of jobs returned, defaults to 50, up to 500
+//	- offset: Number of matching jobs to skip
+//
+// e.g:
+// curl -X GET "http://localhost:8080/jobs?state=running&tag=nightly&limit=10"
+//
+// Response:
+//	- Success: {jobs: [{id: 1234, createdOn: <time>, state: running, completed: 2, pending: 3, ...}, ...], total: 12, offset: 0, limit: 10}
+//	- Failure: {code: <code>, message: <message>}
+type JobListHandler struct {
+	sc *storage.Client
+}
+
+func (h *JobListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := getJobListQuery(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobList request failed.", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg, jobErr := h.listJobs(q)
+	if jobErr != nil {
+		log.Println("routeJobList request list jobs failed.", jobErr)
+		writeJSONError(w, "DependancyFailure", jobErr.Short(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, msg, http.StatusOK)
+}
+
+// Reads the filters, sort order, and page of the jobs to list from the
+// query parameters. An error is returned if a parameter is not valid.
+func getJobListQuery(query url.Values) (storage.JobListQuery, error) {
+	q := storage.JobListQuery{
+		State: query.Get("state"),
+		Tag:   query.Get("tag"),
+		URL:   query.Get("url"),
+		Sort:  query.Get("sort"),
+		Limit: defaultJobListLimit,
+	}
+
+	switch q.State {
+	case "", common.JobStateRunning, common.JobStatePaused, common.JobStateCompleted, common.JobStateCancelled:
+	default:
+		return q, fmt.Errorf("Invalid state: %s", q.State)
+	}
+
+	switch q.Sort {
+	case "", storage.JobSortCreated, storage.JobSortId, storage.JobSortState:
+	default:
+		return q, fmt.Errorf("Invalid sort: %s", q.Sort)
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return q, fmt.Errorf("Invalid order: %s", order)
+	}
+
+	var err error
+	if q.CreatedAfter, err = parseQueryTime(query, "createdAfter"); err != nil {
+		return q, err
+	}
+	if q.CreatedBefore, err = parseQueryTime(query, "createdBefore"); err != nil {
+		return q, err
+	}
+
+	if v := query.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 || q.Limit > storage.MaxJobListLimit {
+			return q, fmt.Errorf("Invalid limit: %s, must be between 1 and %d", v, storage.MaxJobListLimit)
+		}
+	}
+	if v := query.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("Invalid offset: %s", v)
+		}
+	}
+
+	return q, nil
+}
+
+// Parses the time of the query parameter, either as a RFC 3339 time stamp,
+// or a date. Zero is returned if the parameter is not set.
+func parseQueryTime(query url.Values, key string) (time.Time, error) {
+	v := query.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid %s: %s, expected a date or RFC 3339 time", key, v)
+}
+
+// Lists the jobs matching the query, and creates the response message of
+// their statuses.
+func (h *JobListHandler) listJobs(q storage.JobListQuery) (*jobListMsg, *ErroMsg) {
+	jobs, total, err := h.sc.JobClient().List(q)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "listJobs",
+			Info:   "Failed to list jobs",
+			Err:    err,
+		}
+	}
+
+	msg := &jobListMsg{
+		Jobs:   make([]jobListEntryMsg, 0, len(jobs)),
+		Total:  total,
+		Offset: q.Offset,
+		Limit:  q.Limit,
+	}
+	for _, job := range jobs {
+		msg.Jobs = append(msg.Jobs, jobListEntryMsg{
+			Id:           job.Id,
+			CreatedOn:    job.CreatedOn,
+			jobStatusMsg: newJobStatusMsg(job.Status()),
+		})
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,38 @@
+package web
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGetJobListQuery(t *testing.T) {
+	query, _ := url.ParseQuery("state=running&tag=nightly&url=example&sort=id&order=asc&createdAfter=2015-06-01&createdBefore=2015-06-02T12:00:00Z&limit=10&offset=20")
+	q, err := getJobListQuery(query)
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, storage.JobListQuery{
+		State:         common.JobStateRunning,
+		Tag:           "nightly",
+		URL:           "example",
+		Sort:          storage.JobSortId,
+		Ascending:     true,
+		CreatedAfter:  time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC),
+		CreatedBefore: time.Date(2015, 6, 2, 12, 0, 0, 0, time.UTC),
+		Limit:         10,
+		Offset:        20,
+	}, q, "Expect query")
+
+	q, err = getJobListQuery(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, storage.JobListQuery{Limit: defaultJobListLimit}, q, "Expect defaults")
+
+	for _, invalid := range []string{"state=done", "sort=name", "order=up", "createdAfter=yesterday", "limit=0", "limit=1000", "offset=-1"} {
+		query, _ := url.ParseQuery(invalid)
+		_, err := getJobListQuery(query)
+		assert.NotNil(t, err, "Expect %s to be invalid", invalid)
+	}
+}
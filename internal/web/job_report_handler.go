@@ -0,0 +1,106 @@
+package web
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Name of the broken links report.
+const reportBrokenLinks = "broken-links"
+
+// A URL of the job's results which failed to be fetched.
+type jobBrokenLinkMsg struct {
+	// URL which failed to be fetched
+	URL string `json:"url"`
+
+	// HTTP status code of the response. Zero if there was no response.
+	StatusCode int `json:"statusCode"`
+
+	// Error the fetch failed with, if the fetch failed without a response
+	// or with a server error.
+	Error string `json:"error,omitempty"`
+
+	// Kind of error the fetch failed with, e.g: dns, tls, timeout.
+	ErrorKind string `json:"errorKind,omitempty"`
+}
+
+// Handles the request for a report of a previously scheduled job. Returns an
+// error if the job isn't found, the report isn't known, or invalid input. The
+// report will reflect the job's progress, and will be partial until the job
+// is completed. If the job does not exists a 404 status code and message will
+// be returned.
+//
+// Reports:
+//	- broken-links: URLs which responded with a 4xx or 5xx status, or failed to
+//	  be fetched because of DNS, TLS, timeout, or connection errors. Grouped
+//	  under the URL of the page which linked to them.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/1234/broken-links"
+//
+// Response:
+//	- Success: {<refer>: [ {url: <url>, statusCode: 404}, {url: <url>, statusCode: 0, error: <error>, errorKind: "dns"}, ... ], ...}
+//	- Failure: {code: <code>, message: <message>}
+type JobReportHandler struct {
+	sc *storage.Client
+}
+
+func (h *JobReportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := path.Base(r.URL.Path)
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobReport request failed.", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch report {
+	case reportBrokenLinks:
+		links, jobErr := h.jobBrokenLinks(id)
+		if jobErr != nil {
+			log.Println("routeJobReport request job broken links failed.", jobErr)
+			writeJSONError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, links, http.StatusOK)
+	default:
+		writeJSONError(w, "NotFound", fmt.Sprintf("Unknown report %s", report), http.StatusNotFound)
+	}
+}
+
+// Connects to the remote service hosting job information, and the job's
+// broken links grouped by the URL they were found on.
+func (h *JobReportHandler) jobBrokenLinks(id common.JobId) (map[string][]jobBrokenLinkMsg, *ErroMsg) {
+	links, err := h.sc.JobClient().BrokenLinks(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobBrokenLinks",
+			Info:   fmt.Sprintf("Failed to get job %d broken links", id),
+			Err:    err,
+		}
+	}
+
+	msgs := make(map[string][]jobBrokenLinkMsg, len(links))
+	for refer, referLinks := range links {
+		for _, l := range referLinks {
+			msgs[refer] = append(msgs[refer], jobBrokenLinkMsg{
+				URL:        l.URL,
+				StatusCode: l.StatusCode,
+				Error:      l.Error,
+				ErrorKind:  l.ErrorKind,
+			})
+		}
+	}
+
+	return msgs, nil
+}
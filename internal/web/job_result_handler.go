@@ -0,0 +1,439 @@
+package web
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default number of results in a page, if no limit is requested.
+const defaultResultPageLimit = 1000
+
+// Maximum number of results in a single page.
+const maxResultPageLimit = 10000
+
+// Number of results read from storage at a time while streaming. Each batch is
+// read before it is written, so the storage connection is not held while
+// waiting on a slow client.
+const resultStreamBatchSize = 1000
+
+// A single result of a job, as written in a page, or streamed.
+type jobResultMsg struct {
+	// Cursor of the result. Results added after it can be requested with
+	// the cursor.
+	Cursor int64 `json:"cursor"`
+
+	// URL the result was found on
+	Refer string `json:"refer"`
+
+	// URL of the result
+	URL string `json:"url"`
+
+	// Mime type of the result's content, if known.
+	Mime string `json:"mime,omitempty"`
+
+	// HTTP status code of the result's last fetch, if it was fetched.
+	StatusCode int `json:"status,omitempty"`
+
+	// Number of links from the job's URL to the result.
+	Level int `json:"level"`
+}
+
+// Response to a successful request for a page of results
+type jobResultPageMsg struct {
+	// Results of the page, in the order they were added.
+	Results []jobResultMsg `json:"results"`
+
+	// Cursor to request the following page with. If the page is empty it is
+	// the cursor the page was requested with.
+	Cursor int64 `json:"cursor"`
+
+	// If there are more results after this page.
+	More bool `json:"more"`
+}
+
+// Filters, format, and the page of the results requested.
+type jobResultQuery struct {
+	storage.ResultQuery
+
+	// Format the results are written in, e.g: csv. All formats other than
+	// JSON are streamed as the results are read.
+	Format string
+
+	// JSON results are requested as pages, instead of grouped by refer URL.
+	Paged bool
+}
+
+// Handles the request checking on the status of a previously scheduled job.
+// Returns an error if the job isn't found, or invalid input. If the job
+// exists its status will be returned. The results can be filtered by the
+// filter parameters, such as the 'mime' parameter which acts as a prefix
+// filter of the result's mime content type. Filter parameters can be repeated,
+// or be comma separated, to match results matching any of the values. If the
+// job does not exists a 404 status code and message will be returned.
+//
+// The results of large jobs can be requested in pages, or streamed. Paged and
+// streamed results are flat lists in the order the results were added, each
+// with the cursor following results can be requested after.
+//
+// The format of the results is selected by the 'format' parameter, or if not
+// set, negotiated with the Accept header. All formats other than JSON are
+// streamed.
+//
+// Parameters:
+//	- mime: Prefix of the result's mime type, e.g: image
+//	- host: Host of the result's URL, e.g: example.com
+//	- url: Glob pattern of the result's URL, e.g: http://example.com/*.png
+//	- urlRegexp: Regular expression of the result's URL
+//	- level: Number of links from the job's URL to the result, e.g: 1
+//	- status: HTTP status code of the result, or a class of codes, e.g: 404, or 4xx
+//	- refer: URL the result was found on
+//	- links: Either internal, for results on the same host as their refer URL, or external
+//	- limit: Maximum number of results in the page, defaults to 1000, up to 10000
+//	- cursor: Only results after the cursor returned with the previous page
+//	- since: Only results added after the cursor, to poll for new results while the job runs
+//	- stream: If true the results are streamed as newline delimited JSON
+//	- format: Either json (default), ndjson, csv, graphml, or dot
+//
+// e.g:
+// curl -X GET "http://localhost:8080/result/1234?mime=image"
+// curl -X GET "http://localhost:8080/result/1234?status=4xx,5xx&links=internal"
+// curl -X GET "http://localhost:8080/result/1234?limit=100&cursor=5678"
+// curl -X GET "http://localhost:8080/result/1234?stream=true"
+// curl -X GET -H "Accept: text/csv" "http://localhost:8080/result/1234"
+//
+// Response:
+//	- Success: {<domain>: [ <url>, ... ], ...}
+//	- Paged: {results: [{cursor: 5679, refer: <url>, url: <url>, mime: <mime>, status: 200, level: 1}, ...], cursor: 5778, more: true}
+//	- NDJSON: {cursor: 5679, refer: <url>, url: <url>, mime: <mime>, status: 200, level: 1}\n...
+//	- CSV: refer,url,mime,status\n<url>,<url>,<mime>,200\n...
+//	- GraphML: <graphml><graph><node id="n1"/>...<edge source="n1" target="n2"/>...</graph></graphml>
+//	- DOT: digraph "job_1234" { "<url>" -> "<url>"; ... }
+//	- Failure: {code: <code>, message: <message>}
+type JobResultHandler struct {
+	sc *storage.Client
+}
+
+func (h *JobResultHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobStatus status request failed.", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q, err := getJobResultQuery(r.URL.Query(), r.Header.Get("Accept"))
+	if err != nil {
+		log.Println("routeJobResult request failed.", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream := q.Format != resultFormatJSON
+	if q.Paged || stream {
+		if exists, err := h.sc.JobClient().JobExists(id); err != nil {
+			log.Println("routeJobResult request job exists failed.", err)
+			writeJSONError(w, "DependancyFailure", "Failed to get job", http.StatusInternalServerError)
+			return
+		} else if !exists {
+			writeJSONError(w, "NotFound", fmt.Sprintf("Job %d does not exist", id), http.StatusNotFound)
+			return
+		}
+
+		if stream {
+			h.streamResults(w, id, q.Format, q.ResultQuery)
+			return
+		}
+
+		page, jobErr := h.resultPage(id, q.ResultQuery)
+		if jobErr != nil {
+			log.Println("routeJobResult request job result page failed.", jobErr)
+			writeJSONError(w, "DependancyFailure", jobErr.Short(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, page, http.StatusOK)
+		return
+	}
+
+	result, jobErr := h.jobResult(id, q.ResultQuery)
+	if jobErr != nil {
+		log.Println("routeJobResult request job result failed.", jobErr)
+		writeJSONError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	// Write job status out
+	writeJSON(w, result, http.StatusOK)
+}
+
+// Reads the filters, format, and page of the results requested from the
+// query parameters. If the format parameter is not set, the format is
+// negotiated with the request's Accept header. An error is returned if a
+// parameter is not valid.
+func getJobResultQuery(query url.Values, accept string) (jobResultQuery, error) {
+	q := jobResultQuery{Format: query.Get("format")}
+
+	var err error
+	if q.ResultQuery, err = getResultFilters(query); err != nil {
+		return q, err
+	}
+
+	if q.Format != "" && resultContentType(q.Format) == "" {
+		return q, fmt.Errorf("Invalid format: %s", q.Format)
+	}
+
+	if v := query.Get("stream"); v != "" {
+		stream, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("Invalid stream: %s", v)
+		}
+		if stream {
+			switch q.Format {
+			case "":
+				q.Format = resultFormatNDJSON
+			case resultFormatJSON:
+				return q, fmt.Errorf("Invalid stream: %s, the json format is not streamed", v)
+			}
+		}
+	}
+	if q.Format == "" {
+		q.Format = negotiateResultFormat(accept)
+	}
+
+	for _, key := range []string{"cursor", "since"} {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		after, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || after < 0 {
+			return q, fmt.Errorf("Invalid %s: %s", key, v)
+		}
+		if after > q.After {
+			q.After = after
+		}
+		q.Paged = true
+	}
+
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit <= 0 || q.Limit > maxResultPageLimit {
+			return q, fmt.Errorf("Invalid limit: %s, must be between 1 and %d", v, maxResultPageLimit)
+		}
+		q.Paged = true
+	} else if q.Paged && q.Format == resultFormatJSON {
+		q.Limit = defaultResultPageLimit
+	}
+
+	return q, nil
+}
+
+// Reads the result filters from the query parameters. Filter parameters can
+// be repeated, or comma separated, to match any of the values. An error is
+// returned if a filter is not valid.
+func getResultFilters(query url.Values) (storage.ResultQuery, error) {
+	q := storage.ResultQuery{
+		Mimes:     getQueryList(query, "mime"),
+		Hosts:     getQueryList(query, "host"),
+		URLGlob:   query.Get("url"),
+		URLRegexp: query.Get("urlRegexp"),
+		Refer:     query.Get("refer"),
+		Links:     query.Get("links"),
+	}
+
+	if q.URLRegexp != "" {
+		if _, err := regexp.Compile(q.URLRegexp); err != nil {
+			return q, fmt.Errorf("Invalid urlRegexp: %s, %v", q.URLRegexp, err)
+		}
+	}
+
+	switch q.Links {
+	case "", storage.ResultLinksInternal, storage.ResultLinksExternal:
+	default:
+		return q, fmt.Errorf("Invalid links: %s, must be %s or %s", q.Links, storage.ResultLinksInternal, storage.ResultLinksExternal)
+	}
+
+	for _, v := range getQueryList(query, "level") {
+		level, err := strconv.Atoi(v)
+		if err != nil || level < 0 {
+			return q, fmt.Errorf("Invalid level: %s", v)
+		}
+		q.Levels = append(q.Levels, level)
+	}
+
+	for _, v := range getQueryList(query, "status") {
+		status, err := parseStatusRange(v)
+		if err != nil {
+			return q, err
+		}
+		q.Statuses = append(q.Statuses, status)
+	}
+
+	return q, nil
+}
+
+// Returns the values of the repeatable query parameter, with comma separated
+// values split. Empty values are dropped.
+func getQueryList(query url.Values, key string) []string {
+	var list []string
+	for _, v := range query[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// Parses a HTTP status code, e.g: 404, or a class of status codes, e.g: 4xx,
+// into the range of status codes it matches.
+func parseStatusRange(v string) (storage.StatusRange, error) {
+	if len(v) == 3 && strings.ToLower(v[1:]) == "xx" && v[0] >= '1' && v[0] <= '5' {
+		min := int(v[0]-'0') * 100
+		return storage.StatusRange{Min: min, Max: min + 99}, nil
+	}
+
+	code, err := strconv.Atoi(v)
+	if err != nil || code < 100 || code > 599 {
+		return storage.StatusRange{}, fmt.Errorf("Invalid status: %s, must be a status code, e.g: 404, or class, e.g: 4xx", v)
+	}
+	return storage.StatusRange{Min: code, Max: code}, nil
+}
+
+// Connects to the remote service hosting job information, and
+// the job's current result information. The query's filters select
+// the job results returned. A query without filters will return all
+// results.
+//
+// e.g: q := storage.ResultQuery{Mimes: []string{"image"}} // returns all image URLs
+func (h *JobResultHandler) jobResult(id common.JobId, q storage.ResultQuery) (common.JobResults, *ErroMsg) {
+	result, err := h.sc.JobClient().Result(id, q)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobResult",
+			Info:   fmt.Sprintf("Failed to get job %d result", id),
+			Err:    err,
+		}
+	}
+
+	return result, nil
+}
+
+// Queries a page of the job's results. One more result than the page's
+// limit is queried to know if there are more results after the page.
+func (h *JobResultHandler) resultPage(id common.JobId, q storage.ResultQuery) (*jobResultPageMsg, *ErroMsg) {
+	limit := q.Limit
+	q.Limit++
+
+	page := &jobResultPageMsg{Results: []jobResultMsg{}, Cursor: q.After}
+	err := h.sc.JobClient().EachResult(id, q, func(r *storage.JobResult) error {
+		if len(page.Results) == limit {
+			page.More = true
+			return nil
+		}
+		page.Results = append(page.Results, newJobResultMsg(r))
+		page.Cursor = r.Id
+		return nil
+	})
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "resultPage",
+			Info:   fmt.Sprintf("Failed to get job %d result page", id),
+			Err:    err,
+		}
+	}
+
+	return page, nil
+}
+
+// Streams the job's results to the client in the streamed format. The
+// results are read from storage in batches, and each batch is written once
+// it has been read, so the storage connection is not held while waiting on
+// the client. The stream ends once all results, or the limit's number of
+// results, are written.
+func (h *JobResultHandler) streamResults(w http.ResponseWriter, id common.JobId, format string, q storage.ResultQuery) {
+	w.Header().Set("Content-Type", resultContentType(format))
+	w.WriteHeader(http.StatusOK)
+
+	enc := newResultEncoder(format, id, w)
+	if err := enc.begin(); err != nil {
+		log.Println("routeJobResult stream job result failed.", id, err)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	remaining := q.Limit
+	for {
+		batch := q
+		batch.Limit = resultStreamBatchSize
+		if remaining > 0 && remaining < batch.Limit {
+			batch.Limit = remaining
+		}
+
+		results := make([]*storage.JobResult, 0, batch.Limit)
+		err := h.sc.JobClient().EachResult(id, batch, func(r *storage.JobResult) error {
+			results = append(results, r)
+			return nil
+		})
+		for i := 0; err == nil && i < len(results); i++ {
+			err = enc.encode(results[i])
+		}
+		if err == nil {
+			err = enc.flush()
+		}
+		if err != nil {
+			// The status was already written, so the stream can only be
+			// ended early.
+			log.Println("routeJobResult stream job result failed.", id, err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		n := len(results)
+		if n > 0 {
+			q.After = results[n-1].Id
+		}
+		if remaining > 0 {
+			if remaining -= n; remaining == 0 {
+				break
+			}
+		}
+		if n < batch.Limit {
+			break
+		}
+	}
+
+	if err := enc.end(); err != nil {
+		log.Println("routeJobResult stream job result failed.", id, err)
+		return
+	}
+	enc.flush()
+}
+
+// Creates the message of a single result.
+func newJobResultMsg(r *storage.JobResult) jobResultMsg {
+	return jobResultMsg{
+		Cursor:     r.Id,
+		Refer:      r.Refer,
+		URL:        r.URL,
+		Mime:       r.Mime,
+		StatusCode: r.StatusCode,
+		Level:      r.Level,
+	}
+}
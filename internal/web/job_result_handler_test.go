@@ -0,0 +1,137 @@
+package web
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGetJobResultQuery(t *testing.T) {
+	q, err := getJobResultQuery(url.Values{"mime": {"image"}}, "")
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, jobResultQuery{
+		ResultQuery: storage.ResultQuery{Mimes: []string{"image"}},
+		Format:      resultFormatJSON,
+	}, q, "Expect grouped results")
+
+	q, err = getJobResultQuery(url.Values{"cursor": {"10"}}, "")
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, jobResultQuery{
+		ResultQuery: storage.ResultQuery{After: 10, Limit: defaultResultPageLimit},
+		Format:      resultFormatJSON,
+		Paged:       true,
+	}, q, "Expect page with default limit")
+
+	q, err = getJobResultQuery(url.Values{"cursor": {"10"}, "since": {"20"}, "limit": {"5"}}, "")
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, jobResultQuery{
+		ResultQuery: storage.ResultQuery{After: 20, Limit: 5},
+		Format:      resultFormatJSON,
+		Paged:       true,
+	}, q, "Expect page after the latest cursor")
+
+	q, err = getJobResultQuery(url.Values{"stream": {"true"}, "since": {"20"}}, "")
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, jobResultQuery{
+		ResultQuery: storage.ResultQuery{After: 20},
+		Format:      resultFormatNDJSON,
+		Paged:       true,
+	}, q, "Expect unlimited NDJSON stream")
+
+	q, err = getJobResultQuery(url.Values{"format": {"dot"}}, "text/csv")
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, resultFormatDOT, q.Format, "Expect format parameter over Accept header")
+
+	q, err = getJobResultQuery(url.Values{}, "text/csv")
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, resultFormatCSV, q.Format, "Expect negotiated format")
+
+	q, err = getJobResultQuery(url.Values{
+		"mime":      {"image,text/css", "video"},
+		"host":      {"Example.com"},
+		"url":       {"http://example.com/*.png"},
+		"urlRegexp": {`\.png$`},
+		"level":     {"1,2"},
+		"status":    {"404", "5xx"},
+		"refer":     {"http://example.com"},
+		"links":     {"external"},
+	}, "")
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, storage.ResultQuery{
+		Mimes:     []string{"image", "text/css", "video"},
+		Hosts:     []string{"Example.com"},
+		URLGlob:   "http://example.com/*.png",
+		URLRegexp: `\.png$`,
+		Levels:    []int{1, 2},
+		Statuses:  []storage.StatusRange{{Min: 404, Max: 404}, {Min: 500, Max: 599}},
+		Refer:     "http://example.com",
+		Links:     storage.ResultLinksExternal,
+	}, q.ResultQuery, "Expect all filters")
+
+	for _, invalid := range []string{"stream=yes", "cursor=abc", "since=-1", "limit=0", "limit=10001", "format=xml", "format=json&stream=true",
+		"level=-1", "level=a", "status=99", "status=6xx", "status=abc", "links=other", "urlRegexp=(a"} {
+		query, _ := url.ParseQuery(invalid)
+		_, err := getJobResultQuery(query, "")
+		assert.NotNil(t, err, "Expect %s to be invalid", invalid)
+	}
+}
+
+// Response writer which queries storage before each write, as if the client
+// was slow to read the response.
+type storageQueryWriter struct {
+	*httptest.ResponseRecorder
+	query func() error
+}
+
+func (w *storageQueryWriter) Write(b []byte) (int, error) {
+	if err := w.query(); err != nil {
+		return 0, err
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestStreamResultsReleasesStorage(t *testing.T) {
+	sc, err := storage.NewClient(storage.ClientConfig{Driver: storage.DriverSQLite})
+	require.Nil(t, err, "Expect no storage error")
+	defer sc.Close()
+
+	job, err := sc.JobClient().CreateJobFromURLs([]string{"http://example.com"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	for _, u := range []string{"http://example.com/a", "http://example.com/b"} {
+		rec, err := sc.URLClient().Add(u, "text/html")
+		require.Nil(t, err, "Expect no error adding URL")
+		_, err = sc.URLClient().AddResult(job.Id, job.URLs[0].URLId, rec.Id, 1)
+		require.Nil(t, err, "Expect no error adding result")
+	}
+
+	// SQLite only has a single connection, so the writes can only query
+	// storage if the results' rows are not held open while writing.
+	w := &storageQueryWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		query: func() error {
+			_, err := sc.JobClient().JobExists(job.Id)
+			return err
+		},
+	}
+	for _, format := range []string{resultFormatNDJSON, resultFormatCSV, resultFormatGraphML, resultFormatDOT} {
+		w.ResponseRecorder = httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			h := &JobResultHandler{sc: sc}
+			h.streamResults(w, job.Id, format, storage.ResultQuery{})
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out streaming %s results, storage held while writing", format)
+		}
+		assert.Contains(t, w.Body.String(), "http://example.com/b", "Expect all %s results streamed", format)
+	}
+}
@@ -0,0 +1,498 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Request message to schedule a job with options, sent as a JSON body
+type jobScheduleMsg struct {
+	// URLs of the job to be crawled
+	URLs []jobScheduleURL `json:"urls"`
+
+	// Options the job is crawled with
+	Options common.JobOptions `json:"options"`
+
+	// Tags the job is scheduled with
+	Tags []string `json:"tags"`
+
+	// URL the client asks to be called back on
+	CallbackURL string `json:"callbackURL"`
+
+	// Key identifying the request, so retries of it do not schedule
+	// duplicate jobs.
+	IdempotencyKey string `json:"idempotencyKey"`
+}
+
+// URL of a job to be crawled. Either a URL string, or an object of the URL
+// and options it is crawled with.
+type jobScheduleURL struct {
+	// URL to be crawled
+	URL string `json:"url"`
+
+	// Options the URL is crawled with, decoded on top of the job's
+	// options. Empty if the job's options are used.
+	Options json.RawMessage `json:"options"`
+
+	// Line, or position in the list of URLs, the URL was requested on
+	line int
+}
+
+// Satisfies the json.Unmarshaler interface
+func (u *jobScheduleURL) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &u.URL)
+	}
+
+	type alias jobScheduleURL
+	return json.Unmarshal(b, (*alias)(u))
+}
+
+// Job requested to be scheduled, read from the request's body.
+type jobRequest struct {
+	// Validated URLs of the job, with duplicates removed.
+	URLs []jobScheduleURL
+
+	// Options the job is crawled with
+	Options common.JobOptions
+
+	// Tags the job is scheduled with
+	Tags []string
+
+	// URL the client asks to be called back on
+	CallbackURL string
+
+	// Key identifying the request
+	IdempotencyKey string
+
+	// URLs which were not valid, and will not be crawled
+	Errors []jobURLError
+}
+
+// Validation error of a requested URL.
+type jobURLError struct {
+	// Line of the body, or position in the JSON list of URLs, starting
+	// at 1, the URL was requested on.
+	Line int `json:"line"`
+
+	// URL as it was requested
+	URL string `json:"url"`
+
+	// Reason the URL is not valid
+	Message string `json:"message"`
+}
+
+// Response message to a successful job being scheduled
+type jobScheduledMsg struct {
+	// Id of the scheduled job
+	JobId common.JobId `json:"jobId"`
+
+	// Normalized URLs of the job
+	URLs []string `json:"urls"`
+
+	// URLs which were not valid, and were not scheduled
+	Errors []jobURLError `json:"errors,omitempty"`
+}
+
+// Response message to a job which failed to be scheduled because none of
+// its URLs were valid.
+type jobScheduleErrorMsg struct {
+	ErrorRsp
+
+	// URLs which were not valid
+	Errors []jobURLError `json:"errors,omitempty"`
+}
+
+// Handles the request to schedule a new job. Expects a new line separated
+// list of URLs as input in the request's body. Will respond back with error
+// message, or job id if the schedule was successful.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080" << EOF
+// https://www.google.com
+// http://example.com
+// EOF
+//
+// An optional 'forceCrawl' query parameter can be provided to
+// force crawling of previously crawled URLs. This flag applies
+// to add descendants of each Job URL being scheduled. The parameter
+// doesn't take a value, but if one is provided it will be ignored.
+// If the parameter is present the job's URLs will be crawled,
+// ignoring the cache.
+//
+// Optional 'scrapeCSS' and 'scrapeJS' query parameters can be provided
+// in the same way. With 'scrapeCSS' stylesheets are crawled for the URLs
+// of their url() values and @import rules, and so are the inline <style>
+// elements and style attributes of HTML documents. With 'scrapeJS'
+// javascript, and the inline scripts of HTML documents, are searched for
+// things which look like URLs. Without them stylesheets and javascript
+// are only checked.
+//
+// An optional 'sitemaps' query parameter can be provided in the same way
+// to discover the sitemaps of each Job URL's site. The site's /sitemap.xml,
+// the sitemaps listed in its robots.txt, and the sitemaps listed by sitemap
+// index files are requested, and the URLs they list are crawled as
+// descendants of the Job URL.
+//
+// The job's options can be provided by sending the request with a JSON body
+// and the 'application/json' Content-Type instead. The query parameters are
+// applied on top of the options of the body. Each URL can either be a string,
+// or an object with the URL and the options it, and its descendants, are
+// crawled with. The URL's options are applied on top of the job's.
+//
+// e.g:
+// curl -X POST -H "Content-Type: application/json" --data-binary @- "http://localhost:8080" << EOF
+// {"urls": ["https://www.google.com", {"url": "http://example.com", "options": {"maxDepth": 1}}],
+//  "options": {"maxDepth": 3, "maxPages": 100, "cacheMaxAge": "1h", "allowedMimes": ["text/html"]},
+//  "tags": ["nightly"], "callbackURL": "https://example.org/done", "idempotencyKey": "nightly-2015-06-01"}
+// EOF
+//
+// Options:
+//	- maxDepth: Maximum distance from the Job URLs descendants are crawled to, defaults to 2
+//	- maxPages: Maximum number of pages the job crawls, zero is unlimited
+//	- maxBytes: Maximum number of content bytes the job downloads, zero is unlimited
+//	- cacheMaxAge: Maximum age of a crawled URL's cache, defaults to the foreman's
+//	- allowedMimes: Mime types of the URLs crawled, e.g: text/html, image/*
+//	- forceCrawl, scrapeCSS, scrapeJS, sitemaps: Same as the query parameters
+//
+// The tags and callback URL are stored with the job. If a job was already
+// scheduled with the idempotency key, that job is responded with instead of
+// scheduling a new one. The key can also be provided with the
+// 'Idempotency-Key' header. Bodies of other Content-Types than JSON, plain
+// text, or form encoded are rejected.
+//
+// URLs which are not valid do not fail the request. They are listed in the
+// response's errors, with the line, or position in the JSON list of URLs,
+// they were requested on. The request only fails if none of the URLs are
+// valid.
+//
+// Response:
+//	- Success: {jobId: 1234, urls: [<url>], errors: [{line: 2, url: <url>, message: <message>}]}
+//	- Failure: {code: <code>, message: <message>, errors: [{line: 2, url: <url>, message: <message>}]}
+type JobScheduleHandler struct {
+	urlQueuePub queue.Publisher
+	sc          *storage.Client
+}
+
+func (h *JobScheduleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := getRequest(r)
+	if err != nil {
+		log.Println("routeScheduleJob request parse failed", err)
+		if err.Err == errUnsupportedContentType {
+			writeJSONError(w, "UnsupportedMediaType", err.Short(), http.StatusUnsupportedMediaType)
+			return
+		}
+		writeJSONError(w, "BadRequest", err.Short(), http.StatusBadRequest)
+		return
+	}
+
+	setRequestedJobFlags(r.URL.Query(), &req.Options)
+	if err := req.Options.Validate(); err != nil {
+		log.Println("routeScheduleJob request has invalid options", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	spec := req.jobSpec()
+	if len(spec.URLs) == 0 {
+		// Nothing can be done if there are no URLs to schedule
+		log.Println("routeScheduleJob request has no valid URLs")
+		writeJSON(w, jobScheduleErrorMsg{
+			ErrorRsp: ErrorRsp{Code: "BadRequest", Msg: "No valid URLs provided"},
+			Errors:   req.Errors,
+		}, http.StatusBadRequest)
+		return
+	}
+
+	// Create job by sending the URLs to scheduler
+	job, err := h.scheduleJob(spec)
+	if err != nil {
+		log.Println("routeScheduleJob request job schedule failed.", err)
+		writeJSONError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+		return
+	}
+
+	msg := jobScheduledMsg{JobId: job.Id, URLs: make([]string, 0, len(job.URLs)), Errors: req.Errors}
+	for _, u := range job.URLs {
+		msg.URLs = append(msg.URLs, u.URL)
+	}
+
+	// Write job status out
+	writeJSON(w, msg, http.StatusOK)
+}
+
+// Error of a request whose body's Content-Type is not supported.
+var errUnsupportedContentType = fmt.Errorf("unsupported Content-Type")
+
+// Reads the job requested by the request's body, based on the body's
+// Content-Type. JSON bodies are read for the job's URLs and options, and
+// everything else as a new line separated list of URLs.
+func getRequest(r *http.Request) (*jobRequest, *ErroMsg) {
+	var (
+		req *jobRequest
+		err *ErroMsg
+	)
+
+	mediaType := ""
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var parseErr error
+		if mediaType, _, parseErr = mime.ParseMediaType(contentType); parseErr != nil {
+			return nil, &ErroMsg{
+				Source: "getRequest",
+				Info:   "Invalid Content-Type",
+				Err:    parseErr,
+			}
+		}
+	}
+
+	switch mediaType {
+	case "application/json":
+		req, err = getRequestedJob(r.Body)
+	case "", "text/plain", "application/x-www-form-urlencoded":
+		req = &jobRequest{}
+		var urls []string
+		urls, req.Errors, err = getRequestedJobURLs(r.Body)
+		for _, u := range urls {
+			req.URLs = append(req.URLs, jobScheduleURL{URL: u})
+		}
+	default:
+		return nil, &ErroMsg{
+			Source: "getRequest",
+			Info:   fmt.Sprintf("Unsupported Content-Type: %s", mediaType),
+			Err:    errUnsupportedContentType,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	}
+
+	return req, nil
+}
+
+// Sets the job's flag options requested via query parameters. The flags
+// don't take a value, and are set if the parameter is present.
+func setRequestedJobFlags(query url.Values, opts *common.JobOptions) {
+	has := func(key string) bool {
+		_, ok := query[key]
+		return ok
+	}
+	opts.ForceCrawl = opts.ForceCrawl || has("forceCrawl")
+	opts.ScrapeCSS = opts.ScrapeCSS || has("scrapeCSS")
+	opts.ScrapeJS = opts.ScrapeJS || has("scrapeJS")
+	opts.Sitemaps = opts.Sitemaps || has("sitemaps")
+}
+
+// Reads the JSON input for the job's URLs and options. If the input is not
+// valid JSON, or the callback URL is not valid an error will be returned.
+// URLs which are not valid are included in the request's errors.
+func getRequestedJob(in io.Reader) (*jobRequest, *ErroMsg) {
+	msg := jobScheduleMsg{}
+	if err := json.NewDecoder(in).Decode(&msg); err != nil {
+		return nil, &ErroMsg{
+			Source: "getRequestedJob",
+			Info:   "Invalid JSON request",
+			Err:    err,
+		}
+	}
+
+	if msg.CallbackURL != "" {
+		if u, err := url.Parse(msg.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, &ErroMsg{
+				Source: "getRequestedJob",
+				Info:   fmt.Sprintf("Invalid callback URL: %s", msg.CallbackURL),
+				Err:    err,
+			}
+		}
+	}
+
+	req := &jobRequest{
+		Options:        msg.Options,
+		Tags:           msg.Tags,
+		CallbackURL:    msg.CallbackURL,
+		IdempotencyKey: msg.IdempotencyKey,
+	}
+
+	urlMap := make(map[string]struct{})
+	for i, jobURL := range msg.URLs {
+		jobURL.line = i + 1
+
+		u, err := validateJobURL(jobURL.URL)
+		if err != nil {
+			req.Errors = append(req.Errors, jobURLError{Line: jobURL.line, URL: jobURL.URL, Message: err.Error()})
+			continue
+		}
+		if _, ok := urlMap[u]; ok {
+			continue
+		}
+		urlMap[u] = struct{}{}
+
+		jobURL.URL = u
+		req.URLs = append(req.URLs, jobURL)
+	}
+
+	return req, nil
+}
+
+// Reads the input scanning for URLs. It expects a single URL per line. If
+// there is a failure reading from the input an error will be returned.
+// Lines which are not valid URLs are returned as errors of their line,
+// and do not prevent the other URLs from being read.
+func getRequestedJobURLs(in io.Reader) ([]string, []jobURLError, *ErroMsg) {
+	scanner := bufio.NewScanner(in)
+
+	urlMap := make(map[string]struct{})
+	urls := []string{}
+	var urlErrs []jobURLError
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" {
+			continue
+		}
+
+		u, err := validateJobURL(scanner.Text())
+		if err != nil {
+			urlErrs = append(urlErrs, jobURLError{Line: line, URL: scanner.Text(), Message: err.Error()})
+			continue
+		}
+		if _, ok := urlMap[u]; ok {
+			continue
+		}
+		urlMap[u] = struct{}{}
+
+		urls = append(urls, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, &ErroMsg{
+			Source: "getRequestedJobURLs",
+			Info:   "Unexpected error in input",
+			Err:    err,
+		}
+	}
+
+	return urls, urlErrs, nil
+}
+
+// Creates the spec of the job to be created from the request. The options
+// of URLs with their own are decoded on top of the job's options. URLs with
+// options which are not valid are added to the request's errors, and are
+// not included in the spec.
+func (req *jobRequest) jobSpec() storage.JobSpec {
+	spec := storage.JobSpec{
+		Options:        req.Options,
+		Tags:           req.Tags,
+		CallbackURL:    req.CallbackURL,
+		IdempotencyKey: req.IdempotencyKey,
+	}
+
+	// The job's options are decoded for each URL, so the URLs do not share
+	// the job options' lists.
+	jobOptions, _ := json.Marshal(req.Options)
+
+	for _, u := range req.URLs {
+		if len(u.Options) == 0 {
+			spec.URLs = append(spec.URLs, storage.JobSpecURL{URL: u.URL})
+			continue
+		}
+
+		opts := &common.JobOptions{}
+		err := json.Unmarshal(jobOptions, opts)
+		if err == nil {
+			err = json.Unmarshal(u.Options, opts)
+		}
+		if err == nil {
+			err = opts.Validate()
+		}
+		if err != nil {
+			req.Errors = append(req.Errors, jobURLError{Line: u.line, URL: u.URL, Message: fmt.Sprintf("Invalid options, %v", err)})
+			continue
+		}
+
+		spec.URLs = append(spec.URLs, storage.JobSpecURL{URL: u.URL, Options: opts})
+	}
+
+	sort.Sort(jobURLErrorsByLine(req.Errors))
+
+	return spec
+}
+
+// Sorts URL errors by the line they were requested on.
+type jobURLErrorsByLine []jobURLError
+
+func (e jobURLErrorsByLine) Len() int           { return len(e) }
+func (e jobURLErrorsByLine) Less(i, j int) bool { return e[i].Line < e[j].Line }
+func (e jobURLErrorsByLine) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// Validates the job URL contains at least a host and scheme. The scheme is also validated
+// as being http or https. If no scheme is provided http will be used as the default.
+func validateJobURL(jobURL string) (string, error) {
+	if strings.HasPrefix(jobURL, "/") {
+		return "", fmt.Errorf("Invalid URL, does not have host")
+	}
+
+	u, err := url.Parse(jobURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("Invalid URL scheme")
+	}
+	if u.Scheme == "" {
+		// set default scheme if non are provided, so the input could be www.example.com
+		u.Scheme = "http"
+	}
+	return u.String(), nil
+}
+
+// Requests that a job be created, and the parts of it be scheduled. The
+// job will be returned if it was successfully created, and error if there
+// was a failure. If a job was already created with the spec's idempotency
+// key that job is returned, and nothing is scheduled.
+func (h *JobScheduleHandler) scheduleJob(spec storage.JobSpec) (*storage.Job, *ErroMsg) {
+	job, created, err := h.sc.JobClient().CreateJob(spec)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "JobScheduleHandler.scheduleJob",
+			Info:   fmt.Sprintf("Create Job Failed"),
+			Err:    err,
+		}
+	}
+	if !created {
+		return job, nil
+	}
+
+	go func() {
+		for _, u := range job.URLs {
+			if err := h.sc.URLClient().AddPending(job.Id, u.URLId, u.URLId); err != nil {
+				log.Println("JobScheduleHandler.scheduleJob: failed to add job URL to pending list", err)
+			}
+			h.urlQueuePub.Send(&common.URLQueueItem{
+				JobId:    job.Id,
+				OriginId: u.URLId,
+				URLId:    u.URLId,
+				ReferId:  common.InvalidId,
+			})
+		}
+	}()
+
+	return job, nil
+}
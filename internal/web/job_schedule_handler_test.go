@@ -0,0 +1,141 @@
+package web
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetRequestedJobURLs(t *testing.T) {
+	reader := strings.NewReader(`https://www.google.com
+
+example.com
+
+http://www.reddit.com
+`)
+	urls, urlErrs, err := getRequestedJobURLs(reader)
+	require.Nil(t, err, "Expect no error")
+	assert.Empty(t, urlErrs, "Expect no URL errors")
+	assert.Len(t, urls, 3, "Expect lengths to match")
+	assert.Equal(t, `https://www.google.com`, urls[0], "URL entry should match")
+	assert.Equal(t, `http://example.com`, urls[1], "URL entry should match")
+	assert.Equal(t, `http://www.reddit.com`, urls[2], "URL entry should match")
+}
+
+func TestGetRequestedJobURLsFail(t *testing.T) {
+	reader := strings.NewReader(`/something/not/a/URL
+example.com
+
+ftp://example.org
+`)
+	urls, urlErrs, err := getRequestedJobURLs(reader)
+	require.Nil(t, err, "Expect invalid lines not to fail the request")
+	assert.Equal(t, []string{"http://example.com"}, urls, "Expect valid URLs returned")
+	require.Len(t, urlErrs, 2, "Expect errors of invalid lines")
+	assert.Equal(t, 1, urlErrs[0].Line, "Expect line of the error")
+	assert.Equal(t, "/something/not/a/URL", urlErrs[0].URL, "Expect URL of the error")
+	assert.Equal(t, 4, urlErrs[1].Line, "Expect line of the error")
+}
+
+type validateTestCase struct {
+	in  string
+	out string
+	err bool
+}
+
+var validateTestCases = []validateTestCase{
+	validateTestCase{in: `https://www.google.com`, out: `https://www.google.com`, err: false},
+	validateTestCase{in: `http://example.com`, out: `http://example.com`, err: false},
+	validateTestCase{in: `reddit.com`, out: `http://reddit.com`, err: false},
+	validateTestCase{in: `/something/else`, out: ``, err: true},
+}
+
+func TestValidateJobURL(t *testing.T) {
+	for _, c := range validateTestCases {
+		o, err := validateJobURL(c.in)
+
+		if c.err {
+			require.NotNil(t, err, "Validate should fail %s", c.in)
+		} else {
+			require.Nil(t, err, "Validate should succeed %s", c.in)
+		}
+
+		assert.Equal(t, c.out, o, "Expect values to match")
+	}
+}
+
+func TestSetRequestedJobFlags(t *testing.T) {
+	query, _ := url.ParseQuery("forceCrawl&sitemaps=true")
+	opts := common.JobOptions{MaxDepth: 3, ScrapeCSS: true}
+	setRequestedJobFlags(query, &opts)
+	assert.Equal(t, common.JobOptions{MaxDepth: 3, ScrapeCSS: true, ForceCrawl: true, Sitemaps: true}, opts, "Expect flags present to be set")
+}
+
+func TestGetRequestedJob(t *testing.T) {
+	reader := strings.NewReader(`{"urls": ["example.com", "http://example.com", "/not/a/URL", {"url": "https://www.reddit.com", "options": {"maxDepth": 1}}],
+	"options": {"maxDepth": 3, "cacheMaxAge": "1h", "allowedMimes": ["text/html"]},
+	"tags": ["nightly"], "callbackURL": "https://example.org/done", "idempotencyKey": "abc"}`)
+	req, err := getRequestedJob(reader)
+	require.Nil(t, err, "Expect no error")
+	require.Len(t, req.URLs, 2, "Expect URLs validated and de-duped")
+	assert.Equal(t, "http://example.com", req.URLs[0].URL, "Expect URL normalized")
+	assert.Equal(t, "https://www.reddit.com", req.URLs[1].URL, "Expect URL object")
+	assert.Equal(t, common.JobOptions{MaxDepth: 3, CacheMaxAge: time.Hour, AllowedMimes: []string{"text/html"}}, req.Options, "Expect options")
+	assert.Equal(t, []string{"nightly"}, req.Tags, "Expect tags")
+	assert.Equal(t, "https://example.org/done", req.CallbackURL, "Expect callback URL")
+	assert.Equal(t, "abc", req.IdempotencyKey, "Expect idempotency key")
+	assert.Equal(t, []jobURLError{{Line: 3, URL: "/not/a/URL", Message: "Invalid URL, does not have host"}}, req.Errors, "Expect invalid URL error")
+
+	spec := req.jobSpec()
+	require.Len(t, spec.URLs, 2, "Expect spec URLs")
+	assert.Nil(t, spec.URLs[0].Options, "Expect job options used")
+	assert.Equal(t, &common.JobOptions{MaxDepth: 1, CacheMaxAge: time.Hour, AllowedMimes: []string{"text/html"}}, spec.URLs[1].Options, "Expect URL options on top of the job's")
+
+	_, err = getRequestedJob(strings.NewReader(`{"options": {"cacheMaxAge": "soon"}}`))
+	assert.NotNil(t, err, "Expect invalid options error")
+
+	_, err = getRequestedJob(strings.NewReader(`{"urls": ["example.com"], "callbackURL": "/done"}`))
+	assert.NotNil(t, err, "Expect invalid callback URL error")
+}
+
+func TestJobSpecInvalidURLOptions(t *testing.T) {
+	req, err := getRequestedJob(strings.NewReader(`{"urls": [{"url": "example.com", "options": {"maxPages": -1}}, "example.org"]}`))
+	require.Nil(t, err, "Expect no error")
+
+	spec := req.jobSpec()
+	require.Len(t, spec.URLs, 1, "Expect URL with invalid options dropped")
+	assert.Equal(t, "http://example.org", spec.URLs[0].URL, "Expect valid URL")
+	require.Len(t, req.Errors, 1, "Expect invalid options error")
+	assert.Equal(t, 1, req.Errors[0].Line, "Expect line of the error")
+}
+
+func TestGetRequestContentType(t *testing.T) {
+	newRequest := func(contentType, body string) *http.Request {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		return r
+	}
+
+	req, err := getRequest(newRequest("", "example.com\n"))
+	require.Nil(t, err, "Expect no error")
+	assert.Len(t, req.URLs, 1, "Expect new line separated URLs")
+
+	r := newRequest("application/json; charset=utf-8", `{"urls": ["example.com"]}`)
+	r.Header.Set("Idempotency-Key", "abc")
+	req, err = getRequest(r)
+	require.Nil(t, err, "Expect no error")
+	assert.Len(t, req.URLs, 1, "Expect JSON URLs")
+	assert.Equal(t, "abc", req.IdempotencyKey, "Expect idempotency key header")
+
+	_, err = getRequest(newRequest("application/xml", "<urls/>"))
+	require.NotNil(t, err, "Expect unsupported Content-Type error")
+	assert.Equal(t, errUnsupportedContentType, err.Err, "Expect unsupported Content-Type")
+}
@@ -0,0 +1,233 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"time"
+)
+
+// Path suffix of a job status request to stream the job's progress.
+const jobStatusStreamPath = "stream"
+
+// Name of the stream event containing the job's status.
+const jobStatusEvent = "status"
+
+// Default interval the job status stream is kept alive at while no
+// progress is made. The job's state is checked at the same interval.
+const defaultStreamKeepAlive = 15 * time.Second
+
+// Response to a successful request of a Job
+type jobStatusMsg struct {
+	// State of the job, e.g: running, completed, or cancelled
+	State string `json:"state"`
+
+	// The Number of completely crawled Job URLs
+	Completed int `json:"completed"`
+
+	// The number of Job URLs pending completion.
+	Pending int `json:"pending"`
+
+	// The number of queued URLs held while the job is paused.
+	Parked int `json:"parked"`
+
+	// The amount of time that the Job has been processing for.
+	Elapsed string `json:"elapsed"`
+
+	// Mapping of individual URL status.  A true for a URL means that
+	// it has been processed, and only the false, URLs are pending.
+	URLs map[string]bool `json:"urls"`
+
+	// Tags the job was scheduled with.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Handles the request checking on the status of a previously scheduled job.
+// Returns an error if the job isn't found, or invalid input. If the job
+// exists its status will be returned. If the job does not exists a 404 status
+// code and message will be returned. The state of the job is either running,
+// paused, completed, or cancelled. Cancelled jobs keep the counts of completed
+// and pending URLs they had when they were cancelled. Paused jobs include the
+// number of their queued URLs which are parked until they are resumed.
+//
+// The job's progress can be streamed as server-sent events by appending
+// /stream to the status path. The first event is the job's status, followed
+// by an event for each URL crawled, result added, and origin URL completed.
+// A new status event is sent each time an origin URL completes, or the job's
+// state changes. The stream ends once the job is completed or cancelled.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/status/1234"
+// curl -N -X GET "http://localhost:8080/status/1234/stream"
+//
+// Response:
+//	- Success: {state: running, completed: 2, pending: 3, parked: 0, elapsed: 5m10s, urls: { <url>: <complete> }, tags: [<tag>] }
+//	- Stream: event: <status|crawled|result|originComplete>\ndata: <event>\n\n
+//	- Failure: {code: <code>, message: <message>}
+type JobStatusHandler struct {
+	sc *storage.Client
+
+	// Progress of the jobs being processed. If nil, streaming the job's
+	// progress is not supported.
+	progress *progressHub
+
+	// Interval the stream is kept alive at while no progress is made.
+	keepAlive time.Duration
+}
+
+func (h *JobStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr, stream := path.Base(r.URL.Path), false
+	if idStr == jobStatusStreamPath {
+		idStr, stream = path.Base(path.Dir(r.URL.Path)), true
+	}
+
+	id, err := jobIdFromString(idStr)
+	if err != nil {
+		log.Println("routeJobStatus status request failed.", err)
+		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if stream {
+		h.streamJobStatus(w, r, id)
+		return
+	}
+
+	status, jobErr := h.jobStatus(id)
+	if jobErr != nil {
+		log.Println("routeJobStatus request job status failed.", jobErr)
+		writeJSONError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	// Write job status out
+	writeJSON(w, newJobStatusMsg(status), http.StatusOK)
+}
+
+// Creates the response message of the job's status.
+func newJobStatusMsg(status *common.JobStatus) jobStatusMsg {
+	return jobStatusMsg{
+		State:     status.State,
+		Completed: status.Completed,
+		Pending:   status.Pending,
+		Parked:    status.Parked,
+		URLs:      status.URLs,
+		Elapsed:   status.Elapsed.String(),
+		Tags:      status.Tags,
+	}
+}
+
+// Connects to the remote service hosting job information, and
+// the job's current status information.
+func (h *JobStatusHandler) jobStatus(id common.JobId) (*common.JobStatus, *ErroMsg) {
+	job, err := h.sc.JobClient().GetJob(id)
+	if err != nil || job == nil {
+		return nil, &ErroMsg{
+			Source: "jobStatus",
+			Info:   fmt.Sprintf("Failed to get job %d status", id),
+			Err:    err,
+		}
+	}
+
+	return job.Status(), nil
+}
+
+// Streams the job's status, and progress events to the client as server-sent
+// events. The listener is added before the job's status is read, so no
+// progress is missed between the two. Events dropped because the client fell
+// behind are made up for with a new status event.
+func (h *JobStatusHandler) streamJobStatus(w http.ResponseWriter, r *http.Request, id common.JobId) {
+	flusher, ok := w.(http.Flusher)
+	if h.progress == nil || !ok {
+		writeJSONError(w, "NotImplemented", "Job status streaming is not supported", http.StatusNotImplemented)
+		return
+	}
+
+	listener := h.progress.listen(id)
+	defer listener.close()
+
+	status, jobErr := h.jobStatus(id)
+	if jobErr != nil {
+		log.Println("routeJobStatus request job status failed.", jobErr)
+		writeJSONError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := h.keepAlive
+	if keepAlive <= 0 {
+		keepAlive = defaultStreamKeepAlive
+	}
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	state := status.State
+	err := writeEvent(w, jobStatusEvent, newJobStatusMsg(status))
+	for err == nil && !isJobDone(state) {
+		flusher.Flush()
+
+		refresh := false
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-listener.events:
+			err = writeEvent(w, ev.Type, ev)
+			refresh = ev.Type == common.ProgressOriginComplete
+		case <-listener.dropped:
+			refresh = true
+		case <-ticker.C:
+			// Cancelling, pausing, or resuming the job is not published as
+			// progress, so the job's state is checked while it is idle.
+			var stored string
+			if stored, err = h.sc.JobClient().GetState(id); err == nil {
+				if refresh = stored != state; !refresh {
+					_, err = fmt.Fprint(w, ": keep-alive\n\n")
+				}
+			}
+		}
+
+		if err == nil && refresh {
+			if status, jobErr = h.jobStatus(id); jobErr != nil {
+				err = jobErr
+			} else {
+				state = status.State
+				err = writeEvent(w, jobStatusEvent, newJobStatusMsg(status))
+			}
+		}
+	}
+
+	if err != nil {
+		log.Println("routeJobStatus stream job status failed.", id, err)
+		return
+	}
+	flusher.Flush()
+}
+
+// Returns if the job in the state will not make any more progress.
+func isJobDone(state string) bool {
+	return state == common.JobStateCompleted || state == common.JobStateCancelled
+}
+
+// Writes the data to the client as a server-sent event, encoded as JSON.
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, buf)
+	return err
+}
@@ -0,0 +1,257 @@
+package web
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+// Link graph queries
+const (
+	linkQueryInbound  = "inbound"
+	linkQueryOutbound = "outbound"
+	linkQueryPath     = "path"
+	linkQueryAssets   = "assets"
+)
+
+// Default number of links listed, if no limit is requested.
+const defaultLinkLimit = 100
+
+// Maximum number of links listed by a single request.
+const maxLinkLimit = 1000
+
+// A URL of the link graph.
+type linkURLMsg struct {
+	// The URL
+	URL string `json:"url"`
+
+	// Mime type of the URL's content, if known.
+	Mime string `json:"mime,omitempty"`
+
+	// HTTP status code of the URL's last fetch, if it was fetched.
+	StatusCode int `json:"status,omitempty"`
+}
+
+// Response to a successful request for a URL's links
+type linksMsg struct {
+	// URL the links were requested for
+	URL string `json:"url"`
+
+	// URLs linking to, or linked from the URL.
+	Links []linkURLMsg `json:"links"`
+}
+
+// Response to a successful request for the link path between two URLs
+type linkPathMsg struct {
+	// URL the path starts at
+	From string `json:"from"`
+
+	// URL the path ends at
+	To string `json:"to"`
+
+	// Number of links in the path
+	Links int `json:"links"`
+
+	// URLs of the path, from the start to the end, each linking to the next.
+	Path []linkURLMsg `json:"path"`
+}
+
+// Handles the requests querying the link graph of all URLs crawled, across
+// all jobs. Returns an error if a URL isn't known, or invalid input.
+//
+// Queries:
+//	- inbound: URLs which link to the URL
+//	- outbound: URLs the URL links to
+//	- assets: Pages which use the asset, e.g: an image, directly or by a stylesheet
+//	- path: Shortest path of links from one URL to another
+//
+// Parameters:
+//	- url: URL the inbound, outbound, or assets links are requested for
+//	- limit: Maximum number of links returned, defaults to 100, up to 1000
+//	- from: URL the path starts at
+//	- to: URL the path ends at
+//	- maxDepth: Maximum number of links in the path, defaults to 6, up to 10
+//
+// e.g:
+// curl -X GET "http://localhost:8080/links/inbound?url=http://example.com/about"
+// curl -X GET "http://localhost:8080/links/path?from=http://example.com&to=http://example.com/team"
+//
+// Response:
+//	- Success: {url: <url>, links: [{url: <url>, mime: <mime>, status: 200}, ...]}
+//	- Path: {from: <url>, to: <url>, links: 2, path: [{url: <url>, mime: <mime>, status: 200}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type LinkHandler struct {
+	sc *storage.Client
+}
+
+func (h *LinkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	switch linkQuery := path.Base(r.URL.Path); linkQuery {
+	case linkQueryInbound, linkQueryOutbound, linkQueryAssets:
+		limit, err := getQueryInt(query, "limit", defaultLinkLimit, maxLinkLimit)
+		if err == nil {
+			err = requireQuery(query, "url")
+		}
+		if err != nil {
+			log.Println("routeLinks request failed.", err)
+			writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		u, linkErr := h.getURL(query, "url")
+		if linkErr != nil {
+			log.Println("routeLinks request get URL failed.", linkErr)
+			writeJSONError(w, "NotFound", linkErr.Short(), http.StatusNotFound)
+			return
+		}
+
+		msg, linkErr := h.links(linkQuery, u, limit)
+		if linkErr != nil {
+			log.Println("routeLinks request links failed.", linkErr)
+			writeJSONError(w, "DependancyFailure", linkErr.Short(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, msg, http.StatusOK)
+	case linkQueryPath:
+		maxDepth, err := getQueryInt(query, "maxDepth", storage.DefaultLinkPathDepth, storage.MaxLinkPathDepth)
+		if err == nil {
+			err = requireQuery(query, "from", "to")
+		}
+		if err != nil {
+			log.Println("routeLinks request failed.", err)
+			writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from, linkErr := h.getURL(query, "from")
+		var to *storage.URL
+		if linkErr == nil {
+			to, linkErr = h.getURL(query, "to")
+		}
+		if linkErr != nil {
+			log.Println("routeLinks request get URL failed.", linkErr)
+			writeJSONError(w, "NotFound", linkErr.Short(), http.StatusNotFound)
+			return
+		}
+
+		h.writeLinkPath(w, from, to, maxDepth)
+	default:
+		writeJSONError(w, "NotFound", fmt.Sprintf("Unknown link query %s", linkQuery), http.StatusNotFound)
+	}
+}
+
+// Reads the integer query parameter, which must be between 1 and max. If
+// the parameter is not set def is returned.
+func getQueryInt(query url.Values, key string, def, max int) (int, error) {
+	v := query.Get(key)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > max {
+		return 0, fmt.Errorf("Invalid %s: %s, must be between 1 and %d", key, v, max)
+	}
+	return n, nil
+}
+
+// Returns an error if any of the query parameters are not set.
+func requireQuery(query url.Values, keys ...string) error {
+	for _, key := range keys {
+		if query.Get(key) == "" {
+			return fmt.Errorf("No %s provided", key)
+		}
+	}
+	return nil
+}
+
+// Looks up the URL of the query parameter. Returns an error if the URL has
+// never been encountered by a crawl.
+func (h *LinkHandler) getURL(query url.Values, key string) (*storage.URL, *ErroMsg) {
+	u := query.Get(key)
+	rec, err := h.sc.URLClient().GetURLByURL(u)
+	if err != nil || rec == nil {
+		return nil, &ErroMsg{
+			Source: "getURL",
+			Info:   fmt.Sprintf("URL not found: %s", u),
+			Err:    err,
+		}
+	}
+
+	return rec, nil
+}
+
+// Queries the inbound, outbound, or asset links of the URL.
+func (h *LinkHandler) links(linkQuery string, u *storage.URL, limit int) (*linksMsg, *ErroMsg) {
+	var (
+		urls []*storage.URL
+		err  error
+	)
+	switch linkQuery {
+	case linkQueryInbound:
+		urls, err = h.sc.URLClient().GetInboundLinks(u.Id, limit)
+	case linkQueryOutbound:
+		urls, err = h.sc.URLClient().GetOutboundLinks(u.Id, limit)
+	case linkQueryAssets:
+		urls, err = h.sc.URLClient().GetPagesLinkingTo(u.Id, limit)
+	}
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "links",
+			Info:   fmt.Sprintf("Failed to get %s links of %s", linkQuery, u.URL),
+			Err:    err,
+		}
+	}
+
+	return &linksMsg{URL: u.URL, Links: newLinkURLMsgs(urls)}, nil
+}
+
+// Searches for the shortest path of links between the URLs, and writes it
+// to the client. A 404 status is written if there is no path within the
+// max depth.
+func (h *LinkHandler) writeLinkPath(w http.ResponseWriter, from, to *storage.URL, maxDepth int) {
+	urls, err := h.sc.URLClient().ShortestLinkPath(from.Id, to.Id, maxDepth)
+	if err == storage.ErrLinkPathLimit {
+		log.Println("routeLinks request link path failed.", from.URL, to.URL, err)
+		writeJSONError(w, "SearchLimit", err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		log.Println("routeLinks request link path failed.", from.URL, to.URL, err)
+		writeJSONError(w, "DependancyFailure", "Failed to get link path", http.StatusInternalServerError)
+		return
+	}
+	if urls == nil {
+		writeJSONError(w, "NotFound", fmt.Sprintf("No link path within %d links", maxDepth), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, linkPathMsg{
+		From:  from.URL,
+		To:    to.URL,
+		Links: len(urls) - 1,
+		Path:  newLinkURLMsgs(urls),
+	}, http.StatusOK)
+}
+
+// Creates the messages of the URLs.
+func newLinkURLMsgs(urls []*storage.URL) []linkURLMsg {
+	msgs := make([]linkURLMsg, 0, len(urls))
+	for _, u := range urls {
+		msgs = append(msgs, linkURLMsg{
+			URL:        u.URL,
+			Mime:       u.Mime,
+			StatusCode: u.Fetch.StatusCode,
+		})
+	}
+	return msgs
+}
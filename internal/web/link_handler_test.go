@@ -0,0 +1,30 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+func TestGetQueryInt(t *testing.T) {
+	n, err := getQueryInt(url.Values{}, "limit", 100, 1000)
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, 100, n, "Expect default")
+
+	n, err = getQueryInt(url.Values{"limit": {"1000"}}, "limit", 100, 1000)
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, 1000, n, "Expect value")
+
+	for _, invalid := range []string{"0", "-1", "1001", "ten"} {
+		_, err := getQueryInt(url.Values{"limit": {invalid}}, "limit", 100, 1000)
+		assert.NotNil(t, err, "Expect %s to be invalid", invalid)
+	}
+}
+
+func TestRequireQuery(t *testing.T) {
+	query := url.Values{"from": {"http://example.com"}, "to": {""}}
+	assert.Nil(t, requireQuery(query, "from"), "Expect set parameter")
+	assert.NotNil(t, requireQuery(query, "from", "to"), "Expect empty parameter missing")
+	assert.NotNil(t, requireQuery(query, "url"), "Expect parameter missing")
+}
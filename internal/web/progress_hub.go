@@ -0,0 +1,89 @@
+package web
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"sync"
+)
+
+// Number of progress events buffered for each listener before events
+// start to be dropped.
+const progressListenerBufferSize = 64
+
+// Distributes the events received from the progress topic to the listeners
+// of each event's job. A single subscription to the topic is shared by all
+// of the web server's job status streams.
+type progressHub struct {
+	mu        sync.Mutex
+	listeners map[common.JobId]map[*progressListener]struct{}
+}
+
+// Listener of a single job's progress events.
+type progressListener struct {
+	hub   *progressHub
+	jobId common.JobId
+
+	// Progress events of the job.
+	events chan *common.ProgressEvent
+
+	// Signaled when events were dropped because the listener fell behind.
+	dropped chan struct{}
+}
+
+// Creates a new hub, distributing the events received by the subscriber
+// until the subscriber is closed.
+func newProgressHub(sub queue.ProgressSubscriber) *progressHub {
+	h := &progressHub{listeners: make(map[common.JobId]map[*progressListener]struct{})}
+	go h.run(sub.Receive())
+	return h
+}
+
+// Distributes the events received to the listeners of the event's job.
+func (h *progressHub) run(events <-chan *common.ProgressEvent) {
+	for ev := range events {
+		h.mu.Lock()
+		for l := range h.listeners[ev.JobId] {
+			select {
+			case l.events <- ev:
+			default:
+				select {
+				case l.dropped <- struct{}{}:
+				default:
+				}
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Adds a listener for the job's progress events. The listener must be
+// closed when no longer needed.
+func (h *progressHub) listen(jobId common.JobId) *progressListener {
+	l := &progressListener{
+		hub:     h,
+		jobId:   jobId,
+		events:  make(chan *common.ProgressEvent, progressListenerBufferSize),
+		dropped: make(chan struct{}, 1),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.listeners[jobId] == nil {
+		h.listeners[jobId] = make(map[*progressListener]struct{})
+	}
+	h.listeners[jobId][l] = struct{}{}
+
+	return l
+}
+
+// Removes the listener from the hub. No more events will be sent to it.
+func (l *progressListener) close() {
+	l.hub.mu.Lock()
+	defer l.hub.mu.Unlock()
+
+	delete(l.hub.listeners[l.jobId], l)
+	if len(l.hub.listeners[l.jobId]) == 0 {
+		delete(l.hub.listeners, l.jobId)
+	}
+}
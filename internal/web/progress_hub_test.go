@@ -0,0 +1,48 @@
+package web
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestProgressHub(t *testing.T) {
+	cfg := queue.QueueConfig{ConnURL: "mem://progress_hub", Topic: "job_progress"}
+	pub, _ := queue.NewProgressPublisher(cfg)
+	sub, _ := queue.NewProgressSubscriber(cfg)
+	defer sub.Close()
+
+	hub := newProgressHub(sub)
+	a := hub.listen(1)
+	defer a.close()
+	b := hub.listen(2)
+
+	pub.Send(&common.ProgressEvent{JobId: 2, URLId: 1}, &common.ProgressEvent{JobId: 1, URLId: 2})
+	select {
+	case ev := <-a.events:
+		assert.Equal(t, common.URLId(2), ev.URLId, "Expect only the listener's job's events")
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+	select {
+	case ev := <-b.events:
+		assert.Equal(t, common.URLId(1), ev.URLId, "Expect only the listener's job's events")
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+
+	// Listeners which fall behind are signaled that events were dropped.
+	b.close()
+	for i := 0; i < progressListenerBufferSize+1; i++ {
+		pub.Send(&common.ProgressEvent{JobId: 1})
+	}
+	select {
+	case <-a.dropped:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for dropped signal")
+	}
+	assert.Len(t, a.events, progressListenerBufferSize, "Expect listener's buffer full")
+	assert.Len(t, b.events, 0, "Expect closed listener to not receive events")
+}
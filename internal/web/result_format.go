@@ -0,0 +1,237 @@
+package web
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Formats a job's results can be written in.
+const (
+	// Results grouped under the refer URL they were found on, or a page
+	// of results.
+	resultFormatJSON = "json"
+
+	// Newline delimited JSON, one result per line.
+	resultFormatNDJSON = "ndjson"
+
+	// Comma separated values, with a header row of refer, url, mime, status.
+	resultFormatCSV = "csv"
+
+	// GraphML of the link graph, with a node for each URL, and an edge from
+	// each refer URL to the results found on it.
+	resultFormatGraphML = "graphml"
+
+	// Graphviz DOT of the link graph.
+	resultFormatDOT = "dot"
+)
+
+// Content types of the result formats, in the order they are preferred when
+// negotiated with the Accept header.
+var resultFormatTypes = []struct {
+	format      string
+	contentType string
+}{
+	{resultFormatJSON, "application/json"},
+	{resultFormatNDJSON, "application/x-ndjson"},
+	{resultFormatCSV, "text/csv"},
+	{resultFormatGraphML, "application/graphml+xml"},
+	{resultFormatDOT, "text/vnd.graphviz"},
+}
+
+// Returns the content type the result format is written with.
+func resultContentType(format string) string {
+	for _, t := range resultFormatTypes {
+		if t.format == format {
+			return t.contentType
+		}
+	}
+	return ""
+}
+
+// Returns the result format of the Accept header's media type with the highest
+// quality. If none of the media types are supported, or the header is not
+// set, the JSON format is returned.
+func negotiateResultFormat(accept string) string {
+	format, quality := resultFormatJSON, 0.0
+	for _, v := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		for _, t := range resultFormatTypes {
+			if t.contentType == mediaType && q > quality {
+				format, quality = t.format, q
+			}
+		}
+	}
+
+	return format
+}
+
+// Writes a job's results in one of the streamed formats. The results are
+// encoded a batch at a time, once each batch has been read from storage, so
+// only a single batch is held in memory, and storage is not held while
+// writing.
+type resultEncoder interface {
+	// Writes what comes before the results, e.g: the CSV header row.
+	begin() error
+
+	// Writes a single result.
+	encode(r *storage.JobResult) error
+
+	// Writes what comes after the results.
+	end() error
+
+	// Writes any buffered results to the underlying writer.
+	flush() error
+}
+
+// Creates the encoder of the streamed result format, writing to w. Returns
+// nil if the format is not streamed.
+func newResultEncoder(format string, id common.JobId, w io.Writer) resultEncoder {
+	switch format {
+	case resultFormatNDJSON:
+		return &ndjsonResultEncoder{enc: json.NewEncoder(w)}
+	case resultFormatCSV:
+		return &csvResultEncoder{w: csv.NewWriter(w)}
+	case resultFormatGraphML:
+		return &graphMLResultEncoder{id: id, w: w, nodes: make(map[int64]struct{})}
+	case resultFormatDOT:
+		return &dotResultEncoder{id: id, w: w}
+	}
+	return nil
+}
+
+// Encodes each result as a JSON object on its own line.
+type ndjsonResultEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonResultEncoder) begin() error { return nil }
+func (e *ndjsonResultEncoder) end() error   { return nil }
+func (e *ndjsonResultEncoder) flush() error { return nil }
+
+func (e *ndjsonResultEncoder) encode(r *storage.JobResult) error {
+	return e.enc.Encode(newJobResultMsg(r))
+}
+
+// Encodes each result as a CSV row. The status is empty if the result was
+// not fetched, or there was no response.
+type csvResultEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvResultEncoder) begin() error {
+	return e.w.Write([]string{"refer", "url", "mime", "status"})
+}
+
+func (e *csvResultEncoder) encode(r *storage.JobResult) error {
+	status := ""
+	if r.StatusCode != 0 {
+		status = strconv.Itoa(r.StatusCode)
+	}
+	return e.w.Write([]string{r.Refer, r.URL, r.Mime, status})
+}
+
+func (e *csvResultEncoder) end() error { return nil }
+
+func (e *csvResultEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// Encodes the results as a directed GraphML graph. Each URL's node is written
+// the first time the URL is seen, before the edge from the result's refer
+// URL to the result. Only the ids of the nodes written are kept.
+type graphMLResultEncoder struct {
+	id    common.JobId
+	w     io.Writer
+	nodes map[int64]struct{}
+}
+
+func (e *graphMLResultEncoder) begin() error {
+	_, err := fmt.Fprintf(e.w, `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="url" for="node" attr.name="url" attr.type="string"/>
+  <graph id="job_%d" edgedefault="directed">
+`, e.id)
+	return err
+}
+
+func (e *graphMLResultEncoder) encode(r *storage.JobResult) error {
+	if err := e.node(r.ReferId, r.Refer); err != nil {
+		return err
+	}
+	if err := e.node(r.URLId, r.URL); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(e.w, "    <edge source=\"n%d\" target=\"n%d\"/>\n", r.ReferId, r.URLId)
+	return err
+}
+
+// Writes the URL's node, if it was not already written.
+func (e *graphMLResultEncoder) node(id int64, u string) error {
+	if _, ok := e.nodes[id]; ok {
+		return nil
+	}
+	e.nodes[id] = struct{}{}
+
+	if _, err := fmt.Fprintf(e.w, "    <node id=\"n%d\"><data key=\"url\">", id); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(e.w, []byte(u)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, "</data></node>\n")
+	return err
+}
+
+func (e *graphMLResultEncoder) end() error {
+	_, err := io.WriteString(e.w, "  </graph>\n</graphml>\n")
+	return err
+}
+
+func (e *graphMLResultEncoder) flush() error { return nil }
+
+// Encodes the results as a Graphviz DOT digraph, with an edge from each
+// result's refer URL to the result. The URLs are the node ids.
+type dotResultEncoder struct {
+	id common.JobId
+	w  io.Writer
+}
+
+// Escapes the quotes and backslashes of a DOT quoted string.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func (e *dotResultEncoder) begin() error {
+	_, err := fmt.Fprintf(e.w, "digraph \"job_%d\" {\n", e.id)
+	return err
+}
+
+func (e *dotResultEncoder) encode(r *storage.JobResult) error {
+	_, err := fmt.Fprintf(e.w, "  \"%s\" -> \"%s\";\n", dotEscaper.Replace(r.Refer), dotEscaper.Replace(r.URL))
+	return err
+}
+
+func (e *dotResultEncoder) end() error {
+	_, err := io.WriteString(e.w, "}\n")
+	return err
+}
+
+func (e *dotResultEncoder) flush() error { return nil }
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNegotiateResultFormat(t *testing.T) {
+	assert.Equal(t, resultFormatJSON, negotiateResultFormat(""), "Expect JSON by default")
+	assert.Equal(t, resultFormatJSON, negotiateResultFormat("*/*"), "Expect JSON for any type")
+	assert.Equal(t, resultFormatJSON, negotiateResultFormat("text/html, application/xhtml+xml"), "Expect JSON for unsupported types")
+	assert.Equal(t, resultFormatCSV, negotiateResultFormat("text/html, text/csv"), "Expect supported type")
+	assert.Equal(t, resultFormatGraphML, negotiateResultFormat("text/csv;q=0.5, application/graphml+xml"), "Expect highest quality type")
+	assert.Equal(t, resultFormatNDJSON, negotiateResultFormat("application/x-ndjson, text/csv"), "Expect first of equal quality")
+}
+
+var testResults = []*storage.JobResult{
+	{Id: 1, ReferId: 1, Refer: "http://example.com", URLId: 2, URL: "http://example.com/a", Mime: "text/html", StatusCode: 200, Level: 1},
+	{Id: 2, ReferId: 1, Refer: "http://example.com", URLId: 3, URL: `http://example.com/b?q="<x>"`, Level: 1},
+	{Id: 3, ReferId: 2, Refer: "http://example.com/a", URLId: 1, URL: "http://example.com", Mime: "text/html", StatusCode: 200, Level: 1},
+}
+
+func encodeTestResults(t *testing.T, format string) string {
+	var buf bytes.Buffer
+	enc := newResultEncoder(format, 7, &buf)
+	require.NotNil(t, enc, "Expect %s encoder", format)
+	require.Nil(t, enc.begin(), "Expect no error")
+	for _, r := range testResults {
+		require.Nil(t, enc.encode(r), "Expect no error")
+	}
+	require.Nil(t, enc.end(), "Expect no error")
+	require.Nil(t, enc.flush(), "Expect no error")
+	return buf.String()
+}
+
+func TestResultEncoders(t *testing.T) {
+	assert.Equal(t, `{"cursor":1,"refer":"http://example.com","url":"http://example.com/a","mime":"text/html","status":200,"level":1}
+{"cursor":2,"refer":"http://example.com","url":"http://example.com/b?q=\"\u003cx\u003e\"","level":1}
+{"cursor":3,"refer":"http://example.com/a","url":"http://example.com","mime":"text/html","status":200,"level":1}
+`, encodeTestResults(t, resultFormatNDJSON), "Expect NDJSON")
+
+	assert.Equal(t, `refer,url,mime,status
+http://example.com,http://example.com/a,text/html,200
+http://example.com,"http://example.com/b?q=""<x>""",,
+http://example.com/a,http://example.com,text/html,200
+`, encodeTestResults(t, resultFormatCSV), "Expect CSV")
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="url" for="node" attr.name="url" attr.type="string"/>
+  <graph id="job_7" edgedefault="directed">
+    <node id="n1"><data key="url">http://example.com</data></node>
+    <node id="n2"><data key="url">http://example.com/a</data></node>
+    <edge source="n1" target="n2"/>
+    <node id="n3"><data key="url">http://example.com/b?q=&#34;&lt;x&gt;&#34;</data></node>
+    <edge source="n1" target="n3"/>
+    <edge source="n2" target="n1"/>
+  </graph>
+</graphml>
+`, encodeTestResults(t, resultFormatGraphML), "Expect GraphML")
+
+	assert.Equal(t, `digraph "job_7" {
+  "http://example.com" -> "http://example.com/a";
+  "http://example.com" -> "http://example.com/b?q=\"<x>\"";
+  "http://example.com/a" -> "http://example.com";
+}
+`, encodeTestResults(t, resultFormatDOT), "Expect DOT")
+
+	assert.Nil(t, newResultEncoder(resultFormatJSON, 7, &bytes.Buffer{}), "Expect JSON not streamed")
+}
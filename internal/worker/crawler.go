@@ -0,0 +1,674 @@
+package worker
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/scope"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Default user agent the crawler identifies itself with to sites and uses
+// to select the rules of a site's robots.txt.
+const DefaultUserAgent = "harvester (+https://github.com/jasdel/harvester)"
+
+// Default duration a site's robots.txt is cached for before it is fetched again.
+const DefaultRobotsMaxAge = 24 * time.Hour
+
+// Default number of requests per second made to a single host across all workers.
+const DefaultHostRequestsPerSecond = 1
+
+// Default number of concurrent connections to a single host across all workers.
+const DefaultHostMaxConnections = 1
+
+// Default number of concurrent crawls of a single host within a worker process.
+const DefaultHostConcurrency = 1
+
+// Default number of times a URL is attempted to be crawled before it is
+// given up on.
+const DefaultMaxAttempts = 3
+
+// Default duration before the first retry of a URL which failed to be
+// crawled. The delay doubles with each following attempt.
+const DefaultRetryDelay = 30 * time.Second
+
+// Default interval storage is polled at for scheduled items which are due
+// to be sent to their queue.
+const DefaultSchedulePollInterval = time.Second
+
+// Duration an item is deferred for when its host already has the maximum
+// number of crawls in progress within the worker process.
+const hostBusyWait = time.Second
+
+// Configuration of how the crawler crawls URLs.
+type CrawlerConfig struct {
+	// User agent sent with requests, and used to select the rules of a
+	// site's robots.txt. If not set DefaultUserAgent will be used.
+	UserAgent string
+
+	// Maximum age a site's cached robots.txt can be before it is fetched
+	// again. If not set DefaultRobotsMaxAge will be used.
+	RobotsMaxAge time.Duration
+
+	// Maximum number of requests per second made to a single host across
+	// all workers. If a site's robots.txt asks for a longer crawl delay
+	// the crawl delay is used instead. If not set DefaultHostRequestsPerSecond
+	// will be used.
+	HostRequestsPerSecond float64
+
+	// Maximum number of concurrent connections to a single host across
+	// all workers. If not set DefaultHostMaxConnections will be used.
+	HostMaxConnections int
+
+	// Maximum number of concurrent crawls of a single host by the crawler
+	// within this process. If not set DefaultHostConcurrency will be used.
+	HostConcurrency int
+
+	// Maximum number of times a URL is attempted to be crawled when it
+	// fails with a server error or connection failure. Once reached the
+	// URL is recorded as a dead letter. If not set DefaultMaxAttempts
+	// will be used.
+	MaxAttempts int
+
+	// Duration before the first retry of a URL which failed to be crawled.
+	// The delay doubles with each following attempt. If not set
+	// DefaultRetryDelay will be used.
+	RetryDelay time.Duration
+
+	// Interval storage is polled at for retried and deferred items which
+	// are due to be sent to their queue. If not set
+	// DefaultSchedulePollInterval will be used.
+	SchedulePollInterval time.Duration
+}
+
+// Searches for and extracts URLs from a page. Those URLs are then queued up for recursive
+// crawling with maximum depth of the passed in max level.
+type Crawler struct {
+	urlQueuePub queue.Publisher
+	sc          *storage.Client
+	cfg         CrawlerConfig
+
+	// Topic the progress of the jobs crawled is published to.
+	progressPub queue.ProgressPublisher
+
+	// Queue items are deferred to when their host is busy, or asked
+	// for requests to be retried later. Items which failed to be crawled
+	// are retried via the URL queue instead.
+	workQueuePub queue.Publisher
+
+	// HTTP client all requests are made with. Sets the crawler's user
+	// agent on each request.
+	client *http.Client
+
+	// Crawls of each host in progress by this crawler.
+	hosts *hostCounter
+
+	// Options of the jobs items are crawled for
+	jobOptions *storage.JobOptionsCache
+
+	// Scope matchers of the jobs items are crawled for
+	scopes *scope.Cache
+}
+
+// Creates a new instance of the Crawler. The crawler is save to be run across multiple
+// go-routines. The progress of crawling the jobs' URLs is published to progressPub.
+func NewCrawler(urlQueuePub, workQueuePub queue.Publisher, progressPub queue.ProgressPublisher, sc *storage.Client, cfg CrawlerConfig) *Crawler {
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	if cfg.RobotsMaxAge == 0 {
+		cfg.RobotsMaxAge = DefaultRobotsMaxAge
+	}
+	if cfg.HostRequestsPerSecond <= 0 {
+		cfg.HostRequestsPerSecond = DefaultHostRequestsPerSecond
+	}
+	if cfg.HostMaxConnections <= 0 {
+		cfg.HostMaxConnections = DefaultHostMaxConnections
+	}
+	if cfg.HostConcurrency <= 0 {
+		cfg.HostConcurrency = DefaultHostConcurrency
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+	if cfg.SchedulePollInterval <= 0 {
+		cfg.SchedulePollInterval = DefaultSchedulePollInterval
+	}
+
+	return &Crawler{
+		urlQueuePub:  urlQueuePub,
+		workQueuePub: workQueuePub,
+		progressPub:  progressPub,
+		sc:           sc,
+		cfg:          cfg,
+		client: &http.Client{
+			Transport: &userAgentTransport{userAgent: cfg.UserAgent, rt: http.DefaultTransport},
+		},
+		hosts:      newHostCounter(),
+		jobOptions: storage.NewJobOptionsCache(sc, 0),
+		scopes:     scope.NewCache(sc, 0),
+	}
+}
+
+// Retrieves the content of the item URL scrapes it for URLs.  Those descendant URLs
+// are then either added back into the URL queue or added directly to a job's results.
+// The URLs will be added to the URL queue if when the passed in item's Level is incremented
+// and won't breach the job's max depth of distance from the origin URL.
+//
+// When a crawl is complete the associated pending URL with this item will be removed,
+// and a check to determine if there are anymore pending URLs for the item's Origin
+// will be made. If there are no longer any pending URLs the Origin's Job URL entry
+// will be marked as completed.
+//
+// If the item's host is busy, or asked for requests to be retried later, the item
+// will be deferred back to the work queue instead, and its pending URL kept.
+// If the request, or the request of the site's robots.txt, fails with a server
+// error or connection failure the item is re-queued to the URL queue to be
+// retried later, until its attempts are exhausted.
+//
+// Check only items are only requested to record if they can be fetched. Their
+// content is not scraped for descendants.
+//
+// URLs which were crawled before are requested conditionally with their ETag
+// and Last-Modified validators. If their content has not changed, the
+// descendants found when they were last crawled are used instead.
+//
+// If the item's job asks for sitemaps, the sitemaps of the origin's site are
+// discovered once the origin is crawled, and the URLs they list are queued as
+// descendants.
+//
+// Once the item's job has crawled its max pages, or downloaded its max bytes,
+// the item is added to the job's results without being requested. Items of
+// cancelled jobs are dropped without being requested.
+func (c *Crawler) Crawl(item *common.URLQueueItem) {
+	startedAt := time.Now()
+	urlClient := c.sc.URLClient()
+
+	deferred := false
+	defer func() {
+		if deferred {
+			// The item will be crawled later, so it is still pending.
+			return
+		}
+
+		// Make sure the Job is cleaned up even in if an error happens.
+		if err := urlClient.DeletePending(item.JobId, item.URLId, item.OriginId); err != nil {
+			log.Println("crawl: Failed to delete pending record for", item.URLId, item.OriginId)
+		}
+		log.Println("crawl: Finished crawling of", item.URLId, item.Level, "duration", time.Now().Sub(startedAt).String())
+
+		// If there are no more pending entries for this origin, all jobs which contain that
+		// origin which are not already complete can be marked as complete.
+		if complete, err := urlClient.UpdateJobURLIfComplete(item.JobId, item.OriginId); err != nil {
+			log.Println("crawl: Failed to update if Job URL is complete", item.OriginId, err)
+		} else if complete {
+			log.Println("crawl: Marked Job URL as complete", item.JobId, item.OriginId)
+			c.publishProgress(&common.ProgressEvent{
+				JobId:    item.JobId,
+				Type:     common.ProgressOriginComplete,
+				OriginId: item.OriginId,
+				URLId:    item.OriginId,
+			})
+
+			// Once all of the job's URLs are complete its callback can be made.
+			if _, err := c.sc.CallbackClient().AddIfDone(item.JobId); err != nil {
+				log.Println("crawl: Failed to add job callback", item.JobId, err)
+			}
+		}
+
+	}()
+
+	state, err := c.sc.JobClient().GetState(item.JobId)
+	if err != nil {
+		log.Println("crawl: Failed to get job state", item.JobId, err)
+		return
+	}
+	switch state {
+	case common.JobStateCancelled:
+		log.Println("crawl: Dropping item of cancelled job", item.JobId, item.URLId)
+		return
+	case common.JobStatePaused:
+		deferred = c.parkItem(item)
+		return
+	}
+
+	opts, err := c.jobOptions.Get(item.JobId, item.OriginId)
+	if err != nil {
+		log.Println("crawl: Failed to get job options", item.JobId, err)
+		return
+	}
+
+	urlRec, err := c.sc.URLClient().GetURLById(item.URLId)
+	if err != nil || urlRec == nil {
+		log.Println("Failed to get URL record for URLId", item.URLId)
+		return
+	}
+
+	parsed, err := url.Parse(urlRec.URL)
+	if err != nil {
+		log.Println("crawl: Failed to parse URL", item.URLId, urlRec.URL, err)
+		return
+	}
+	host := parsed.Scheme + "://" + parsed.Host
+
+	// URLs of sites whose robots.txt is unavailable have failed to be
+	// fetched, so they are retried like any other failed request.
+	rules, err := c.getRobots(parsed)
+	if robotsErr, ok := err.(*RobotsError); ok {
+		log.Println("crawl: Failed to request robots.txt", item.URLId, urlRec.URL, robotsErr)
+		fetch := &storage.Fetch{Error: robotsErr.Error(), ErrorKind: fetchErrorKind(robotsErr)}
+		deferred = c.fetchFailed(item, urlRec.URL, fetch, robotsErr)
+		return
+	} else if err != nil {
+		log.Println("crawl: Failed to get robots.txt", item.URLId, urlRec.URL, err)
+		return
+	}
+
+	// URLs disallowed by the site's robots.txt are never requested, but
+	// are still recorded as results so the job shows they were found.
+	if !rules.Allowed(c.cfg.UserAgent, parsed.RequestURI()) {
+		log.Println("crawl: URL blocked by robots.txt", item.URLId, urlRec.URL)
+		if err := urlClient.MarkRobotsBlocked(item.URLId); err != nil {
+			log.Println("crawl: failed to mark URL as blocked", item.URLId, err)
+		}
+		c.publishCrawled(item, urlRec.URL, common.CrawlStatusRobotsBlocked, "", nil)
+		if item.Level > 0 {
+			c.addResult(item.JobId, item.OriginId, item.ReferId, item.URLId, urlRec.URL, item.Level)
+		}
+		return
+	}
+
+	// Only request the URL if its host has a connection available, otherwise
+	// defer the item so other hosts are not blocked waiting on this one.
+	if !c.hosts.acquire(host, c.cfg.HostConcurrency) {
+		deferred = true
+		c.deferItem(item, hostBusyWait)
+		return
+	}
+	defer c.hosts.release(host)
+
+	hostClient := c.sc.HostClient()
+	if wait, err := hostClient.Acquire(host, c.hostInterval(rules), c.cfg.HostMaxConnections); err != nil {
+		log.Println("crawl: Failed to acquire host", host, err)
+		return
+	} else if wait > 0 {
+		deferred = true
+		c.deferItem(item, wait)
+		return
+	}
+
+	// Jobs which have crawled their max pages, or downloaded their max bytes
+	// only include their remaining URLs in the results. Checks are not
+	// counted since their content is not downloaded.
+	if !item.CheckOnly {
+		reserved, err := c.sc.JobClient().ReservePage(item.JobId, opts.MaxPages, opts.MaxBytes)
+		if err != nil || !reserved {
+			if releaseErr := hostClient.Release(host); releaseErr != nil {
+				log.Println("crawl: Failed to release host", host, releaseErr)
+			}
+			if err != nil {
+				log.Println("crawl: Failed to reserve job page", item.JobId, err)
+				return
+			}
+			log.Println("crawl: Job reached its max pages or bytes", item.JobId, item.URLId, urlRec.URL)
+			if item.Level > 0 {
+				c.addResult(item.JobId, item.OriginId, item.ReferId, item.URLId, urlRec.URL, item.Level)
+			}
+			return
+		}
+	}
+
+	var (
+		fetch *storage.Fetch
+		mime  string
+		links []Link
+	)
+	if item.CheckOnly {
+		fetch, mime, err = Check(urlRec.URL, c.client)
+	} else {
+		// URLs which were crawled before are requested conditionally, so
+		// their content is only downloaded again if it has changed.
+		var cached *storage.Fetch
+		if urlRec.Crawled && urlRec.CrawlStatus == common.CrawlStatusCrawled && !opts.ForceCrawl {
+			cached = &urlRec.Fetch
+		}
+		scrapeOpts := ScrapeOptions{CSS: opts.ScrapeCSS, JS: opts.ScrapeJS}
+		fetch, mime, links, err = Scrape(urlRec.URL, c.client, cached, scrapeOpts)
+		if err == nil && fetch.StatusCode != http.StatusNotModified && fetch.ContentLength > 0 {
+			if err := c.sc.JobClient().AddBytes(item.JobId, fetch.ContentLength); err != nil {
+				log.Println("crawl: Failed to add job bytes", item.JobId, err)
+			}
+		}
+	}
+	if err := hostClient.Release(host); err != nil {
+		log.Println("crawl: Failed to release host", host, err)
+	}
+	if retryErr, ok := err.(*RetryLaterError); ok {
+		wait := retryErr.RetryAfter
+		if wait <= 0 {
+			wait = defaultRetryAfter
+		}
+		log.Println("crawl: Host asked to retry later", item.URLId, urlRec.URL, retryErr)
+		if err := hostClient.Backoff(host, time.Now().Add(wait)); err != nil {
+			log.Println("crawl: Failed to backoff host", host, err)
+		}
+		deferred = true
+		c.deferItem(item, wait)
+		return
+	} else if err != nil {
+		log.Println("crawl: Failed to request and scrape", item.URLId, urlRec.URL, err)
+		deferred = c.fetchFailed(item, urlRec.URL, fetch, err)
+		return
+	}
+
+	if item.CheckOnly {
+		log.Println("crawl: Check complete URL", item.URLId, urlRec.URL, "status", fetch.StatusCode, "mime:", mime, "level", item.Level, "duration", time.Now().Sub(startedAt).String())
+		if err := urlClient.MarkChecked(item.URLId, mime, fetch); err != nil {
+			log.Println("crawl: failed to update URL's fetch", item.URLId, err)
+		}
+		c.publishCrawled(item, urlRec.URL, common.CrawlStatusCrawled, mime, fetch)
+		if item.Level > 0 {
+			c.addResult(item.JobId, item.OriginId, item.ReferId, item.URLId, urlRec.URL, item.Level)
+		}
+		return
+	}
+
+	// If the content has not changed since it was last crawled, its
+	// descendants found then are still valid.
+	urls := linkURLs(links)
+	if fetch.StatusCode == http.StatusNotModified {
+		mime = urlRec.Mime
+		if urls, err = c.cachedDescendants(item.URLId); err != nil {
+			log.Println("crawl: Failed to get cached descendants", item.URLId, urlRec.URL, err)
+			return
+		}
+	}
+
+	log.Println("crawl: Request and Scrape complete URL", item.URLId, urlRec.URL, "status", fetch.StatusCode, "mime:", mime, "level", item.Level, "descendants", len(urls), "duration", time.Now().Sub(startedAt).String(), "error", err)
+
+	// Update mime type, and fetch metadata for the URL
+	if err := urlClient.MarkCrawled(item.URLId, mime, fetch); err != nil {
+		log.Println("crawl: failed to add update URL's mime type", item.URLId, mime, err)
+		return
+	}
+	// Update the local urlRec mime value so don't need to re-query for it.
+	urlRec.Mime = mime
+	c.publishCrawled(item, urlRec.URL, common.CrawlStatusCrawled, mime, fetch)
+
+	// Only add items to the result if they are greater than the first layer
+	// because the first layer is the URLs that are used to start a job,
+	// so they do not make sense to be inserted into the results without a refer.
+	if item.Level > 0 {
+		c.addResult(item.JobId, item.OriginId, item.ReferId, item.URLId, urlRec.URL, item.Level)
+	}
+
+	// The descendants of content of mime types the job does not allow are
+	// recorded, but not queued for the job.
+	if err := c.processURLDescendants(item, urls, opts, opts.AllowsMime(mime)); err != nil {
+		log.Println("crawl: failed to process descendants", err)
+	}
+
+	// The URLs listed by the site's sitemaps are queued as descendants of
+	// the origin, so pages which are not linked to are crawled as well.
+	if opts.Sitemaps && item.Level == 0 {
+		sitemapURLs := c.discoverSitemaps(host, rules)
+		log.Println("crawl: Discovered sitemap URLs", item.URLId, urlRec.URL, "count", len(sitemapURLs))
+		if err := c.processSitemapURLs(item, sitemapURLs, urls, opts); err != nil {
+			log.Println("crawl: failed to process sitemap URLs", err)
+		}
+	}
+}
+
+// Iterates over the raw URLs fond on the page. These URLs will be added back into the
+// URL Queue if the job's max depth from the origin hasn't been reached yet. If the
+// depth has been reached the URLs will be just added to the Origin's Job URL result.
+// If enqueue is not set the URLs are only linked to the page. URLs out of the job's
+// scope are added to the results, but are not queued.
+func (c *Crawler) processURLDescendants(referItem *common.URLQueueItem, urls []string, opts *common.JobOptions, enqueue bool) error {
+	urlClient := c.sc.URLClient()
+
+	inScope, err := c.scopes.ForItem(referItem, opts)
+	if err != nil {
+		return fmt.Errorf("Failed to get scope of job %s, %v", referItem.JobId, err)
+	}
+
+	for i := 0; i < len(urls); i++ {
+		u := urls[i]
+
+		kind := common.GuessURLsMime(u)
+		urlRec, err := urlClient.GetOrAddURLByURL(u, kind)
+		if err != nil {
+			return fmt.Errorf("Failed to get or add URL %s, %v", u, err)
+		}
+
+		// Link the descendant with the refer, Ignore errors about duplicates
+		urlClient.AddLink(urlRec.Id, referItem.URLId)
+
+		if !enqueue {
+			continue
+		}
+		if !inScope.InScope(u) {
+			c.addResult(referItem.JobId, referItem.OriginId, referItem.URLId, urlRec.Id, u, referItem.Level+1)
+			continue
+		}
+		c.enqueueDescendant(referItem, urlRec.Id, u, kind, opts)
+	}
+
+	return nil
+}
+
+// Queues the URLs listed by the sitemaps of the origin's site as descendants
+// of the origin. The URLs are not linked to the origin, since they were not
+// found on it. URLs which were already found on the origin are skipped. URLs out
+// of the job's scope are added to the results, but are not queued.
+func (c *Crawler) processSitemapURLs(origin *common.URLQueueItem, sitemapURLs []SitemapURL, found []string, opts *common.JobOptions) error {
+	urlClient := c.sc.URLClient()
+
+	inScope, err := c.scopes.ForItem(origin, opts)
+	if err != nil {
+		return fmt.Errorf("Failed to get scope of job %s, %v", origin.JobId, err)
+	}
+
+	known := make(map[string]struct{}, len(found))
+	for _, u := range found {
+		known[u] = struct{}{}
+	}
+
+	for _, s := range sitemapURLs {
+		if _, ok := known[s.URL]; ok {
+			continue
+		}
+
+		kind := common.GuessURLsMime(s.URL)
+		urlRec, err := urlClient.GetOrAddURLByURL(s.URL, kind)
+		if err != nil {
+			return fmt.Errorf("Failed to get or add URL %s, %v", s.URL, err)
+		}
+		if !s.LastMod.IsZero() {
+			if err := urlClient.SetLastMod(urlRec.Id, s.LastMod); err != nil {
+				log.Println("crawl: failed to set URL's lastmod", urlRec.Id, err)
+			}
+		}
+		if urlRec.Id == origin.URLId {
+			continue
+		}
+		if !inScope.InScope(s.URL) {
+			c.addResult(origin.JobId, origin.OriginId, origin.URLId, urlRec.Id, s.URL, origin.Level+1)
+			continue
+		}
+
+		c.enqueueDescendant(origin, urlRec.Id, s.URL, kind, opts)
+	}
+
+	return nil
+}
+
+// Queues the descendant URL of the refer to be crawled if the job's max depth
+// would not be reached yet. Otherwise the URL is added as a result of the job, and
+// queued to be only checked.
+func (c *Crawler) enqueueDescendant(referItem *common.URLQueueItem, urlId common.URLId, u, kind string, opts *common.JobOptions) {
+	urlClient := c.sc.URLClient()
+
+	// Only process the URLs for queue, or skipping, if the max level would
+	// wouldn't be reached yet.
+	if referItem.Level+1 < opts.Depth() {
+		if opts.CanSkipMime(kind) {
+			c.addResult(referItem.JobId, referItem.OriginId, referItem.URLId, urlId, u, referItem.Level+1)
+		}
+
+		q := referItem.Descendant(urlId)
+		if err := urlClient.AddPending(referItem.JobId, urlId, q.OriginId); err != nil {
+			log.Println("crawl: failed to add pending URL", err)
+		}
+
+		c.urlQueuePub.Send(q)
+	} else {
+		// For any URL that will not be enqueued, add it as a result instead,
+		// and queue it to be checked so its fetch outcome is known.
+		c.addResult(referItem.JobId, referItem.OriginId, referItem.URLId, urlId, u, referItem.Level+1)
+
+		q := referItem.Descendant(urlId)
+		q.CheckOnly = true
+		if err := urlClient.AddPending(referItem.JobId, urlId, q.OriginId); err != nil {
+			log.Println("crawl: failed to add pending URL", err)
+		}
+
+		c.urlQueuePub.Send(q)
+	}
+}
+
+// Records the item's URL as failed to be fetched with the error, and retries
+// the item if the error was transient. Returns if the item was re-queued to be
+// retried, otherwise it was recorded as a dead letter.
+func (c *Crawler) fetchFailed(item *common.URLQueueItem, u string, fetch *storage.Fetch, err error) bool {
+	if err := c.sc.URLClient().MarkFetchFailed(item.URLId, fetch); err != nil {
+		log.Println("crawl: failed to update URL's fetch", item.URLId, err)
+	}
+	if c.retryItem(item, err) {
+		return true
+	}
+	c.publishCrawled(item, u, common.CrawlStatusFailed, "", fetch)
+	return false
+}
+
+// Records the URL as a result of the job at the level, and publishes the
+// result to the job's progress. Results the job already has are not published
+// again.
+func (c *Crawler) addResult(jobId common.JobId, originId, referId, urlId common.URLId, u string, level int) {
+	if added, err := c.sc.URLClient().AddResult(jobId, referId, urlId, level); err != nil {
+		log.Println("crawl: failed to add result", jobId, referId, urlId, err)
+		return
+	} else if !added {
+		return
+	}
+
+	c.publishProgress(&common.ProgressEvent{
+		JobId:    jobId,
+		Type:     common.ProgressResult,
+		OriginId: originId,
+		ReferId:  referId,
+		URLId:    urlId,
+		URL:      u,
+	})
+}
+
+// Publishes the outcome of crawling, or checking the item's URL to the
+// job's progress. The fetch is optional.
+func (c *Crawler) publishCrawled(item *common.URLQueueItem, u, crawlStatus, mime string, fetch *storage.Fetch) {
+	ev := &common.ProgressEvent{
+		JobId:       item.JobId,
+		Type:        common.ProgressCrawled,
+		OriginId:    item.OriginId,
+		ReferId:     item.ReferId,
+		URLId:       item.URLId,
+		URL:         u,
+		CrawlStatus: crawlStatus,
+		Mime:        mime,
+		CheckOnly:   item.CheckOnly,
+	}
+	if fetch != nil {
+		ev.StatusCode = fetch.StatusCode
+	}
+	c.publishProgress(ev)
+}
+
+// Publishes the event to the progress topic, stamped with the current time.
+func (c *Crawler) publishProgress(ev *common.ProgressEvent) {
+	ev.Time = time.Now().UTC()
+	c.progressPub.Send(ev)
+}
+
+// Holds the item of a paused job until the job is resumed, instead of crawling
+// it. Returns if the item was parked, in which case its pending record must be
+// kept so the job is not completed while it is paused. If the job was resumed,
+// or cancelled while the item was being parked, the job's parked items are
+// queued again so the item is not left behind.
+func (c *Crawler) parkItem(item *common.URLQueueItem) bool {
+	log.Println("crawl: Parking item of paused job", item.JobId, item.URLId)
+
+	parkedClient := c.sc.ParkedClient()
+	if err := parkedClient.Park(item); err != nil {
+		log.Println("crawl: Failed to park item", item.JobId, item.URLId, err)
+		return false
+	}
+
+	if state, err := c.sc.JobClient().GetState(item.JobId); err != nil {
+		log.Println("crawl: Failed to get job state", item.JobId, err)
+		return true
+	} else if state == common.JobStatePaused {
+		return true
+	}
+
+	items, err := parkedClient.Take(item.JobId)
+	if err != nil {
+		log.Println("crawl: Failed to take parked items", item.JobId, err)
+	}
+	for _, parked := range items {
+		c.urlQueuePub.Send(parked)
+	}
+	return true
+}
+
+// Returns the URLs of the links.
+func linkURLs(links []Link) []string {
+	urls := make([]string, 0, len(links))
+	for _, l := range links {
+		urls = append(urls, l.URL)
+	}
+	return urls
+}
+
+// Returns the URLs of the descendants found on the page when it was last crawled.
+func (c *Crawler) cachedDescendants(urlId common.URLId) ([]string, error) {
+	urlRecs, err := c.sc.URLClient().GetAllURLsWithReferById(urlId)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(urlRecs))
+	for _, u := range urlRecs {
+		urls = append(urls, u.URL)
+	}
+	return urls, nil
+}
+
+// Sets the User-Agent header on all requests made through the transport.
+type userAgentTransport struct {
+	userAgent string
+	rt        http.RoundTripper
+}
+
+// Satisfies the http.RoundTripper interface. The request is cloned before
+// its header is modified, since a RoundTripper should not modify requests.
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.rt.RoundTrip(req)
+}
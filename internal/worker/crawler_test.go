@@ -0,0 +1,44 @@
+package worker
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCrawlPausedJob(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	c, sc := newTestCrawler(t, CrawlerConfig{})
+	defer sc.Close()
+
+	job, err := sc.JobClient().CreateJobFromURLs([]string{server.URL + "/"}, common.JobOptions{})
+	require.Nil(t, err, "Expect no error creating job")
+	urlId := job.URLs[0].URLId
+	require.Nil(t, sc.URLClient().AddPending(job.Id, urlId, urlId), "Expect no error adding pending")
+
+	paused, err := sc.JobClient().Pause(job.Id)
+	require.Nil(t, err, "Expect no error pausing job")
+	require.True(t, paused, "Expect job paused")
+
+	item := &common.URLQueueItem{JobId: job.Id, OriginId: urlId, URLId: urlId}
+	c.Crawl(item)
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests), "Expect no request made for paused job")
+
+	items, err := sc.ParkedClient().Take(job.Id)
+	require.Nil(t, err, "Expect no error taking parked items")
+	assert.Equal(t, []*common.URLQueueItem{item}, items, "Expect item parked")
+
+	pending, err := sc.URLClient().HasPending(job.Id, urlId)
+	require.Nil(t, err, "Expect no error checking pending")
+	assert.True(t, pending, "Expect parked item still pending")
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/robots"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"sync"
+	"time"
+)
+
+// Duration a host is backed off for when it asks for requests to be retried
+// later, but does not say when.
+const defaultRetryAfter = time.Minute
+
+// Maximum number of scheduled items sent each time storage is polled.
+const maxDuePerPoll = 100
+
+// Duration a scheduled item is claimed for while it is sent to its queue.
+const scheduledLease = time.Minute
+
+// Returns the minimum interval between requests to a host based on the
+// crawler's requests per second. If the site's robots.txt asks for a
+// longer crawl delay, the crawl delay is used instead.
+func (c *Crawler) hostInterval(rules *robots.Robots) time.Duration {
+	interval := time.Duration(float64(time.Second) / c.cfg.HostRequestsPerSecond)
+	if delay := rules.CrawlDelay(c.cfg.UserAgent); delay > interval {
+		interval = delay
+	}
+	return interval
+}
+
+// Blocks until a connection to the host is acquired within the host's request
+// limits, and the site's crawl delay. Release must be called on the storage's
+// HostClient once the request is complete. An error is returned if the
+// connection cannot be acquired before the deadline.
+func (c *Crawler) waitForHost(host string, rules *robots.Robots, deadline time.Time) error {
+	for {
+		wait, err := c.sc.HostClient().Acquire(host, c.hostInterval(rules), c.cfg.HostMaxConnections)
+		if err != nil || wait == 0 {
+			return err
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("host %s busy for %s", host, wait.String())
+		}
+		time.Sleep(wait)
+	}
+}
+
+// Sends the item back to the work queue once the wait has passed. The
+// crawler does not block while waiting, so it is free to crawl items of
+// other hosts in the meantime.
+func (c *Crawler) deferItem(item *common.URLQueueItem, wait time.Duration) {
+	log.Println("crawl: Deferring", item.URLId, "for", wait.String())
+	c.sendLater(storage.ScheduledWorkQueue, item, wait)
+}
+
+// Schedules the item to be sent to the queue once the wait has passed. The
+// item is held in storage until it is sent by SendDue, so it is not lost if
+// the worker exits before then. If the item cannot be scheduled it is sent
+// immediately instead.
+func (c *Crawler) sendLater(queueName string, item *common.URLQueueItem, wait time.Duration) {
+	if err := c.sc.ScheduledClient().Schedule(queueName, item, time.Now().Add(wait)); err != nil {
+		log.Println("crawl: Failed to schedule", item.URLId, "sending now", err)
+		c.queuePub(queueName).Send(item)
+	}
+}
+
+// Sends the scheduled items which are due to their queue. Returns the
+// number of items sent. Items scheduled by any worker may be sent, so
+// items scheduled by a worker which exited are not lost.
+func (c *Crawler) SendDue() int {
+	scheduledClient := c.sc.ScheduledClient()
+
+	due, err := scheduledClient.Due(maxDuePerPoll)
+	if err != nil {
+		log.Println("crawl: Failed to get due scheduled items", err)
+		return 0
+	}
+
+	sent := 0
+	for _, scheduled := range due {
+		// The lease covers sending the item, so it is not sent by another
+		// worker at the same time. If the item is not removed once sent
+		// it will be sent again after the lease.
+		if claimed, err := scheduledClient.Claim(scheduled, scheduledLease); err != nil {
+			log.Println("crawl: Failed to claim scheduled item", scheduled.Id, scheduled.Item.URLId, err)
+			continue
+		} else if !claimed {
+			continue
+		}
+
+		c.queuePub(scheduled.Queue).Send(scheduled.Item)
+		sent++
+
+		if err := scheduledClient.Remove(scheduled); err != nil {
+			log.Println("crawl: Failed to remove scheduled item", scheduled.Id, scheduled.Item.URLId, err)
+		}
+	}
+	return sent
+}
+
+// Returns the publisher of the scheduled item queue.
+func (c *Crawler) queuePub(queueName string) queue.Publisher {
+	if queueName == storage.ScheduledURLQueue {
+		return c.urlQueuePub
+	}
+	return c.workQueuePub
+}
+
+// Counts the number of crawls of each host in progress within the worker
+// process. Safe to use across multiple go routines.
+type hostCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// Creates a new host counter with no crawls in progress.
+func newHostCounter() *hostCounter {
+	return &hostCounter{counts: make(map[string]int)}
+}
+
+// Increments the count of crawls for the host, if it is less than max.
+// Returns if the count was incremented. If it was, release must be
+// called once the crawl is complete.
+func (h *hostCounter) acquire(host string, max int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.counts[host] >= max {
+		return false
+	}
+	h.counts[host]++
+	return true
+}
+
+// Decrements the count of crawls for the host.
+func (h *hostCounter) release(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.counts[host] <= 1 {
+		delete(h.counts, host)
+		return
+	}
+	h.counts[host]--
+}
@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Publisher collecting the items sent to it.
+type mockPublisher struct {
+	items []*common.URLQueueItem
+}
+
+func (p *mockPublisher) Send(item ...*common.URLQueueItem) {
+	p.items = append(p.items, item...)
+}
+
+func (p *mockPublisher) Close() {}
+
+// Creates a crawler with embedded storage, which must be closed.
+func newTestCrawler(t *testing.T, cfg CrawlerConfig) (*Crawler, *storage.Client) {
+	sc, err := storage.NewClient(storage.ClientConfig{Driver: storage.DriverSQLite})
+	require.Nil(t, err, "Expect no storage error")
+
+	pub := &mockPublisher{}
+	return NewCrawler(pub, pub, nil, sc, cfg), sc
+}
+
+func TestHostCounter(t *testing.T) {
+	h := newHostCounter()
+
+	assert.True(t, h.acquire("http://a.com", 2), "Expect first acquire")
+	assert.True(t, h.acquire("http://a.com", 2), "Expect second acquire")
+	assert.False(t, h.acquire("http://a.com", 2), "Expect host at limit")
+	assert.True(t, h.acquire("http://b.com", 2), "Expect other host not limited")
+
+	h.release("http://a.com")
+	assert.True(t, h.acquire("http://a.com", 2), "Expect acquire after release")
+
+	h.release("http://b.com")
+	assert.Len(t, h.counts, 1, "Expect released host removed")
+}
+
+func TestScheduledItemsSurviveRestart(t *testing.T) {
+	c, sc := newTestCrawler(t, CrawlerConfig{RetryDelay: time.Millisecond})
+	defer sc.Close()
+
+	deferred := &common.URLQueueItem{URLId: 1}
+	later := &common.URLQueueItem{URLId: 2}
+	failed := &common.URLQueueItem{URLId: 3}
+	c.deferItem(deferred, time.Millisecond)
+	c.deferItem(later, time.Hour)
+	require.True(t, c.retryItem(failed, &ServerError{StatusCode: 503}), "Expect failed item retried")
+
+	// Crawler sharing the storage, as if the worker was restarted.
+	urlPub, workPub := &mockPublisher{}, &mockPublisher{}
+	restarted := NewCrawler(urlPub, workPub, nil, sc, CrawlerConfig{})
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 2, restarted.SendDue(), "Expect due items sent")
+	assert.Equal(t, []*common.URLQueueItem{deferred}, workPub.items, "Expect deferred item sent to the work queue")
+	assert.Equal(t, []*common.URLQueueItem{{URLId: 3, Attempt: 1}}, urlPub.items, "Expect retry sent to the URL queue")
+	assert.Equal(t, 0, restarted.SendDue(), "Expect items only sent once")
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"sync"
+	"time"
+)
+
+// Pool of go routines crawling work items concurrently. The number of go
+// routines bounds the number of crawls the worker makes at once. Crawls of
+// the same host are additionally bounded by the crawler's host concurrency.
+type Pool struct {
+	crawler *Crawler
+	size    int
+
+	// Closed to signal the go routines to stop taking new work.
+	stop chan struct{}
+
+	// Tracks the running go routines so Stop can wait for their
+	// in-flight crawls to finish.
+	wg sync.WaitGroup
+}
+
+// Creates a new pool of size go routines crawling with the crawler. If size
+// is less than one, a single go routine will be used.
+func NewPool(crawler *Crawler, size int) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		crawler: crawler,
+		size:    size,
+		stop:    make(chan struct{}),
+	}
+}
+
+// Starts the pool's go routines crawling items received from the channel,
+// and polling storage for the crawler's scheduled items which are due.
+// Start should only be called once.
+func (p *Pool) Start(items <-chan *common.URLQueueItem) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.crawler.cfg.SchedulePollInterval)
+		defer ticker.Stop()
+		for {
+			p.crawler.SendDue()
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	for i := 0; i < p.size; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case <-p.stop:
+					return
+				case item := <-items:
+					p.crawler.Crawl(item)
+				}
+			}
+		}()
+	}
+}
+
+// Stops the pool from taking new work, and blocks until all in-flight crawls
+// have finished. Items the crawler scheduled to be retried or deferred are
+// held in storage, and sent once due by any running worker.
+func (p *Pool) Stop() {
+	close(p.stop)
+	p.wg.Wait()
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"errors"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Maximum duration before a URL which failed to be crawled is retried.
+const maxRetryDelay = time.Hour
+
+// Re-queues the item to the URL queue to be retried later if the crawl
+// failed with a transient error, and the item has attempts left. Otherwise
+// the item is recorded as a dead letter for its job. Returns if the item
+// was re-queued.
+func (c *Crawler) retryItem(item *common.URLQueueItem, err error) bool {
+	attempts := item.Attempt + 1
+	if isTransient(err) && attempts < c.cfg.MaxAttempts {
+		wait := retryDelay(c.cfg.RetryDelay, item.Attempt)
+		log.Println("crawl: Retrying", item.URLId, "attempt", attempts+1, "in", wait.String())
+
+		retry := *item
+		retry.Attempt = attempts
+		c.sendLater(storage.ScheduledURLQueue, &retry, wait)
+		return true
+	}
+
+	log.Println("crawl: Giving up on", item.URLId, "after", attempts, "attempts", err)
+	if err := c.sc.DeadLetterClient().Add(&storage.DeadLetter{
+		JobId:      item.JobId,
+		URLId:      item.URLId,
+		OriginId:   item.OriginId,
+		ReferId:    item.ReferId,
+		Attempts:   attempts,
+		LastError:  err.Error(),
+		StatusCode: errStatusCode(err),
+	}); err != nil {
+		log.Println("crawl: Failed to add dead letter for", item.URLId, err)
+	}
+	return false
+}
+
+// Returns the delay before the retry following the attempt. The delay
+// doubles with each attempt, up to maxRetryDelay.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// Returns if the error is from a failure which may not happen again if the
+// request is retried, such as a server error, or failing to connect.
+func isTransient(err error) bool {
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return true
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		var netErr net.Error
+		return errors.As(urlErr.Err, &netErr)
+	}
+
+	return false
+}
+
+// Returns the HTTP status code of the response the error was for. Zero if
+// the error was not caused by a response.
+func errStatusCode(err error) int {
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, retryDelay(30*time.Second, 0), "Expect base delay for first retry")
+	assert.Equal(t, 2*time.Minute, retryDelay(30*time.Second, 2), "Expect delay to double each attempt")
+	assert.Equal(t, maxRetryDelay, retryDelay(30*time.Second, 100), "Expect delay capped")
+}
+
+func TestIsTransient(t *testing.T) {
+	connErr := &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	schemeErr := &url.Error{Op: "Get", URL: "ftp://example.com", Err: errors.New("unsupported protocol scheme")}
+
+	assert.True(t, isTransient(&ServerError{StatusCode: 500}), "Expect server error transient")
+	assert.True(t, isTransient(connErr), "Expect connection error transient")
+	assert.False(t, isTransient(schemeErr), "Expect invalid request not transient")
+	assert.False(t, isTransient(errors.New("other")), "Expect other errors not transient")
+
+	assert.Equal(t, 502, errStatusCode(&ServerError{StatusCode: 502}), "Expect server error status code")
+	assert.Equal(t, 0, errStatusCode(connErr), "Expect no status code without a response")
+}
@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/robots"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"time"
+)
+
+// Maximum number of bytes of a robots.txt which will be read. Any content
+// past this limit is ignored.
+const maxRobotsSize = 500 * 1024
+
+// Maximum age a cached robots.txt server error is used for before the
+// robots.txt is requested again. Server errors are expected to be short
+// lived, so they are not cached for the crawler's robots max age.
+const robotsErrorMaxAge = 5 * time.Minute
+
+// Error returned when a site's robots.txt could not be retrieved, because
+// the site could not be reached, or responded with a server error. The
+// site's URLs cannot be crawled until its robots.txt is retrieved, so the
+// item failed to be fetched.
+type RobotsError struct {
+	// Scheme and host of the site, e.g: https://example.com
+	Host string
+
+	// Error the robots.txt request failed with
+	Err error
+}
+
+// Satisfies the error interface
+func (e *RobotsError) Error() string {
+	return fmt.Sprintf("robots.txt of %s unavailable, %v", e.Host, e.Err)
+}
+
+// Returns the error the robots.txt request failed with.
+func (e *RobotsError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the robots.txt rules of the URL's site. The robots.txt cached in
+// storage will be used if it is younger than the crawler's robots max age.
+// Otherwise the robots.txt is requested from the site and stored, so that
+// it is shared with all other workers.
+//
+// A RobotsError is returned if the site could not be reached, or responded
+// with a server error. Unreachable sites are not cached, so the robots.txt
+// is requested again when the item is retried.
+func (c *Crawler) getRobots(u *url.URL) (*robots.Robots, error) {
+	host := u.Scheme + "://" + u.Host
+	robotsClient := c.sc.RobotsClient()
+
+	cached, err := robotsClient.Get(host, c.cfg.RobotsMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && (cached.StatusCode < 500 || time.Now().Sub(cached.FetchedOn) < robotsErrorMaxAge) {
+		return robotsFromResponse(host, cached.StatusCode, cached.Body)
+	}
+
+	statusCode, body, err := c.requestRobots(host)
+	if err != nil {
+		return nil, &RobotsError{Host: host, Err: err}
+	}
+	if err := robotsClient.Put(host, statusCode, body); err != nil {
+		// The rules can still be used even if they failed to be cached
+		log.Println("crawl: failed to store robots.txt", host, err)
+	}
+
+	return robotsFromResponse(host, statusCode, body)
+}
+
+// Returns the rules of the robots.txt response. A RobotsError is returned if
+// the response was a server error.
+func robotsFromResponse(host string, statusCode int, body []byte) (*robots.Robots, error) {
+	if statusCode >= 500 {
+		return nil, &RobotsError{Host: host, Err: &ServerError{StatusCode: statusCode}}
+	}
+	return robots.FromResponse(statusCode, body), nil
+}
+
+// Requests the robots.txt of the site's host, returning the response's status
+// code and body. An error is returned if the site could not be reached, or
+// the response could not be read.
+func (c *Crawler) requestRobots(host string) (int, []byte, error) {
+	resp, err := c.client.Get(host + "/robots.txt")
+	if err != nil {
+		log.Println("crawl: failed to request robots.txt", host, err)
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
+	if err != nil {
+		log.Println("crawl: failed to read robots.txt", host, err)
+		return 0, nil, err
+	}
+
+	return resp.StatusCode, body, nil
+}
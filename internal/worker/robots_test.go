@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGetRobotsUnreachable(t *testing.T) {
+	c, sc := newTestCrawler(t, CrawlerConfig{})
+	defer sc.Close()
+
+	// Closed so the site refuses connections.
+	site := httptest.NewServer(http.NotFoundHandler())
+	site.Close()
+	u, _ := url.Parse(site.URL + "/page")
+
+	rules, err := c.getRobots(u)
+	assert.Nil(t, rules, "Expect no rules")
+	require.IsType(t, &RobotsError{}, err, "Expect robots error")
+	assert.True(t, isTransient(err), "Expect unreachable site to be retried")
+
+	cached, err := sc.RobotsClient().Get(site.URL, time.Hour)
+	require.Nil(t, err, "Expect no storage error")
+	assert.Nil(t, cached, "Expect unreachable robots.txt not cached")
+}
+
+func TestGetRobotsServerError(t *testing.T) {
+	c, sc := newTestCrawler(t, CrawlerConfig{})
+	defer sc.Close()
+
+	requests := 0
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	}))
+	defer site.Close()
+	u, _ := url.Parse(site.URL + "/page")
+
+	_, err := c.getRobots(u)
+	require.IsType(t, &RobotsError{}, err, "Expect robots error")
+	assert.True(t, isTransient(err), "Expect server error to be retried")
+	assert.Equal(t, http.StatusBadGateway, errStatusCode(err), "Expect server error status code")
+
+	_, err = c.getRobots(u)
+	assert.NotNil(t, err, "Expect cached server error")
+	assert.Equal(t, 1, requests, "Expect server error cached")
+}
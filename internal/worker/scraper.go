@@ -0,0 +1,359 @@
+package worker
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error returned when a site responds to a request with a 429 Too Many
+// Requests, or 503 Service Unavailable status. The request should be
+// retried later.
+type RetryLaterError struct {
+	// HTTP status code of the response
+	StatusCode int
+
+	// Duration the site asked to wait before retrying the request via
+	// the Retry-After header. Zero if the site did not say.
+	RetryAfter time.Duration
+}
+
+// Satisfies the error interface
+func (e *RetryLaterError) Error() string {
+	return fmt.Sprintf("retry later, status %d, retry after %s", e.StatusCode, e.RetryAfter)
+}
+
+// Error returned when a site responds to a request with a 5xx server error
+// status, other than 503 Service Unavailable. The request may succeed if
+// it is retried.
+type ServerError struct {
+	// HTTP status code of the response
+	StatusCode int
+}
+
+// Satisfies the error interface
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error, status %d", e.StatusCode)
+}
+
+// Error returned when a site responds with a 304 Not Modified status to a
+// request which was not conditional. There is no cached content the response
+// could refer to.
+var errUnexpectedNotModified = errors.New("unexpected status 304, the request was not conditional")
+
+// Content, other than HTML documents, to search for links when scraping.
+type ScrapeOptions struct {
+	// Search stylesheets, and the inline <style> elements and style
+	// attributes of HTML documents for the URLs of url() values, and
+	// @import rules.
+	CSS bool
+
+	// Search javascript, and the inline scripts of HTML documents, for
+	// things which look like URLs.
+	JS bool
+}
+
+// Requests, and scrapes the content of a URL for links. The URL's content will only be
+// scrapped if its returned Content-Type (mime) is text/html, or is a stylesheet or
+// javascript the options ask to be scrapped. The list of links will also
+// be de-duped by URL preventing duplicate entries, keeping the first link found for each
+// URL. The HTTP metadata of the fetch is always returned, even if the request failed.
+//
+// If the cached fetch of the URL is provided the request is made conditional on
+// the content having changed since, using the cached fetch's ETag and Last-Modified
+// validators. If the content has not changed the returned fetch's status code will
+// be 304 Not Modified, and no mime or links will be returned.
+func Scrape(tgtURL string, client *http.Client, cached *storage.Fetch, opts ScrapeOptions) (fetch *storage.Fetch, mime string, links []Link, err error) {
+	var body []byte
+	fetch, mime, body, err = requestContent(client, tgtURL, cached)
+	if err != nil {
+		return fetch, "", nil, err
+	}
+	if fetch.StatusCode == http.StatusNotModified {
+		return fetch, "", nil, nil
+	}
+
+	isHTML := mime == "text/html"
+	isCSS := opts.CSS && mime == "text/css"
+	isJS := opts.JS && common.IsJavaScriptMime(mime)
+	if body == nil || !(isHTML || isCSS || isJS) {
+		// Only valid body responses, of documents which can be scrapped are.
+		return fetch, mime, []Link{}, nil
+	}
+
+	// Links are resolved against the final URL after any redirects.
+	finalURL, err := url.Parse(fetch.FinalURL)
+	if err != nil {
+		return fetch, "", nil, err
+	}
+
+	var found []Link
+	switch {
+	case isHTML:
+		found = findHTMLDocLinks(finalURL, body, opts)
+	case isCSS:
+		found = findCSSDocLinks(finalURL, body)
+	case isJS:
+		found = findJSDocLinks(finalURL, body)
+	}
+
+	known := make(map[string]struct{})
+	links = []Link{}
+	for _, l := range found {
+		if _, ok := known[l.URL]; ok {
+			// Prevent duplicate entries
+			continue
+		}
+		known[l.URL] = struct{}{}
+		links = append(links, l)
+	}
+
+	return fetch, mime, links, nil
+}
+
+// Requests content from a URL and returns the properties of that content along with its body.
+// a body will only be returned if the content type of the response is a text/*, or javascript. The HTTP
+// metadata of the fetch is always returned, and includes the error if the request failed.
+// If the cached fetch is provided the request is conditional on the content having changed
+// since the cached fetch. If it has not, no content is returned. A 304 Not Modified
+// response to a request which was not conditional is an error.
+func requestContent(client *http.Client, tgtURL string, cached *storage.Fetch) (fetch *storage.Fetch, mime string, body []byte, err error) {
+	fetch = &storage.Fetch{ContentLength: -1}
+	defer finishFetch(fetch, time.Now(), &err)
+
+	header := http.Header{}
+	if cached != nil {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	var resp *http.Response
+	if resp, err = doRequest(client, "GET", tgtURL, header, fetch); err != nil {
+		return fetch, "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		if len(header) == 0 {
+			return fetch, "", nil, errUnexpectedNotModified
+		}
+
+		// The response is not required to repeat the validators, or the
+		// length of the content which has not changed.
+		if fetch.ETag == "" {
+			fetch.ETag = cached.ETag
+		}
+		if fetch.LastModified == "" {
+			fetch.LastModified = cached.LastModified
+		}
+		if fetch.ContentLength <= 0 {
+			fetch.ContentLength = cached.ContentLength
+		}
+		return fetch, "", nil, nil
+	}
+
+	mime, body, err = validateContent(resp)
+	if fetch.ContentLength < 0 && body != nil {
+		fetch.ContentLength = int64(len(body))
+	}
+	return fetch, mime, body, err
+}
+
+// Requests a URL only to check that it can be fetched, without reading its
+// content. URLs which are expected to not be HTML documents, e.g: images,
+// are requested with HEAD, falling back to GET if the site does not support
+// HEAD requests. The HTTP metadata of the fetch is always returned, and
+// includes the error if the request failed.
+func Check(tgtURL string, client *http.Client) (fetch *storage.Fetch, mime string, err error) {
+	fetch = &storage.Fetch{ContentLength: -1}
+	defer finishFetch(fetch, time.Now(), &err)
+
+	method := "GET"
+	if common.CanSkipMime(common.GuessURLsMime(tgtURL)) {
+		method = "HEAD"
+	}
+
+	var resp *http.Response
+	resp, err = doRequest(client, method, tgtURL, nil, fetch)
+	if method == "HEAD" && (fetch.StatusCode == http.StatusMethodNotAllowed || fetch.StatusCode == http.StatusNotImplemented) {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		resp, err = doRequest(client, "GET", tgtURL, nil, fetch)
+	}
+	if err != nil {
+		return fetch, "", err
+	}
+	resp.Body.Close()
+
+	return fetch, contentMime(resp), nil
+}
+
+// Makes a request to the URL with the headers, recording the HTTP metadata of
+// the response into the fetch. An error is returned if the request failed, or
+// the site responded with a status that the request should be retried for.
+// The response's body must be closed if no error is returned.
+func doRequest(client *http.Client, method, tgtURL string, header http.Header, fetch *storage.Fetch) (*http.Response, error) {
+	req, err := http.NewRequest(method, tgtURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	fetch.StatusCode = resp.StatusCode
+	fetch.FinalURL = resp.Request.URL.String()
+	fetch.ContentLength = resp.ContentLength
+	fetch.ETag = resp.Header.Get("ETag")
+	fetch.LastModified = resp.Header.Get("Last-Modified")
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		resp.Body.Close()
+		return nil, &RetryLaterError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	if resp.StatusCode >= 500 {
+		resp.Body.Close()
+		return nil, &ServerError{StatusCode: resp.StatusCode}
+	}
+
+	return resp, nil
+}
+
+// Completes the fetch's metadata once the fetch is done. Records the
+// duration since the fetch started, and the error of the fetch if any.
+func finishFetch(fetch *storage.Fetch, startedAt time.Time, err *error) {
+	fetch.ResponseTime = time.Now().Sub(startedAt)
+	if *err != nil {
+		fetch.Error = (*err).Error()
+		fetch.ErrorKind = fetchErrorKind(*err)
+	}
+}
+
+// Classifies the kind of error a fetch failed with.
+func fetchErrorKind(err error) string {
+	var (
+		serverErr  *ServerError
+		retryErr   *RetryLaterError
+		dnsErr     *net.DNSError
+		certErr    *tls.CertificateVerificationError
+		recordErr  tls.RecordHeaderError
+		alertErr   tls.AlertError
+		authErr    x509.UnknownAuthorityError
+		hostErr    x509.HostnameError
+		invalidErr x509.CertificateInvalidError
+		netErr     net.Error
+		urlErr     *url.Error
+	)
+
+	switch {
+	case errors.As(err, &serverErr), errors.As(err, &retryErr), errors.Is(err, errUnexpectedNotModified):
+		return common.FetchErrorStatus
+	case errors.As(err, &dnsErr):
+		return common.FetchErrorDNS
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &authErr), errors.As(err, &hostErr), errors.As(err, &invalidErr):
+		return common.FetchErrorTLS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return common.FetchErrorTimeout
+	case errors.As(err, &urlErr) && errors.As(urlErr.Err, &netErr):
+		return common.FetchErrorConnection
+	case errors.As(err, &urlErr):
+		return common.FetchErrorRequest
+	}
+	return ""
+}
+
+// Parses the value of a Retry-After header, which is either a number of
+// seconds, or an HTTP date. Zero is returned if the value is not valid,
+// or the date has already passed.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// Returns the mime type of the response's content, without any parameters.
+func contentMime(resp *http.Response) string {
+	mime := resp.Header.Get("Content-Type")
+	if mime == "" {
+		mime = "application/octet-stream"
+	}
+	if i := strings.Index(mime, ";"); i >= 0 {
+		mime = mime[:i]
+	}
+	return mime
+}
+
+// Validates the content of the response to determine if it is text, or javascript,
+// and can be parsed
+func validateContent(resp *http.Response) (mime string, body []byte, err error) {
+	mime = contentMime(resp)
+
+	if !strings.HasPrefix(mime, "text") && !common.IsJavaScriptMime(mime) {
+		// If this is not a text document there is no point reading the body
+		return mime, nil, nil
+	}
+
+	buf := bytes.Buffer{}
+	// TODO this should be limited to a sane max length
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return "", nil, err
+	}
+
+	return mime, buf.Bytes(), nil
+}
+
+// Resolves the URL provided against the base URL, so that it contains a scheme and
+// host. Relative URLs are resolved as described by RFC 3986. The fragment of the URL
+// is removed since it does not change the content the URL refers to. URLs which are
+// not http or https, e.g: data, mailto, or javascript URLs, are rejected.
+func normalizeURL(base *url.URL, u string) (string, error) {
+	ref, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+
+	normURL := base.ResolveReference(ref)
+	if normURL.Scheme != "http" && normURL.Scheme != "https" {
+		return "", fmt.Errorf("not http URL link")
+	}
+	if normURL.Host == "" {
+		return "", fmt.Errorf("URL link has no host")
+	}
+	normURL.Fragment = ""
+
+	return normURL.String(), nil
+}
@@ -0,0 +1,241 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestScrapValidateContent(t *testing.T) {
+	mockBody := ioutil.NopCloser(bytes.NewBuffer([]byte("body content")))
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       mockBody,
+	}
+	resp.Header.Set("Content-Type", "text/html")
+
+	mime, body, err := validateContent(resp)
+
+	require.Nil(t, err, "Expect no validation error")
+	assert.Equal(t, "text/html", mime, "Expected mime to match")
+	assert.Equal(t, "body content", string(body), "Expect body to match")
+}
+
+func TestScrapValidateContentInvalid(t *testing.T) {
+	mockBody := ioutil.NopCloser(bytes.NewBuffer(nil))
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+		Body:       mockBody,
+	}
+	resp.Header.Set("Content-Type", "")
+
+	mime, body, err := validateContent(resp)
+
+	require.Nil(t, err, "Expect no validation error")
+	assert.Equal(t, "application/octet-stream", mime, "Expected mime to be subsituted.")
+	assert.Len(t, body, 0, "Expect body to be empty")
+}
+
+func TestScrapRequestContentFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("ETag", `"abc"`)
+			w.Header().Set("Last-Modified", "Sun, 01 Mar 2015 12:00:00 GMT")
+			fmt.Fprint(w, "body content")
+		default:
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	fetch, mime, body, err := requestContent(server.Client(), server.URL+"/old", nil)
+	require.Nil(t, err, "Expect no request error")
+	assert.Equal(t, "text/html", mime, "Expect mime to match")
+	assert.Equal(t, "body content", string(body), "Expect body to match")
+	assert.Equal(t, http.StatusOK, fetch.StatusCode, "Expect status code")
+	assert.Equal(t, server.URL+"/new", fetch.FinalURL, "Expect final URL after redirect")
+	assert.Equal(t, int64(len("body content")), fetch.ContentLength, "Expect content length")
+	assert.Equal(t, `"abc"`, fetch.ETag, "Expect ETag")
+	assert.Equal(t, "Sun, 01 Mar 2015 12:00:00 GMT", fetch.LastModified, "Expect Last-Modified")
+	assert.Empty(t, fetch.Error, "Expect no fetch error")
+
+	fetch, _, _, err = requestContent(server.Client(), server.URL+"/broken", nil)
+	assert.NotNil(t, err, "Expect server error")
+	assert.Equal(t, http.StatusInternalServerError, fetch.StatusCode, "Expect status code")
+	assert.Equal(t, err.Error(), fetch.Error, "Expect fetch error")
+}
+
+func TestScrapConditional(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"abc"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"abc"`)
+		fmt.Fprint(w, `<a href="/a">a</a>`)
+	}))
+	defer server.Close()
+
+	fetch, mime, links, err := Scrape(server.URL, server.Client(), nil, ScrapeOptions{})
+	require.Nil(t, err, "Expect no scrape error")
+	assert.Equal(t, http.StatusOK, fetch.StatusCode, "Expect status code")
+	assert.Equal(t, "text/html", mime, "Expect mime to match")
+	assert.Equal(t, []Link{{URL: server.URL + "/a", Tag: "a", Attr: "href"}}, links, "Expect links scraped")
+
+	cached := &storage.Fetch{ETag: `"abc"`, LastModified: "Sun, 01 Mar 2015 12:00:00 GMT", ContentLength: 18}
+	fetch, mime, links, err = Scrape(server.URL, server.Client(), cached, ScrapeOptions{})
+	require.Nil(t, err, "Expect no scrape error")
+	assert.Equal(t, http.StatusNotModified, fetch.StatusCode, "Expect not modified")
+	assert.Equal(t, cached.ETag, fetch.ETag, "Expect cached ETag kept")
+	assert.Equal(t, cached.LastModified, fetch.LastModified, "Expect cached Last-Modified kept")
+	assert.Equal(t, cached.ContentLength, fetch.ContentLength, "Expect cached content length kept")
+	assert.Empty(t, mime, "Expect no mime")
+	assert.Nil(t, links, "Expect no links scraped")
+}
+
+func TestScrapUnexpectedNotModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	for _, cached := range []*storage.Fetch{nil, {ContentLength: 18}} {
+		fetch, _, _, err := Scrape(server.URL, server.Client(), cached, ScrapeOptions{})
+		assert.Equal(t, errUnexpectedNotModified, err, "Expect unconditional request to fail")
+		assert.Equal(t, http.StatusNotModified, fetch.StatusCode, "Expect status code")
+		assert.Equal(t, common.FetchErrorStatus, fetch.ErrorKind, "Expect status error")
+	}
+}
+
+func TestScrapStylesheet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		fmt.Fprint(w, `@import "print.css"; body { background: url(bg.png); }`)
+	}))
+	defer server.Close()
+
+	_, mime, links, err := Scrape(server.URL+"/site.css", server.Client(), nil, ScrapeOptions{})
+	require.Nil(t, err, "Expect no scrape error")
+	assert.Equal(t, "text/css", mime, "Expect mime to match")
+	assert.Empty(t, links, "Expect stylesheet not scraped")
+
+	_, _, links, err = Scrape(server.URL+"/site.css", server.Client(), nil, ScrapeOptions{CSS: true})
+	require.Nil(t, err, "Expect no scrape error")
+	assert.Equal(t, []Link{
+		{URL: server.URL + "/print.css", Tag: "style"},
+		{URL: server.URL + "/bg.png", Tag: "style"},
+	}, links, "Expect stylesheet links scraped")
+}
+
+func TestScrapCheck(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		switch r.URL.Path {
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/no-head.png":
+			if r.Method == "HEAD" {
+				http.Error(w, "not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetch, mime, err := Check(server.URL+"/logo.png", server.Client())
+	require.Nil(t, err, "Expect no check error")
+	assert.Equal(t, "image/png", mime, "Expect mime to match")
+	assert.Equal(t, http.StatusOK, fetch.StatusCode, "Expect status code")
+	assert.Equal(t, []string{"HEAD"}, methods, "Expect HEAD request for image")
+
+	methods = nil
+	fetch, _, err = Check(server.URL+"/no-head.png", server.Client())
+	require.Nil(t, err, "Expect no check error")
+	assert.Equal(t, http.StatusOK, fetch.StatusCode, "Expect status code")
+	assert.Equal(t, []string{"HEAD", "GET"}, methods, "Expect GET fallback")
+
+	methods = nil
+	fetch, _, err = Check(server.URL+"/missing", server.Client())
+	require.Nil(t, err, "Expect no check error")
+	assert.Equal(t, http.StatusNotFound, fetch.StatusCode, "Expect status code")
+	assert.Equal(t, []string{"GET"}, methods, "Expect GET request for page")
+}
+
+func TestFetchErrorKind(t *testing.T) {
+	dnsErr := &url.Error{Op: "Get", URL: "http://missing.example", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "missing.example"}}}
+	certErr := &url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}
+	connErr := &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	timeoutErr := &url.Error{Op: "Get", URL: "http://example.com", Err: context.DeadlineExceeded}
+
+	assert.Equal(t, common.FetchErrorDNS, fetchErrorKind(dnsErr), "Expect DNS error")
+	assert.Equal(t, common.FetchErrorTLS, fetchErrorKind(certErr), "Expect TLS error")
+	assert.Equal(t, common.FetchErrorConnection, fetchErrorKind(connErr), "Expect connection error")
+	assert.Equal(t, common.FetchErrorTimeout, fetchErrorKind(timeoutErr), "Expect timeout error")
+	assert.Equal(t, common.FetchErrorStatus, fetchErrorKind(&ServerError{StatusCode: 500}), "Expect status error")
+}
+
+func TestNomralizeURL(t *testing.T) {
+	origin, _ := url.Parse("https://example.come/blah/blah")
+
+	u, err := normalizeURL(origin, "http://www.google.com/first/second")
+	assert.Nil(t, err, "No error")
+	assert.Equal(t, "http://www.google.com/first/second", u, "Expect URLs to match.")
+
+	u, err = normalizeURL(origin, "//example.com/sports")
+	assert.Nil(t, err, "No error")
+	assert.Equal(t, "https://example.com/sports", u, "Expect URLs to match.")
+
+	u, err = normalizeURL(origin, "sports.png")
+	assert.Nil(t, err, "No error")
+	assert.Equal(t, "https://example.come/blah/sports.png", u, "Expect URLs to match.")
+
+	u, err = normalizeURL(origin, "sports/")
+	assert.Nil(t, err, "No error")
+	assert.Equal(t, "https://example.come/blah/sports/", u, "Expect URLs to match.")
+
+	u, err = normalizeURL(origin, "../sports#scores")
+	assert.Nil(t, err, "No error")
+	assert.Equal(t, "https://example.come/sports", u, "Expect URLs to match without fragment.")
+
+	u, err = normalizeURL(origin, "data:image/jpeg;base64,/9j/4AAQSkZJRgABAQAAAQABAAD/2wBDAAoHBwgH")
+	assert.NotNil(t, err, "Data URI should be reject")
+
+	u, err = normalizeURL(origin, "mailto:someone@example.com")
+	assert.NotNil(t, err, "Mailto URI should be reject")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120", now), "Expect seconds")
+	assert.Equal(t, 90*time.Second, parseRetryAfter("Sun, 01 Mar 2015 12:01:30 GMT", now), "Expect date")
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Sun, 01 Mar 2015 11:00:00 GMT", now), "Expect passed date ignored")
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now), "Expect invalid value ignored")
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now), "Expect missing value ignored")
+}
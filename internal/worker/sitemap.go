@@ -0,0 +1,208 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"github.com/jasdel/harvester/internal/robots"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Maximum number of bytes of a sitemap which will be read, after it is
+// decompressed. Matches the limit of the sitemap protocol.
+const maxSitemapSize = 50 * 1024 * 1024
+
+// Maximum number of sitemaps requested for a site, including the sitemaps
+// listed by sitemap index files.
+const maxSitemaps = 100
+
+// Maximum duration sitemap discovery waits on the request limits of the
+// sitemaps' hosts in total. Sitemaps which are not requested within the wait
+// are skipped.
+const maxSitemapHostWait = time.Minute
+
+// A URL listed by a sitemap.
+type SitemapURL struct {
+	// Absolute URL of the page
+	URL string
+
+	// Time the sitemap lists the page's content as last modified. Zero
+	// if the sitemap does not say.
+	LastMod time.Time
+}
+
+// Content of a sitemap, or sitemap index file. Elements are matched
+// regardless of their namespace.
+type sitemapDoc struct {
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// A <url> or <sitemap> entry of a sitemap.
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// Formats of the W3C Datetime lastmod values of sitemaps.
+var sitemapTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// Discovers the sitemaps of the site, and returns the URLs they list. The
+// site's /sitemap.xml and the sitemaps listed by its robots.txt are
+// requested, along with the sitemaps listed by any sitemap index files.
+// Sitemaps which fail to be requested or parsed are skipped.
+//
+// Sitemaps are requested within the request limits of their host, and only
+// if their host's robots.txt allows them. Once the limits have been waited
+// on for maxSitemapHostWait, the remaining sitemaps are skipped.
+func (c *Crawler) discoverSitemaps(host string, rules *robots.Robots) []SitemapURL {
+	pending := append([]string{host + "/sitemap.xml"}, rules.Sitemaps...)
+	requested := make(map[string]struct{})
+	known := make(map[string]struct{})
+	urls := []SitemapURL{}
+	deadline := time.Now().Add(maxSitemapHostWait)
+
+	for len(pending) > 0 && len(requested) < maxSitemaps {
+		u := pending[0]
+		pending = pending[1:]
+		if _, ok := requested[u]; ok {
+			continue
+		}
+		requested[u] = struct{}{}
+
+		parsed, err := url.Parse(u)
+		if err != nil {
+			log.Println("crawl: failed to parse sitemap URL", u, err)
+			continue
+		}
+		sitemapHost := parsed.Scheme + "://" + parsed.Host
+		sitemapRules := rules
+		if sitemapHost != host {
+			if sitemapRules, err = c.getRobots(parsed); err != nil {
+				log.Println("crawl: failed to get sitemap's robots.txt", u, err)
+				continue
+			}
+		}
+		if !sitemapRules.Allowed(c.cfg.UserAgent, parsed.RequestURI()) {
+			log.Println("crawl: sitemap blocked by robots.txt", u)
+			continue
+		}
+
+		if err := c.waitForHost(sitemapHost, sitemapRules, deadline); err != nil {
+			log.Println("crawl: skipping remaining sitemaps", u, err)
+			break
+		}
+		listed, sitemaps, err := requestSitemap(c.client, u)
+		if err := c.sc.HostClient().Release(sitemapHost); err != nil {
+			log.Println("crawl: Failed to release host", sitemapHost, err)
+		}
+		if err != nil {
+			log.Println("crawl: failed to request sitemap", u, err)
+			continue
+		}
+		pending = append(pending, sitemaps...)
+
+		for _, l := range listed {
+			if _, ok := known[l.URL]; ok {
+				continue
+			}
+			known[l.URL] = struct{}{}
+			urls = append(urls, l)
+		}
+	}
+
+	return urls
+}
+
+// Requests and parses a sitemap, returning the URLs it lists, and the
+// sitemaps it lists if it is a sitemap index file. Gzip compressed
+// sitemaps are decompressed.
+func requestSitemap(client *http.Client, sitemapURL string) ([]SitemapURL, []string, error) {
+	resp, err := client.Get(sitemapURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSitemapSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Gzip sitemaps are identified by their content, since they are
+	// served with a variety of content types.
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		if body, err = ioutil.ReadAll(io.LimitReader(r, maxSitemapSize)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	base, err := url.Parse(resp.Request.URL.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseSitemap(base, body)
+}
+
+// Parses the content of a sitemap, or sitemap index file. The locations
+// are resolved against the sitemap's URL. Locations which are not valid,
+// or are not http or https URLs are dropped.
+func parseSitemap(sitemapURL *url.URL, body []byte) ([]SitemapURL, []string, error) {
+	doc := sitemapDoc{}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	urls := []SitemapURL{}
+	for _, e := range doc.URLs {
+		u, err := normalizeURL(sitemapURL, strings.TrimSpace(e.Loc))
+		if err != nil {
+			continue
+		}
+		urls = append(urls, SitemapURL{URL: u, LastMod: parseSitemapTime(e.LastMod)})
+	}
+
+	sitemaps := []string{}
+	for _, e := range doc.Sitemaps {
+		u, err := normalizeURL(sitemapURL, strings.TrimSpace(e.Loc))
+		if err != nil {
+			continue
+		}
+		sitemaps = append(sitemaps, u)
+	}
+
+	return urls, sitemaps, nil
+}
+
+// Parses the W3C Datetime lastmod value of a sitemap entry. Zero is
+// returned if the value is not valid.
+func parseSitemapTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, format := range sitemapTimeFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
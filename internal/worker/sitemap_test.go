@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/jasdel/harvester/internal/robots"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseSitemap(t *testing.T) {
+	sitemapURL, _ := url.Parse("https://example.com/sitemap.xml")
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>https://example.com/</loc><lastmod>2015-03-01</lastmod></url>
+	<url><loc> https://example.com/about </loc><lastmod>2015-03-01T12:30:00+01:00</lastmod></url>
+	<url><loc>/relative</loc></url>
+	<url><loc>mailto:someone@example.com</loc></url>
+</urlset>`
+
+	urls, sitemaps, err := parseSitemap(sitemapURL, []byte(doc))
+	require.Nil(t, err, "Expect no parse error")
+	assert.Empty(t, sitemaps, "Expect no sitemaps")
+	assert.Equal(t, []SitemapURL{
+		{URL: "https://example.com/", LastMod: time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{URL: "https://example.com/about", LastMod: time.Date(2015, 3, 1, 11, 30, 0, 0, time.UTC)},
+		{URL: "https://example.com/relative"},
+	}, urls, "Expect sitemap URLs")
+}
+
+func TestParseSitemapIndex(t *testing.T) {
+	sitemapURL, _ := url.Parse("https://example.com/sitemap.xml")
+	doc := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>https://example.com/sitemap-pages.xml.gz</loc></sitemap>
+	<sitemap><loc>https://example.com/sitemap-posts.xml</loc></sitemap>
+</sitemapindex>`
+
+	urls, sitemaps, err := parseSitemap(sitemapURL, []byte(doc))
+	require.Nil(t, err, "Expect no parse error")
+	assert.Empty(t, urls, "Expect no URLs")
+	assert.Equal(t, []string{
+		"https://example.com/sitemap-pages.xml.gz",
+		"https://example.com/sitemap-posts.xml",
+	}, sitemaps, "Expect index sitemaps")
+}
+
+func TestDiscoverSitemaps(t *testing.T) {
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/pages.xml.gz</loc></sitemap></sitemapindex>`, server.URL)
+		case "/pages.xml.gz":
+			buf := bytes.Buffer{}
+			gz := gzip.NewWriter(&buf)
+			fmt.Fprint(gz, `<urlset><url><loc>/a</loc></url><url><loc>/b</loc></url></urlset>`)
+			gz.Close()
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(buf.Bytes())
+		case "/robots-sitemap.xml":
+			fmt.Fprint(w, `<urlset><url><loc>/b</loc></url><url><loc>/c</loc><lastmod>2015-03-01</lastmod></url></urlset>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c, sc := newTestCrawler(t, CrawlerConfig{HostRequestsPerSecond: 1000})
+	defer sc.Close()
+	rules := robots.Parse([]byte("Sitemap: " + server.URL + "/robots-sitemap.xml\nSitemap: " + server.URL + "/missing.xml\n"))
+
+	urls := c.discoverSitemaps(server.URL, rules)
+	assert.Equal(t, []SitemapURL{
+		{URL: server.URL + "/b"},
+		{URL: server.URL + "/c", LastMod: time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{URL: server.URL + "/a"},
+	}, urls, "Expect URLs of all sitemaps")
+
+	// The guessed sitemap is not requested if the robots.txt disallows it.
+	disallowed := robots.Parse([]byte("User-agent: *\nDisallow: /sitemap.xml\nSitemap: " + server.URL + "/robots-sitemap.xml\n"))
+	urls = c.discoverSitemaps(server.URL, disallowed)
+	assert.Equal(t, []SitemapURL{
+		{URL: server.URL + "/b"},
+		{URL: server.URL + "/c", LastMod: time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}, urls, "Expect URLs of allowed sitemaps")
+
+	// Sitemaps are not requested while the host is backing off.
+	require.Nil(t, sc.HostClient().Backoff(server.URL, time.Now().Add(time.Hour)), "Expect no storage error")
+	requests = 0
+	assert.Len(t, c.discoverSitemaps(server.URL, rules), 0, "Expect no sitemaps requested")
+	assert.Equal(t, 0, requests, "Expect host limits honored")
+}
@@ -0,0 +1,259 @@
+package worker
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// CSS URL regex pattern. Matches the url(...) pattern, with or without
+	// quotes, and the quoted form of @import rules. The url(...) form of
+	// @import rules is matched by the url(...) pattern.
+	cssURLRegexp = `url\(\s*(?:'([^']*)'|"([^"]*)"|([^'"()\s]+))\s*\)|@import\s+(?:'([^']*)'|"([^"]*)")`
+
+	// Generic URL pattern for <scheme>://domain/path.  This will
+	// match anything that kind of looks like a URL. via the //... pattern
+	// for auto scheme URLs.
+	genericURLRegexp = `(https?:\/\/[\w.\/=&?:-]+)|(\/\/[\w.\/=&?:-]+)`
+)
+
+var cssURLRegexpComp *regexp.Regexp
+var genericURLregexpComp *regexp.Regexp
+
+func init() {
+	cssURLRegexpComp = regexp.MustCompile(cssURLRegexp)
+	genericURLregexpComp = regexp.MustCompile(genericURLRegexp)
+}
+
+// A link found in a document.
+type Link struct {
+	// Absolute URL of the link, resolved against the document's base URL.
+	URL string
+
+	// Element the link was found on, e.g: a, img, meta. Links found in
+	// stylesheets, and javascript are recorded as found on style, and
+	// script elements.
+	Tag string
+
+	// Attribute of the element the link was found in, e.g: href, src
+	Attr string
+}
+
+// Attributes of each HTML element which contain links.
+var htmlLinkAttrs = map[string][]string{
+	"a":      {"href"},
+	"area":   {"href"},
+	"link":   {"href"},
+	"img":    {"src", "srcset"},
+	"source": {"src", "srcset"},
+	"iframe": {"src"},
+	"frame":  {"src"},
+	"script": {"src"},
+	"embed":  {"src"},
+	"audio":  {"src"},
+	"video":  {"src", "poster"},
+	"track":  {"src"},
+	"input":  {"src"},
+	"form":   {"action"},
+}
+
+// Relations of <link> elements which do not link to a document or resource.
+var htmlIgnoredLinkRels = map[string]bool{
+	"dns-prefetch": true,
+	"preconnect":   true,
+}
+
+// Searches through the HTML document for the links of its elements, using
+// an HTML tokenizer. Comments are not searched. The inline styles, and
+// scripts of the document are only searched if the options ask for
+// stylesheets, and javascript to be. Links are resolved against the
+// document's URL, or the document's <base> if it has one. Links which are
+// not valid, or are not http or https URLs are dropped.
+func findHTMLDocLinks(docURL *url.URL, doc []byte, opts ScrapeOptions) []Link {
+	base := docURL
+	raw := []Link{}
+
+	// Element whose raw text content is being tokenized, e.g: style, script
+	rawTag := ""
+
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		switch tt {
+		case html.TextToken:
+			switch {
+			case rawTag == "style" && opts.CSS:
+				raw = append(raw, urlLinks(findCSSDocURLs(z.Text()), "style", "")...)
+			case rawTag == "script" && opts.JS:
+				raw = append(raw, urlLinks(findGenericDocURLs(z.Text()), "script", "")...)
+			}
+			continue
+		case html.EndTagToken:
+			rawTag = ""
+			continue
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
+
+		t := z.Token()
+		rawTag = ""
+		if tt == html.StartTagToken && (t.Data == "style" || t.Data == "script") {
+			rawTag = t.Data
+		}
+		if style, ok := htmlAttr(t, "style"); ok && opts.CSS {
+			raw = append(raw, urlLinks(findCSSDocURLs([]byte(style)), t.Data, "style")...)
+		}
+
+		switch t.Data {
+		case "base":
+			// Only the first <base> with a href is used by the document.
+			if href, ok := htmlAttr(t, "href"); ok && base == docURL {
+				if u, err := docURL.Parse(strings.TrimSpace(href)); err == nil {
+					base = u
+				}
+			}
+		case "meta":
+			if equiv, _ := htmlAttr(t, "http-equiv"); strings.EqualFold(equiv, "refresh") {
+				content, _ := htmlAttr(t, "content")
+				if u := metaRefreshURL(content); u != "" {
+					raw = append(raw, Link{URL: u, Tag: "meta", Attr: "content"})
+				}
+			}
+		case "link":
+			if rel, _ := htmlAttr(t, "rel"); htmlIgnoredLinkRels[strings.ToLower(strings.TrimSpace(rel))] {
+				continue
+			}
+			fallthrough
+		default:
+			for _, attr := range htmlLinkAttrs[t.Data] {
+				v, ok := htmlAttr(t, attr)
+				if !ok {
+					continue
+				}
+				if attr == "srcset" {
+					for _, u := range srcsetURLs(v) {
+						raw = append(raw, Link{URL: u, Tag: t.Data, Attr: attr})
+					}
+				} else if v = strings.TrimSpace(v); v != "" {
+					raw = append(raw, Link{URL: v, Tag: t.Data, Attr: attr})
+				}
+			}
+		}
+	}
+
+	return resolveLinks(base, raw)
+}
+
+// Searches through a stylesheet for the URLs of its url() values, and
+// @import rules. Links are resolved against the stylesheet's URL.
+func findCSSDocLinks(docURL *url.URL, doc []byte) []Link {
+	return resolveLinks(docURL, urlLinks(findCSSDocURLs(doc), "style", ""))
+}
+
+// Searches through javascript for things which look like URLs. Links are
+// resolved against the javascript's URL.
+func findJSDocLinks(docURL *url.URL, doc []byte) []Link {
+	return resolveLinks(docURL, urlLinks(findGenericDocURLs(doc), "script", ""))
+}
+
+// Returns the URLs as links found on the element's attribute.
+func urlLinks(urls []string, tag, attr string) []Link {
+	links := make([]Link, 0, len(urls))
+	for _, u := range urls {
+		if u != "" {
+			links = append(links, Link{URL: u, Tag: tag, Attr: attr})
+		}
+	}
+	return links
+}
+
+// Resolves the URLs of the links against the base URL. Links which are not
+// valid, or are not http or https URLs are dropped.
+func resolveLinks(base *url.URL, raw []Link) []Link {
+	links := make([]Link, 0, len(raw))
+	for _, l := range raw {
+		u, err := normalizeURL(base, l.URL)
+		if err != nil {
+			continue
+		}
+		l.URL = u
+		links = append(links, l)
+	}
+
+	return links
+}
+
+// Returns the value of the token's attribute, and if the attribute was found.
+// The tokenizer has already decoded any entities of the value.
+func htmlAttr(t html.Token, key string) (string, bool) {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// Returns the URLs of the image candidates of a srcset attribute,
+// e.g: "small.png 1x, large.png 2x"
+func srcsetURLs(srcset string) []string {
+	urls := []string{}
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// Returns the URL of a <meta http-equiv="refresh"> content attribute, e.g:
+// "5; url=http://example.com". The "url=" prefix is optional, and spaces are
+// allowed around the "=". Empty if the content does not have a URL.
+func metaRefreshURL(content string) string {
+	i := strings.Index(content, ";")
+	if i < 0 {
+		return ""
+	}
+	content = strings.TrimSpace(content[i+1:])
+	if len(content) >= 3 && strings.EqualFold(content[:3], "url") {
+		if rest := strings.TrimSpace(content[3:]); strings.HasPrefix(rest, "=") {
+			content = strings.TrimSpace(rest[1:])
+		}
+	}
+	return strings.Trim(content, `'"`)
+}
+
+// Searches through a CSS document for strings which look or are used as URLs
+func findCSSDocURLs(doc []byte) []string {
+	return findURLs(doc, cssURLRegexpComp)
+}
+
+// Searches through a generic document for things which look like URLs
+func findGenericDocURLs(doc []byte) []string {
+	return findURLs(doc, genericURLregexpComp)
+}
+
+// Searches through the document searching for matches, and returns those
+func findURLs(doc []byte, reg *regexp.Regexp) []string {
+	urls := []string{}
+
+	matches := reg.FindAllSubmatch(doc, -1)
+	for i := 0; i < len(matches); i++ {
+		matchGroup := matches[i]
+		for j := 1; j < len(matchGroup); j++ {
+			// Skip the first index since it is the full matched phrase, not the sub match
+			if len(matchGroup[j]) > 0 {
+				urls = append(urls, strings.TrimSpace(string(matchGroup[j])))
+			}
+		}
+	}
+
+	return urls
+}
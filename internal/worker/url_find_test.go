@@ -0,0 +1,186 @@
+package worker
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+type TestCase struct {
+	Desc    string
+	Input   string
+	Results []string
+	Fn      func([]byte) []string
+}
+
+var testCases []TestCase = []TestCase{
+	TestCase{
+		Desc: "CSS Doc URLs",
+		Fn:   findCSSDocURLs,
+		Input: `
+background-css: url('something.png');
+background-css: url("http://www.example.com/other.jpg");
+`,
+		Results: []string{
+			"something.png",
+			"http://www.example.com/other.jpg",
+		},
+	},
+
+	TestCase{
+		Desc: "CSS Doc unquoted URLs and imports",
+		Fn:   findCSSDocURLs,
+		Input: `
+@import "base.css";
+@import url(print.css) print;
+@font-face { src: url( fonts/font.woff2 ) format("woff2"); }
+`,
+		Results: []string{
+			"base.css",
+			"print.css",
+			"fonts/font.woff2",
+		},
+	},
+
+	TestCase{
+		Desc: "Gengeric Doc URLs",
+		Fn:   findGenericDocURLs,
+		Input: `
+// some comment
+"https://www.example.com/",
+var url = '//example.com'
+`,
+		Results: []string{
+			"https://www.example.com/",
+			"//example.com",
+		},
+	},
+}
+
+func TestFindURLs(t *testing.T) {
+	for i, c := range testCases {
+		urls := c.Fn([]byte(c.Input))
+		require.Equal(t, len(c.Results), len(urls), "%s:%d: Expect number of results to match", c.Desc, i, urls)
+		for j, u := range urls {
+			assert.Equal(t, c.Results[j], u, "%s:%d:%d: Expected URL found to match", c.Desc, i, j)
+		}
+	}
+}
+
+func TestFindHTMLDocLinks(t *testing.T) {
+	docURL, _ := url.Parse("https://example.com/dir/page.html")
+	doc := `
+<a href="some-URL">url</a>
+<a href='single-quoted'>single</a>
+<a href=unquoted>unquoted</a>
+<img src="some-url2"/>
+<a class="gb_f" href="https://www.google.com/imghp?hl=en&amp;tab=wi&amp;authuser=0" data-pid="2">Images</a>
+<img alt="Learning Resources Pretend &amp;amp; Play School Set" src="
+data:image/jpeg;base64,/9j/4AAQSkZJRgABAQAAAQABAAD/2wBDAAoHBwgH
+
+">
+<img srcset="small.png 1x, large.png 2x">
+<script src="/assets/application-3eb6399a0c53c9273cc25d871fbf02a4.js" type="text/javascript">
+	var s = '<a href="in-script">';
+</script>
+<!-- <a href="in-comment">comment</a> -->
+<link rel="stylesheet" href="style.css">
+<link rel="dns-prefetch" href="//cdn.example.com">
+<meta http-equiv="refresh" content="5; url='/refreshed'">
+<iframe src="frame.html"></iframe>
+<form action="/search"></form>
+<map><area href="area.html"></map>
+<a href="mailto:someone@example.com">mail</a>
+<a href="#top">top</a>
+`
+
+	links := findHTMLDocLinks(docURL, []byte(doc), ScrapeOptions{})
+	assert.Equal(t, []Link{
+		{URL: "https://example.com/dir/some-URL", Tag: "a", Attr: "href"},
+		{URL: "https://example.com/dir/single-quoted", Tag: "a", Attr: "href"},
+		{URL: "https://example.com/dir/unquoted", Tag: "a", Attr: "href"},
+		{URL: "https://example.com/dir/some-url2", Tag: "img", Attr: "src"},
+		{URL: "https://www.google.com/imghp?hl=en&tab=wi&authuser=0", Tag: "a", Attr: "href"},
+		{URL: "https://example.com/dir/small.png", Tag: "img", Attr: "srcset"},
+		{URL: "https://example.com/dir/large.png", Tag: "img", Attr: "srcset"},
+		{URL: "https://example.com/assets/application-3eb6399a0c53c9273cc25d871fbf02a4.js", Tag: "script", Attr: "src"},
+		{URL: "https://example.com/dir/style.css", Tag: "link", Attr: "href"},
+		{URL: "https://example.com/refreshed", Tag: "meta", Attr: "content"},
+		{URL: "https://example.com/dir/frame.html", Tag: "iframe", Attr: "src"},
+		{URL: "https://example.com/search", Tag: "form", Attr: "action"},
+		{URL: "https://example.com/dir/area.html", Tag: "area", Attr: "href"},
+		{URL: "https://example.com/dir/page.html", Tag: "a", Attr: "href"},
+	}, links, "Expect links found")
+}
+
+func TestMetaRefreshURL(t *testing.T) {
+	cases := []struct {
+		Content string
+		URL     string
+	}{
+		{Content: "5; url=http://example.com", URL: "http://example.com"},
+		{Content: "5; URL='/next'", URL: "/next"},
+		{Content: "0; URL = /next", URL: "/next"},
+		{Content: "0; /next", URL: "/next"},
+		{Content: "0;urls/next", URL: "urls/next"},
+		{Content: "0;", URL: ""},
+		{Content: "30", URL: ""},
+	}
+	for i, c := range cases {
+		assert.Equal(t, c.URL, metaRefreshURL(c.Content), "%d: Expect URL of %q", i, c.Content)
+	}
+}
+
+func TestFindHTMLDocLinksBase(t *testing.T) {
+	docURL, _ := url.Parse("https://example.com/dir/page.html")
+	doc := `
+<head><base href="http://other.example.com/base/"></head>
+<a href="relative">relative</a>
+<a href="/absolute">absolute</a>
+`
+
+	links := findHTMLDocLinks(docURL, []byte(doc), ScrapeOptions{})
+	assert.Equal(t, []Link{
+		{URL: "http://other.example.com/base/relative", Tag: "a", Attr: "href"},
+		{URL: "http://other.example.com/absolute", Tag: "a", Attr: "href"},
+	}, links, "Expect links resolved against base")
+}
+
+func TestFindHTMLDocLinksInline(t *testing.T) {
+	docURL, _ := url.Parse("https://example.com/dir/page.html")
+	doc := `
+<style>
+	body { background: url("bg.png"); }
+</style>
+<div style="background-image: url('/hero.jpg')"></div>
+<script>
+	var api = "https://api.example.com/v1";
+</script>
+`
+
+	links := findHTMLDocLinks(docURL, []byte(doc), ScrapeOptions{})
+	assert.Empty(t, links, "Expect inline styles and scripts not searched")
+
+	links = findHTMLDocLinks(docURL, []byte(doc), ScrapeOptions{CSS: true, JS: true})
+	assert.Equal(t, []Link{
+		{URL: "https://example.com/dir/bg.png", Tag: "style", Attr: ""},
+		{URL: "https://example.com/hero.jpg", Tag: "div", Attr: "style"},
+		{URL: "https://api.example.com/v1", Tag: "script", Attr: ""},
+	}, links, "Expect inline links found")
+}
+
+func TestFindCSSDocLinks(t *testing.T) {
+	docURL, _ := url.Parse("https://example.com/css/site.css")
+	doc := `
+@import url("https://fonts.example.com/css?family=Sans");
+.logo { background: url(../img/logo.svg); }
+.icon { background: url("data:image/png;base64,iVBORw0KGgo="); }
+`
+
+	links := findCSSDocLinks(docURL, []byte(doc))
+	assert.Equal(t, []Link{
+		{URL: "https://fonts.example.com/css?family=Sans", Tag: "style", Attr: ""},
+		{URL: "https://example.com/img/logo.svg", Tag: "style", Attr: ""},
+	}, links, "Expect stylesheet links found")
+}
@@ -1,12 +1,27 @@
 
 -- Collection of URLs encountered
 CREATE TABLE IF NOT EXISTS url (
-    id         serial PRIMARY KEY,
-    mime       TEXT,                   -- content type this URL references
-    url        TEXT   NOT NULL,        -- URL of the content
-    crawled_on TIMESTAMP WITH TIME ZONE
+    id           serial PRIMARY KEY,
+    mime         TEXT,                   -- content type this URL references
+    url          TEXT   NOT NULL,        -- URL of the content
+    host         TEXT,                   -- lower cased host of the URL, including the port if set
+    crawled_on   TIMESTAMP WITH TIME ZONE,
+    crawl_status TEXT,                   -- outcome of the crawl, e.g: crawled, blocked by robots
+
+    -- HTTP metadata of the last fetch of the URL
+    status_code    INT,    -- HTTP status code of the response, 0 if there was no response
+    final_url      TEXT,   -- URL of the response after following redirects
+    content_length BIGINT, -- length of the response content in bytes, -1 if unknown
+    etag           TEXT,   -- ETag header of the response
+    last_modified  TEXT,   -- Last-Modified header of the response
+    response_time  BIGINT, -- milliseconds until the response content was read
+    fetch_error    TEXT,   -- error the fetch failed with
+    fetch_error_kind TEXT, -- kind of error the fetch failed with, e.g: dns, tls, timeout
+    fetched_on     TIMESTAMP WITH TIME ZONE, -- The time stamp the URL was last fetched
+    lastmod        TIMESTAMP WITH TIME ZONE  -- The time stamp a sitemap listed the URL as last modified
 );
 CREATE UNIQUE INDEX url_unique ON url(url);
+CREATE INDEX url_host ON url(host);
 
 -- Links a refer URL with a content URL
 CREATE TABLE IF NOT EXISTS url_link (
@@ -14,32 +29,47 @@ CREATE TABLE IF NOT EXISTS url_link (
     refer_id INT NOT NULL
 );
 CREATE UNIQUE INDEX url_link_pair ON url_link (url_id, refer_id);
+CREATE INDEX url_link_refer ON url_link (refer_id, url_id); -- outbound links of a URL
 
 -- Scheduled Job
 CREATE TABLE IF NOT EXISTS job (
     id           serial                   PRIMARY KEY,
-    created_on   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+    created_on   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    options      TEXT   NOT NULL DEFAULT '{}', -- JSON encoded options the job is crawled with
+    pages_crawled BIGINT NOT NULL DEFAULT 0,   -- number of pages crawled by the job
+    bytes_crawled BIGINT NOT NULL DEFAULT 0,   -- number of content bytes downloaded by the job
+    tags          TEXT   NOT NULL DEFAULT '[]', -- JSON encoded list of tags the job was scheduled with
+    callback_url  TEXT   NOT NULL DEFAULT '',   -- URL the client asked to be called back on
+    idempotency_key TEXT,                       -- client supplied key identifying the schedule request
+    state         TEXT   NOT NULL DEFAULT 'running', -- running, paused, or cancelled
+    cancelled_on  TIMESTAMP WITH TIME ZONE      -- The time stamp the job was cancelled
 );
+CREATE UNIQUE INDEX job_idempotency_key ON job(idempotency_key);
 
 -- Origin URLs from a job
 CREATE TABLE IF NOT EXISTS job_url (
     job_id       INT    NOT NULL,          -- Job this URL belongs to
     url_id       INT    NOT NULL,          -- URL to be crawled for this job
     completed_on TIMESTAMP WITH TIME ZONE, -- The time stamp the crawl was completed
+    options      TEXT,                     -- JSON encoded options of this URL, if they differ from the job's
 
     FOREIGN KEY (url_id) REFERENCES url(id)
 );
 
 -- Results for each job.
 CREATE TABLE IF NOT EXISTS job_result (
+    id       serial PRIMARY KEY, -- increases as results are added, used as the result cursor
     job_id   INT  NOT NULL,
     refer_Id INT  NOT NULL, -- URL which this job URL result was found on
     url_id   INT  NOT NULL, -- URL for this result
+    level    INT  NOT NULL DEFAULT 0, -- number of links from the job URL to this result
 
     FOREIGN KEY (refer_id) REFERENCES url(id),
     FOREIGN KEY (url_id)   REFERENCES url(id)
 );
 CREATE UNIQUE INDEX job_result_pair ON job_result(job_id,refer_id,url_id);
+CREATE INDEX job_result_cursor ON job_result(job_id,id);
+CREATE INDEX job_result_level ON job_result(job_id,level);
 
 -- job URL still pending
 CREATE TABLE IF NOT EXISTS url_pending (
@@ -47,3 +77,84 @@ CREATE TABLE IF NOT EXISTS url_pending (
 	origin_id INT NOT NULL, -- The Job URL that this URL is a descendant of 
 	url_Id    INT NOT NULL  -- URL that is pending being crawled.
 );
+
+-- Cached robots.txt of each site
+CREATE TABLE IF NOT EXISTS robots (
+    host        TEXT PRIMARY KEY,                  -- scheme and host of the site, e.g: https://example.com
+    status_code INT  NOT NULL,                     -- HTTP status code of the fetch, 0 if unreachable
+    body        TEXT,                              -- content of the robots.txt
+    fetched_on  TIMESTAMP WITH TIME ZONE NOT NULL  -- The time stamp the robots.txt was fetched
+);
+
+-- Request limits of each host, shared by all workers
+CREATE TABLE IF NOT EXISTS host_limit (
+    host             TEXT PRIMARY KEY,         -- scheme and host of the site, e.g: https://example.com
+    active           INT  NOT NULL DEFAULT 0,  -- number of connections currently acquired to the host
+    next_request_on  TIMESTAMP WITH TIME ZONE, -- earliest time the next connection can be acquired
+    backoff_until    TIMESTAMP WITH TIME ZONE, -- no connections can be acquired until this time
+    lease_expires_on TIMESTAMP WITH TIME ZONE  -- active connections are abandoned after this time
+);
+
+-- URLs which failed to be crawled after all their attempts
+CREATE TABLE IF NOT EXISTS dead_letter (
+    id          serial                   PRIMARY KEY,
+    job_id      INT                      NOT NULL, -- Job the URL was crawled for
+    url_id      INT                      NOT NULL, -- URL which failed to be crawled
+    origin_id   INT                      NOT NULL, -- The Job URL that this URL is a descendant of
+    refer_id    INT                      NOT NULL, -- URL which this URL was found on
+    attempts    INT                      NOT NULL, -- number of times the URL was attempted
+    last_error  TEXT                     NOT NULL, -- error of the last attempt
+    status_code INT                      NOT NULL, -- HTTP status code of the last attempt, 0 if there was no response
+    created_on  TIMESTAMP WITH TIME ZONE NOT NULL, -- The time stamp the URL was given up on
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+CREATE INDEX dead_letter_job ON dead_letter(job_id);
+
+-- Queued items of paused jobs, held until the job is resumed
+CREATE TABLE IF NOT EXISTS parked_item (
+    id         serial                   PRIMARY KEY,
+    job_id     INT                      NOT NULL, -- Job the item was queued for
+    item       TEXT                     NOT NULL, -- JSON encoded URL queue item
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL  -- The time stamp the item was parked
+);
+CREATE INDEX parked_item_job ON parked_item(job_id);
+
+-- Items waiting to be sent to a queue once they are due, such as crawls which
+-- failed and will be retried, or were deferred because their host was busy
+CREATE TABLE IF NOT EXISTS scheduled_item (
+    id         serial                   PRIMARY KEY,
+    job_id     INT                      NOT NULL, -- Job the item was queued for
+    queue      TEXT                     NOT NULL, -- url or work, the queue the item is sent to
+    item       TEXT                     NOT NULL, -- JSON encoded URL queue item
+    due_on     TIMESTAMP WITH TIME ZONE NOT NULL, -- earliest time the item can be sent
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL  -- The time stamp the item was scheduled
+);
+CREATE INDEX scheduled_item_due ON scheduled_item(due_on);
+
+-- Callbacks of jobs to their callback URL, made once the job is done
+CREATE TABLE IF NOT EXISTS job_callback (
+    id              serial                   PRIMARY KEY,
+    job_id          INT                      NOT NULL, -- Job the callback is made for
+    event           TEXT                     NOT NULL, -- job.completed, job.failed, or job.cancelled
+    url             TEXT                     NOT NULL, -- URL the callback is delivered to
+    state           TEXT                     NOT NULL, -- pending, delivered, or failed
+    attempts        INT                      NOT NULL DEFAULT 0, -- number of delivery attempts made
+    next_attempt_on TIMESTAMP WITH TIME ZONE NOT NULL, -- earliest time the next attempt can be made
+    created_on      TIMESTAMP WITH TIME ZONE NOT NULL, -- The time stamp the job was done
+    delivered_on    TIMESTAMP WITH TIME ZONE           -- The time stamp the callback was delivered
+);
+CREATE UNIQUE INDEX job_callback_job ON job_callback(job_id);
+CREATE INDEX job_callback_due ON job_callback(state, next_attempt_on);
+
+-- Delivery attempts of job callbacks
+CREATE TABLE IF NOT EXISTS job_callback_attempt (
+    id           serial                   PRIMARY KEY,
+    callback_id  INT                      NOT NULL, -- Callback the attempt was made for
+    attempted_on TIMESTAMP WITH TIME ZONE NOT NULL, -- The time stamp the attempt was made
+    status_code  INT                      NOT NULL, -- HTTP status code of the response, 0 if there was no response
+    error        TEXT                     NOT NULL, -- error the attempt failed with
+
+    FOREIGN KEY (callback_id) REFERENCES job_callback(id)
+);
+CREATE INDEX job_callback_attempt_callback ON job_callback_attempt(callback_id);
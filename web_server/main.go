@@ -5,10 +5,10 @@ import (
 	"flag"
 	"github.com/jasdel/harvester/internal/queue"
 	"github.com/jasdel/harvester/internal/storage"
+	"github.com/jasdel/harvester/internal/web"
 	"log"
 	"net/http"
 	"os"
-	"path"
 )
 
 // Web server for exposing an interface for scheduling jobs, checking their status, and
@@ -21,6 +21,9 @@ import (
 // GET: /status/:jobId
 //		- Get the status of an already scheduled job.
 //
+// GET: /status/:jobId/stream
+//		- Stream the progress of an already scheduled job as server-sent events.
+//
 // GET: /result/:jobId
 //		- Get the result of an already scheduled job
 //
@@ -28,6 +31,9 @@ import (
 // Publish to URL Queue:
 // Scheduled Job URLs will be sent to the URL Queue to be filtered and later crawled.
 //
+// Subscribe to Progress Queue:
+// Progress published by the foremen and workers is streamed to job status stream clients.
+//
 func main() {
 	// Configuration file containing all basic configuration for a server instance to run
 	cfgFilename := flag.String("config", "config.json", "The web server configuration file.")
@@ -55,6 +61,16 @@ func main() {
 	}
 	defer urlQueuePub.Close()
 
+	// Initialize the subscriber to the progress of jobs, if configured,
+	// for streaming the job's status to clients.
+	var progressSub queue.ProgressSubscriber
+	if cfg.ProgressQueueConfig.ConnURL != "" {
+		if progressSub, err = queue.NewProgressSubscriber(cfg.ProgressQueueConfig); err != nil {
+			log.Fatalln("Progress Subscriber initialization failed:", err)
+		}
+		defer progressSub.Close()
+	}
+
 	// Initialize the storage for checking the status and results of jobs
 	sc, err := storage.NewClient(cfg.StorageConfig)
 	if err != nil {
@@ -63,14 +79,11 @@ func main() {
 	defer sc.Close()
 
 	// Create the HTTP handlers to be able to provide an interface for serving
-	// job schedule, status, and result requests. The Trailing '/' have to be append
-	// because path.Join will strip off the trailing '/'
-	http.Handle(path.Join("/", cfg.HTTPRootPath), &JobScheduleHandler{urlQueuePub: urlQueuePub, sc: sc})
-	http.Handle(path.Join("/", cfg.HTTPRootPath, "status")+"/", &JobStatusHandler{sc: sc})
-	http.Handle(path.Join("/", cfg.HTTPRootPath, "result")+"/", &JobResultHandler{sc: sc})
+	// job schedule, status, and result requests.
+	handler := web.NewHandler(cfg.HTTPRootPath, urlQueuePub, progressSub, sc)
 
 	log.Println("Listening on", cfg.HTTPAddr)
-	if err := http.ListenAndServe(cfg.HTTPAddr, nil); err != nil {
+	if err := http.ListenAndServe(cfg.HTTPAddr, handler); err != nil {
 		log.Fatalln(err)
 	}
 }
@@ -84,6 +97,10 @@ type Config struct {
 	// URL queue for publishing scheduled job URLs to the foreman
 	URLQueueConfig queue.QueueConfig `json:"urlQueue"`
 
+	// Topic to receive the progress of jobs from, for streaming the job's
+	// status. If no connection URL is set job status streams are not supported.
+	ProgressQueueConfig queue.QueueConfig `json:"progressQueue"`
+
 	// HTTP address to service content from
 	HTTPAddr string `json:"httpAddr"`
 
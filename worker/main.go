@@ -6,8 +6,11 @@ import (
 	"fmt"
 	"github.com/jasdel/harvester/internal/queue"
 	"github.com/jasdel/harvester/internal/storage"
+	"github.com/jasdel/harvester/internal/worker"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -25,6 +28,15 @@ import (
 // If crawling a work item produces any descendant URLs those URLs will be enqueued to be
 // crawled, or added to the origin Job URL's results.
 //
+// Publish to Progress Queue:
+// As URLs are crawled, added to job results, and job URLs complete, their progress is
+// published so the web server can stream it to clients.
+//
+// Multiple work items are crawled concurrently, bounded by the configured
+// concurrency, and per host concurrency. On SIGINT or SIGTERM the worker stops
+// taking new work items, and waits for the in-flight crawls to finish before
+// exiting.
+//
 func main() {
 	// Configuration file containing all basic configuration for a server instance to run
 	cfgFilename := flag.String("config", "config.json", "The web server configuration file.")
@@ -41,7 +53,6 @@ func main() {
 	if err != nil {
 		log.Fatalln("Worker Queue Receiver: initialization failed:", err)
 	}
-	defer workQueueRecv.Close()
 
 	// Initialize the queue publisher for publishing descendants of
 	// a previously queued URL to be queued for crawling
@@ -51,6 +62,21 @@ func main() {
 	}
 	defer urlQueuePub.Close()
 
+	// Initialize the queue publisher for deferring work items back to
+	// the work queue when their host is busy.
+	workQueuePub, err := queue.NewPublisher(cfg.WorkQueueConfig)
+	if err != nil {
+		log.Fatalln("Worker Queue Publisher: initialization failed:", err)
+	}
+	defer workQueuePub.Close()
+
+	// Initialize the publisher for the progress of crawling the jobs' URLs.
+	progressPub, err := queue.NewProgressPublisher(cfg.ProgressQueueConfig)
+	if err != nil {
+		log.Fatalln("Worker Progress Publisher: initialization failed:", err)
+	}
+	defer progressPub.Close()
+
 	// Initialize the storage for determining the status of a URL,
 	// updating URL values, and Job completeness status
 	sc, err := storage.NewClient(cfg.StorageConfig)
@@ -59,15 +85,32 @@ func main() {
 	}
 	defer sc.Close()
 
-	crawler := NewCrawler(urlQueuePub, sc, cfg.MaxLevel)
-
-	log.Println("Ready: Waiting for URL work items...")
-	for {
-		item := <-workQueueRecv.Receive()
-		crawler.Crawl(item)
-
-		<-time.After(cfg.WorkDelay)
-	}
+	crawler := worker.NewCrawler(urlQueuePub, workQueuePub, progressPub, sc, worker.CrawlerConfig{
+		UserAgent:             cfg.UserAgent,
+		RobotsMaxAge:          cfg.RobotsMaxAge,
+		HostRequestsPerSecond: cfg.HostRequestsPerSecond,
+		HostMaxConnections:    cfg.HostMaxConnections,
+		HostConcurrency:       cfg.HostConcurrency,
+		MaxAttempts:           cfg.MaxAttempts,
+		RetryDelay:            cfg.RetryDelay,
+		SchedulePollInterval:  cfg.SchedulePollInterval,
+	})
+
+	pool := worker.NewPool(crawler, cfg.Concurrency)
+	pool.Start(workQueueRecv.Receive())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	log.Println("Ready: Waiting for URL work items with concurrency", cfg.Concurrency)
+	sig := <-stop
+
+	// Stop receiving new work items before waiting for the in-flight
+	// crawls, so no more work items are delivered to this worker.
+	log.Println("Received", sig.String(), "waiting for in-flight crawls to finish")
+	workQueueRecv.Close()
+	pool.Stop()
+	log.Println("Shutdown complete")
 }
 
 // Provides the Foreman's configuration information. For connecting to
@@ -83,19 +126,60 @@ type Config struct {
 	// a previously queued work URLQueueItem
 	URLQueueConfig queue.QueueConfig `json:"urlQueue"`
 
-	// the maximum level the crawling should be allowed to travel
-	MaxLevel int `json:"maxLevel"`
+	// Topic to publish the progress of crawling the jobs' URLs to. If no
+	// connection URL is set the progress is not published.
+	ProgressQueueConfig queue.QueueConfig `json:"progressQueue"`
 
-	// Delay before requesting additional work. Indented to prevent
-	// flooding domain's with too many requests back to back.
+	// User agent the worker identifies itself with when requesting URLs.
+	// The user agent is also used to select which rules of a site's
+	// robots.txt apply to the worker.
+	UserAgent string `json:"userAgent"`
+
+	// Maximum age a site's robots.txt is cached for before it is
+	// requested again. Defaults to 24 hours if not set.
 	// time.Duration string formated value.
-	// e.g: 1m23s for 1 minute and 23 seconds
-	// See http://golang.org/pkg/time/#ParseDuration for formatting
-	WorkDelayStr string `json:"workDelay"`
+	RobotsMaxAgeStr string `json:"robotsMaxAge"`
+
+	// The RobotsMaxAgeStr will be parsed, and its value placed into the RobotsMaxAge field.
+	RobotsMaxAge time.Duration `json:"-"`
+
+	// Maximum number of requests per second made to a single host, shared
+	// across all workers. A site's robots.txt crawl delay is used instead
+	// if it is longer. Defaults to 1 request per second if not set.
+	HostRequestsPerSecond float64 `json:"hostRequestsPerSecond"`
+
+	// Maximum number of concurrent connections to a single host, shared
+	// across all workers. Defaults to 1 if not set.
+	HostMaxConnections int `json:"hostMaxConnections"`
 
-	// The WorkDelayStr will be parsed, and its value placed into the WorkDelay field.
-	// Used to provide delay between accepting more work.
-	WorkDelay time.Duration `json:"-"`
+	// Maximum number of work items crawled concurrently by this worker.
+	// Defaults to 1 if not set.
+	Concurrency int `json:"concurrency"`
+
+	// Maximum number of concurrent crawls of a single host by this worker.
+	// Defaults to 1 if not set.
+	HostConcurrency int `json:"hostConcurrency"`
+
+	// Maximum number of times a URL is attempted to be crawled when it fails
+	// with a server error or connection failure, before it is recorded as a
+	// dead letter. Defaults to 3 if not set.
+	MaxAttempts int `json:"maxAttempts"`
+
+	// Duration before the first retry of a URL which failed to be crawled.
+	// The delay doubles with each following attempt. Defaults to 30 seconds
+	// if not set. time.Duration string formated value.
+	RetryDelayStr string `json:"retryDelay"`
+
+	// The RetryDelayStr will be parsed, and its value placed into the RetryDelay field.
+	RetryDelay time.Duration `json:"-"`
+
+	// Interval storage is polled at for retried and deferred work items
+	// which are due to be sent to their queue. Defaults to 1 second if not
+	// set. time.Duration string formated value.
+	SchedulePollIntervalStr string `json:"schedulePollInterval"`
+
+	// The SchedulePollIntervalStr will be parsed, and its value placed into the SchedulePollInterval field.
+	SchedulePollInterval time.Duration `json:"-"`
 }
 
 // Loads the configuration file from disk in as a JSON blob.
@@ -112,14 +196,36 @@ func LoadConfig(filename string) (Config, error) {
 		return cfg, err
 	}
 
-	if cfg.WorkDelayStr != "" {
-		cfg.WorkDelay, err = time.ParseDuration(cfg.WorkDelayStr)
+	if cfg.RobotsMaxAgeStr != "" {
+		cfg.RobotsMaxAge, err = time.ParseDuration(cfg.RobotsMaxAgeStr)
+		if err != nil {
+			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.RobotsMaxAgeStr)
+		} else if cfg.RobotsMaxAge < 0 {
+			return cfg, fmt.Errorf("Invalid robots max age %s, must be positive", cfg.RobotsMaxAgeStr)
+		}
+	}
+
+	if cfg.RetryDelayStr != "" {
+		cfg.RetryDelay, err = time.ParseDuration(cfg.RetryDelayStr)
+		if err != nil {
+			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.RetryDelayStr)
+		} else if cfg.RetryDelay < 0 {
+			return cfg, fmt.Errorf("Invalid retry delay %s, must be positive", cfg.RetryDelayStr)
+		}
+	}
+
+	if cfg.SchedulePollIntervalStr != "" {
+		cfg.SchedulePollInterval, err = time.ParseDuration(cfg.SchedulePollIntervalStr)
 		if err != nil {
-			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.WorkDelayStr)
-		} else if cfg.WorkDelay < 0 {
-			return cfg, fmt.Errorf("Invalid work delay, must be positive", cfg.WorkDelayStr)
+			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.SchedulePollIntervalStr)
+		} else if cfg.SchedulePollInterval < 0 {
+			return cfg, fmt.Errorf("Invalid schedule poll interval %s, must be positive", cfg.SchedulePollIntervalStr)
 		}
 	}
 
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+
 	return cfg, nil
 }